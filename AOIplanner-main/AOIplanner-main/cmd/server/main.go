@@ -1,8 +1,14 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	echoMiddleware "github.com/labstack/echo/v4/middleware"
@@ -10,9 +16,11 @@ import (
 	"aoi/config"
 	"aoi/database"
 	"aoi/router"
+	"aoi/pkg/middleware"
 
 	// Auth
 	authCtrlImp "aoi/pkg/auth/controllerImp"
+	authRepoImp "aoi/pkg/auth/repositoryImp"
 
 	// Field
 	fieldCtrlImp "aoi/pkg/field/controllerImp"
@@ -24,6 +32,7 @@ import (
 
 	// Schedule
 	schedCtrlImp "aoi/pkg/schedule/controllerImp"
+	schedSvcImp  "aoi/pkg/schedule/serviceImp"
 	schedRepoImp "aoi/pkg/schedule/repositoryImp"
 
 	// Plan
@@ -34,6 +43,7 @@ import (
 	// Rules/LLM
 	"aoi/pkg/ai"
 	"aoi/pkg/climate"
+	"aoi/pkg/outbound"
 
 	// KB (names/paths must match repo exactly)
 	kbCtrlImp    "aoi/pkg/kb/controllerImp"
@@ -44,6 +54,35 @@ import (
 	// Health
 	healthCtrlImp "aoi/pkg/health/controllerImp"
 
+	// Drift worker
+	driftCtrlImp "aoi/pkg/drift/controllerImp"
+	driftRepoImp "aoi/pkg/drift/repositoryImp"
+	driftSvcImp  "aoi/pkg/drift/serviceImp"
+
+	// Calendar feeds
+	calCtrlImp "aoi/pkg/calendar/controllerImp"
+	calRepoImp "aoi/pkg/calendar/repositoryImp"
+
+	// Exports
+	exportCtrlImp "aoi/pkg/export/controllerImp"
+	exportSvcImp  "aoi/pkg/export/serviceImp"
+
+	// Problem catalogue
+	problemCtrlImp "aoi/pkg/problem/controllerImp"
+
+	// LLM response cache
+	llmCtrlImp "aoi/pkg/ai/controllerImp"
+
+	// Photo diagnosis
+	diagCtrlImp "aoi/pkg/diagnosis/controllerImp"
+	diagRepoImp "aoi/pkg/diagnosis/repositoryImp"
+	diagSvcImp  "aoi/pkg/diagnosis/serviceImp"
+
+	// Field assistant chat
+	chatCtrlImp "aoi/pkg/chat/controllerImp"
+	chatRepoImp "aoi/pkg/chat/repositoryImp"
+	chatSvcImp  "aoi/pkg/chat/serviceImp"
+
 	delCtrlImp "aoi/pkg/delivery/controllerImp"
     dsvc "aoi/pkg/delivery/service"
     "aoi/pkg/delivery"
@@ -72,6 +111,14 @@ delCtrl := delCtrlImp.New(delSvc)
 	delCtrl.Register(e)
 	// Static (keep your existing behavior)
 	e.Static("/static", "static")
+	// measurement photos; served as inert images even if a stray file is not one
+	e.Group("/uploads", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set("X-Content-Type-Options", "nosniff")
+			c.Response().Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+			return next(c)
+		}
+	}).Static("/", cfg.UploadDir)
 	e.File("/", "static/index.html")
 	if _, err := os.Stat("static/app.js"); err != nil {
 		log.Printf("WARN: static/app.js not found: %v", err)
@@ -87,12 +134,39 @@ delCtrl := delCtrlImp.New(delSvc)
 		log.Printf("rules warn: %v", err)
 	}
 
-	// 5) LLM (mock fallback)
-	var llm ai.Client
-	if cfg.LLMEndpoint != "" && cfg.LLMAPIKey != "" {
-		llm = ai.NewOpenAI(cfg.LLMEndpoint, cfg.LLMAPIKey, cfg.LLMModel)
-	} else {
-		llm = ai.NewMock()
+	// 5) LLM prompt templates, then providers in failover order (mock when none is configured)
+	if err := ai.LoadPrompts(cfg.PromptDir, cfg.PromptVersions); err != nil {
+		log.Fatalf("prompts: %v", err)
+	}
+	ai.SetContextTokens(cfg.PromptTokens)
+	outbound.SetDefaults(outbound.Policy{
+		Attempts: cfg.OutboundAttempts, Concurrency: cfg.OutboundConcurrency,
+		FailThreshold: cfg.BreakerFailures, Cooldown: cfg.BreakerCooldown,
+	})
+	pcs := make([]ai.ProviderConfig, len(cfg.LLMProviders))
+	for i, p := range cfg.LLMProviders {
+		pcs[i] = ai.ProviderConfig(p)
+	}
+	chain, err := ai.NewChain(pcs)
+	if err != nil {
+		log.Fatalf("llm: %v", err)
+	}
+	var llm ai.Client = chain
+	var llmCache *ai.Cache
+	if cfg.LLMCacheTTL > 0 {
+		llmCache = ai.NewCached(llm, db, chain.Signature(), ai.CacheOptions{
+			TTL: cfg.LLMCacheTTL, MaxEntries: cfg.LLMCacheMaxEntries, MaxBytes: int64(cfg.LLMCacheMaxMB) << 20,
+		})
+		llm = llmCache
+	}
+	var llmAudit *ai.Audit
+	if cfg.LLMAudit {
+		prices := map[string]ai.Price{}
+		for _, p := range pcs {
+			prices[p.Name] = ai.Price{In: p.PriceIn, Out: p.PriceOut}
+		}
+		llmAudit = ai.NewAudited(llm, db, prices)
+		llm = llmAudit
 	}
 
 	// 6) KB wiring — **ensure non-nil embedder**
@@ -110,36 +184,101 @@ delCtrl := delCtrlImp.New(delSvc)
 	mRepo := measRepoImp.New(db)
 	sRepo := schedRepoImp.New(db)
 	pRepo := planRepoImp.New(db)
-	fCtrl := fieldCtrlImp.New(fRepo)
-	meCtrl := measCtrlImp.New(mRepo)
-	scCtrl := schedCtrlImp.New(sRepo)
+	fCtrl := fieldCtrlImp.New(fRepo, cfg.Reviewers)
+	scSvc := schedSvcImp.NewScheduleService(sRepo, pRepo, mRepo, fRepo)
+	scCtrl := schedCtrlImp.New(sRepo, scSvc)
+
+	// Photo diagnosis (vision model through the LLM chain; confident findings add tasks)
+	loc, err := time.LoadLocation(cfg.Timezone)
+	if err != nil {
+		log.Printf("tz warn: %v (using local time)", err)
+		loc = time.Local
+	}
+	dgSvc := diagSvcImp.New(diagRepoImp.New(db), fRepo, mRepo, scSvc, llm, loc, cfg.UploadDir, cfg.DiagMinConfidence, cfg.LLMTimeout)
+	dgCtrl := diagCtrlImp.New(dgSvc)
+	meCtrl := measCtrlImp.New(mRepo, dgSvc, cfg.UploadDir)
 
 	// Plan service depends on rules/llm/repos + kb
-	pSvc := planSvc.NewPlanService(rules, llm, pRepo, sRepo, mRepo, kbSvc)
-	plCtrl := planCtrlImp.NewPlanCtrl(db, pSvc)
+	pSvc := planSvc.NewPlanService(db, rules, llm, pRepo, sRepo, mRepo, kbSvc).WithBudgets(planSvc.Budgets{
+		Total: cfg.PlanTimeout, KBSearch: cfg.KBTimeout, Summary: cfg.LLMTimeout, ProposeOps: cfg.LLMTimeout,
+	}).WithDiagnoses(dgSvc)
+	plCtrl := planCtrlImp.NewPlanCtrl(db, pSvc, cfg.Reviewers)
 
-	// Auth + Health
-	authCtrl := authCtrlImp.NewAuthController()
+	// Auth (incl. the user's language) + Health
+	prefRepo := authRepoImp.New(db)
+	authCtrl := authCtrlImp.NewAuthController(prefRepo)
 	hCtrl := healthCtrlImp.NewHealthCtrl(db)
 
+	// Nightly drift worker (runs at DRIFT_HOUR in TZ)
+	drift := driftSvcImp.New(driftRepoImp.New(db), fRepo, pSvc, loc, cfg.DriftHour)
+	dCtrl := driftCtrlImp.New(drift, fRepo)
+	if cfg.DriftWorker {
+		drift.Start()
+	}
+
+	// iCalendar feeds
+	calCtrl := calCtrlImp.New(calRepoImp.New(db), fRepo, pRepo, sRepo, prefRepo, cfg.Timezone)
+
+	// Excel export
+	exSvc := exportSvcImp.New(fRepo, pRepo, sRepo, mRepo, delSvc)
+	exCtrl := exportCtrlImp.New(exSvc)
+
+	// LLM cache metrics / per-field invalidation / provider health / prompts / call log
+	llmCtrl := llmCtrlImp.New(llmCache, chain, llmAudit, fRepo, cfg.Admins)
+
+	// Field assistant chat (KB retrieval + LLM, same timeouts as planning)
+	chSvc := chatSvcImp.New(chatRepoImp.New(db), fRepo, pRepo, mRepo, sRepo, scSvc, kbSvc, llm, loc, cfg.KBTimeout, cfg.LLMTimeout)
+	chCtrl := chatCtrlImp.New(chSvc)
+
+
+	// Idempotency-Key support for plan generation/replan (flaky mobile connections)
+	idem := middleware.Idempotency(db, 24*time.Hour)
 
 	// 8) Router — match actual signature (includes health)
 	r := router.New(
 		e,
 		fCtrl,
-		plCtrl.Generate,  // pass functions
-		plCtrl.Replan,
+		idem(plCtrl.Generate),  // pass functions
+		idem(plCtrl.Replan),
 		plCtrl.List,
+		plCtrl.Replans,
+		plCtrl.Citations,
+		plCtrl.Scenarios,
+		plCtrl.SummaryStream,
+		plCtrl,
 		meCtrl,
 		scCtrl,
 		authCtrl,
 		kbCtrl,
 		hCtrl,
+		dCtrl,
+		calCtrl,
+		exCtrl,
+		problemCtrlImp.New(),
+		llmCtrl,
+		dgCtrl,
+		middleware.Locale(prefRepo),
+		chCtrl,
 	)
 
-	// 9) Start
-	log.Printf("listening on :%s", cfg.Port)
-	if err := r.Start(":" + cfg.Port); err != nil {
-		log.Fatal(err)
+	// 9) Start, then shut down cleanly on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		log.Printf("listening on :%s", cfg.Port)
+		if err := r.Start(":" + cfg.Port); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	<-ctx.Done()
+
+	log.Printf("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := drift.Stop(shutdownCtx); err != nil {
+		log.Printf("drift worker stop: %v", err)
+	}
+	if err := r.Shutdown(shutdownCtx); err != nil {
+		log.Printf("http shutdown: %v", err)
 	}
 }
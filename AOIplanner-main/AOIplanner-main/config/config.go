@@ -1,8 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -15,6 +19,78 @@ type AppConfig struct {
 	LLMAPIKey   string
 	LLMModel    string
 	EnableLIFF  bool
+	DriftWorker bool // nightly drift evaluation in the server process
+	DriftHour   int  // local hour (in Timezone) the drift worker runs
+	Reviewers   []string // user ids allowed to approve plans (REVIEWER_UIDS, comma-separated)
+	Admins      []string // user ids allowed on /admin (ADMIN_UIDS, comma-separated; default the reviewers)
+
+	// Deadline budgets for plan generation/replan (Go durations, e.g. "20s");
+	// zero keeps the planner's defaults.
+	PlanTimeout time.Duration // whole request (PLAN_TIMEOUT)
+	LLMTimeout  time.Duration // each LLM call (LLM_TIMEOUT)
+	KBTimeout   time.Duration // KB search incl. query embedding (KB_TIMEOUT)
+
+	// LLM response cache (SQLite); LLM_CACHE_TTL=0 turns it off.
+	LLMCacheTTL        time.Duration // LLM_CACHE_TTL, default 168h
+	LLMCacheMaxEntries int           // LLM_CACHE_MAX_ENTRIES, default 2000
+	LLMCacheMaxMB      int           // LLM_CACHE_MAX_MB, default 20
+
+	// LLM providers in failover order. LLM_PROVIDERS=a,b names them and each
+	// is configured with LLM_<NAME>_KIND, _ENDPOINT, _API_KEY, _MODEL,
+	// _API_VERSION and _PRICE_IN/_PRICE_OUT (USD per 1M tokens). Without LLM_PROVIDERS, LLM_ENDPOINT/LLM_API_KEY give a
+	// single OpenAI provider, else the mock.
+	LLMProviders []LLMProvider
+	LLMAudit     bool // log every LLM call to llm_calls (LLM_AUDIT, default true)
+
+	// Prompt templates: PROMPT_DIR adds/overrides .tmpl files without a
+	// rebuild; PROMPT_SUMMARY / PROMPT_PROPOSE_OPS / PROMPT_CHAT / PROMPT_DIAGNOSE pick the versions in use
+	// (comma-separated to split fields between versions). Empty = latest.
+	// Versions older than summary/3, propose_ops/4, chat/2 and diagnose/2
+	// always answer in Thai, whatever the user's locale.
+	PromptDir      string
+	PromptVersions map[string][]string // kind -> versions
+	PromptTokens   int                 // context budget per prompt: field, stages, ops, KB (PROMPT_CONTEXT_TOKENS, default 3000)
+
+	// Measurement photos: uploads are stored in UPLOAD_DIR and served at
+	// /uploads. A diagnosis at or above DIAG_MIN_CONFIDENCE adds inspect or
+	// treatment tasks and feeds the next replan.
+	UploadDir         string
+	DiagMinConfidence float64
+
+	// Outbound calls (LLM providers, embeddings): transient failures are
+	// retried with backoff, and each target has a concurrency limit and a
+	// circuit breaker that opens after BREAKER_FAILURES failed requests in a
+	// row, failing fast for BREAKER_COOLDOWN.
+	OutboundAttempts    int           // OUTBOUND_ATTEMPTS, default 3 (1 = no retries)
+	OutboundConcurrency int           // OUTBOUND_CONCURRENCY, default 4 per target
+	BreakerFailures     int           // BREAKER_FAILURES, default 5
+	BreakerCooldown     time.Duration // BREAKER_COOLDOWN, default 30s
+}
+
+// LLMProvider mirrors ai.ProviderConfig.
+type LLMProvider struct {
+	Name       string
+	Kind       string // openai | azure | ollama | llamacpp | mock
+	Endpoint   string
+	APIKey     string
+	Model      string
+	APIVersion string
+
+	PriceIn, PriceOut float64 // USD per 1M prompt/completion tokens
+}
+
+// String prints the provider with its API key masked, for logs.
+func (p LLMProvider) String() string {
+	return fmt.Sprintf("{Name:%s Kind:%s Endpoint:%s APIKey:%s Model:%s APIVersion:%s PriceIn:%g PriceOut:%g}",
+		p.Name, p.Kind, p.Endpoint, redact(p.APIKey), p.Model, p.APIVersion, p.PriceIn, p.PriceOut)
+}
+
+// redact hides a secret but shows whether one is set.
+func redact(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "***"
 }
 
 func Load() AppConfig {
@@ -37,7 +113,104 @@ func Load() AppConfig {
 		LLMAPIKey:   get("LLM_API_KEY", ""),
 		LLMModel:    get("LLM_MODEL", "gpt-4o-mini"),
 		EnableLIFF:  get("ENABLE_LIFF", "false") == "true",
+		DriftWorker: get("DRIFT_WORKER", "true") == "true",
+	}
+	cfg.DriftHour, _ = strconv.Atoi(get("DRIFT_HOUR", "2"))
+	if cfg.DriftHour < 0 || cfg.DriftHour > 23 {
+		cfg.DriftHour = 2
+	}
+	dur := func(k string) time.Duration {
+		d, err := time.ParseDuration(get(k, "0"))
+		if err != nil || d < 0 {
+			log.Printf("[cfg] bad %s, using default", k)
+			return 0
+		}
+		return d
+	}
+	cfg.PlanTimeout, cfg.LLMTimeout, cfg.KBTimeout = dur("PLAN_TIMEOUT"), dur("LLM_TIMEOUT"), dur("KB_TIMEOUT")
+	ttl, err := time.ParseDuration(get("LLM_CACHE_TTL", "168h"))
+	if err != nil || ttl < 0 {
+		log.Printf("[cfg] bad LLM_CACHE_TTL, using 168h")
+		ttl = 168 * time.Hour
 	}
-	log.Printf("[cfg] %+v", cfg)
+	cfg.LLMCacheTTL = ttl
+	cfg.LLMCacheMaxEntries, _ = strconv.Atoi(get("LLM_CACHE_MAX_ENTRIES", "2000"))
+	cfg.LLMCacheMaxMB, _ = strconv.Atoi(get("LLM_CACHE_MAX_MB", "20"))
+	for _, uid := range strings.Split(get("REVIEWER_UIDS", ""), ",") {
+		if uid = strings.TrimSpace(uid); uid != "" {
+			cfg.Reviewers = append(cfg.Reviewers, uid)
+		}
+	}
+	for _, uid := range strings.Split(get("ADMIN_UIDS", ""), ",") {
+		if uid = strings.TrimSpace(uid); uid != "" {
+			cfg.Admins = append(cfg.Admins, uid)
+		}
+	}
+	if len(cfg.Admins) == 0 {
+		cfg.Admins = cfg.Reviewers
+	}
+	cfg.LLMAudit = get("LLM_AUDIT", "true") == "true"
+	cfg.LLMProviders = llmProviders(get, cfg)
+	cfg.UploadDir = get("UPLOAD_DIR", "uploads")
+	if cfg.DiagMinConfidence, err = strconv.ParseFloat(get("DIAG_MIN_CONFIDENCE", "0.7"), 64); err != nil || cfg.DiagMinConfidence < 0 || cfg.DiagMinConfidence > 1 {
+		log.Printf("[cfg] bad DIAG_MIN_CONFIDENCE, using 0.7")
+		cfg.DiagMinConfidence = 0.7
+	}
+	cfg.OutboundAttempts, _ = strconv.Atoi(get("OUTBOUND_ATTEMPTS", "3"))
+	cfg.OutboundConcurrency, _ = strconv.Atoi(get("OUTBOUND_CONCURRENCY", "4"))
+	cfg.BreakerFailures, _ = strconv.Atoi(get("BREAKER_FAILURES", "5"))
+	if cfg.BreakerCooldown, err = time.ParseDuration(get("BREAKER_COOLDOWN", "30s")); err != nil || cfg.BreakerCooldown <= 0 {
+		log.Printf("[cfg] bad BREAKER_COOLDOWN, using 30s")
+		cfg.BreakerCooldown = 30 * time.Second
+	}
+	cfg.PromptDir = get("PROMPT_DIR", "")
+	cfg.PromptTokens, _ = strconv.Atoi(get("PROMPT_CONTEXT_TOKENS", "3000"))
+	cfg.PromptVersions = map[string][]string{}
+	for kind, env := range map[string]string{"summary": "PROMPT_SUMMARY", "propose_ops": "PROMPT_PROPOSE_OPS", "chat": "PROMPT_CHAT", "diagnose": "PROMPT_DIAGNOSE"} {
+		for _, v := range strings.Split(get(env, ""), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				cfg.PromptVersions[kind] = append(cfg.PromptVersions[kind], v)
+			}
+		}
+	}
+	logged := cfg
+	logged.LLMAPIKey = redact(cfg.LLMAPIKey)
+	log.Printf("[cfg] %+v", logged) // providers print through LLMProvider.String
 	return cfg
 }
+
+func llmProviders(get func(k, def string) string, cfg AppConfig) []LLMProvider {
+	var out []LLMProvider
+	for _, name := range strings.Split(get("LLM_PROVIDERS", ""), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		env := "LLM_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_"
+		out = append(out, LLMProvider{
+			Name:       name,
+			Kind:       get(env+"KIND", name),
+			Endpoint:   get(env+"ENDPOINT", ""),
+			APIKey:     get(env+"API_KEY", ""),
+			Model:      get(env+"MODEL", cfg.LLMModel),
+			APIVersion: get(env+"API_VERSION", ""),
+			PriceIn:    price(get(env+"PRICE_IN", "0")),
+			PriceOut:   price(get(env+"PRICE_OUT", "0")),
+		})
+	}
+	if len(out) > 0 {
+		return out
+	}
+	if cfg.LLMEndpoint != "" && cfg.LLMAPIKey != "" {
+		return []LLMProvider{{Name: "openai", Kind: "openai", Endpoint: cfg.LLMEndpoint, APIKey: cfg.LLMAPIKey, Model: cfg.LLMModel}}
+	}
+	return []LLMProvider{{Name: "mock", Kind: "mock"}}
+}
+
+func price(v string) float64 {
+	p, err := strconv.ParseFloat(v, 64)
+	if err != nil || p < 0 {
+		log.Printf("[cfg] bad LLM price %q, using 0", v)
+		return 0
+	}
+	return p
+}
@@ -14,7 +14,8 @@ import (
 )
 
 func OpenSQLite(path string) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	// TranslateError maps UNIQUE violations to gorm.ErrDuplicatedKey (plan versions, idempotency keys)
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatalf("open sqlite: %v", err)
 	}
@@ -23,18 +24,40 @@ func OpenSQLite(path string) *gorm.DB {
 	if err := migrateReplanLogsAddPK(db); err != nil {
 		log.Fatalf("migrate: %v", err)
 	}
+	// and renumber duplicate plan versions BEFORE the unique (field_id, version) index is created
+	if err := migratePlansDedupVersions(db); err != nil {
+		log.Fatalf("migrate: %v", err)
+	}
 
 	// your other automigrates...
 	if err := db.AutoMigrate(
 		&entities.Field{},
 		&entities.Plan{},
 		&entities.ScheduleTask{},
+		&entities.Measurement{},
 		&entities.ReplanLog{}, // now safe: table already has PK
+		&entities.PlanCitation{},
+		&entities.PlanReview{},
+		&entities.IdempotencyKey{},
+		&entities.DriftRun{},
+		&entities.FieldDriftStatus{},
+		&entities.DriftAlert{},
+		&entities.CalendarToken{},
+		&entities.UserPref{},
 		&entities.KBDocument{},
 		&entities.KBChunk{},
+		&entities.LLMCacheEntry{},
+		&entities.LLMCall{},
+		&entities.ChatThread{},
+		&entities.ChatMessage{},
+		&entities.PhotoDiagnosis{},
 	); err != nil {
 		log.Fatalf("automigrate: %v", err)
 	}
+	// plans created before the approval workflow have no status yet
+	if err := backfillPlanStatus(db); err != nil {
+		log.Fatalf("migrate: %v", err)
+	}
 
 	return db
 }
@@ -140,3 +163,57 @@ SELECT %s, %s, %s, %s, %s, %s FROM replan_logs;
 		return nil
 	})
 }
+
+// migratePlansDedupVersions renumbers plan versions (1..n by plan_id) for every
+// field that has duplicate (field_id, version) rows, left over from before the
+// unique index existed.
+func migratePlansDedupVersions(db *gorm.DB) error {
+	var tbl string
+	if err := db.Raw(`SELECT name FROM sqlite_master WHERE type='table' AND name='plans'`).Scan(&tbl).Error; err != nil {
+		return fmt.Errorf("check table exist: %w", err)
+	}
+	if tbl == "" {
+		return nil
+	}
+
+	var fieldIDs []uint
+	if err := db.Raw(`SELECT DISTINCT field_id FROM plans GROUP BY field_id, version HAVING COUNT(*) > 1`).Scan(&fieldIDs).Error; err != nil {
+		return fmt.Errorf("find duplicate plan versions: %w", err)
+	}
+	if len(fieldIDs) == 0 {
+		return nil
+	}
+	log.Printf("[db] renumbering plan versions for %d field(s) with duplicates", len(fieldIDs))
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, fid := range fieldIDs {
+			var planIDs []uint
+			if err := tx.Raw(`SELECT plan_id FROM plans WHERE field_id = ? ORDER BY plan_id`, fid).Scan(&planIDs).Error; err != nil {
+				return err
+			}
+			for i, pid := range planIDs {
+				if err := tx.Exec(`UPDATE plans SET version = ? WHERE plan_id = ?`, i+1, pid).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// backfillPlanStatus marks legacy plans (empty status) as approved when they
+// are their field's latest version and superseded otherwise.
+func backfillPlanStatus(db *gorm.DB) error {
+	res := db.Exec(`
+UPDATE plans SET status = CASE
+	WHEN version = (SELECT MAX(p2.version) FROM plans p2 WHERE p2.field_id = plans.field_id) THEN 'approved'
+	ELSE 'superseded' END
+WHERE status IS NULL OR status = ''`)
+	if res.Error != nil {
+		return fmt.Errorf("backfill plan status: %w", res.Error)
+	}
+	if res.RowsAffected > 0 {
+		log.Printf("[db] set approval status on %d legacy plan(s)", res.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+package entities
+
+import "time"
+
+// CalendarToken is the per-user secret that authenticates iCalendar feed URLs
+// (phone calendar apps cannot send the LINE cookie).
+type CalendarToken struct {
+	UserID    string `gorm:"primaryKey" json:"user_id"`
+	Token     string `gorm:"uniqueIndex" json:"token"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
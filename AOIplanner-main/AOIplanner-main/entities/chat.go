@@ -0,0 +1,58 @@
+package entities
+
+import "time"
+
+// ChatThread is a farmer's conversation with the assistant about one field.
+type ChatThread struct {
+	ThreadID  uint      `gorm:"primaryKey" json:"thread_id"`
+	FieldID   uint      `gorm:"index" json:"field_id"`
+	UserID    string    `gorm:"index" json:"user_id"`
+	Title     string    `json:"title"` // start of the first question
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"` // last message
+}
+
+// ChatMessage is one turn of a thread. Assistant messages carry the KB
+// passages they cite and the tasks they propose.
+type ChatMessage struct {
+	MessageID uint           `gorm:"primaryKey" json:"message_id"`
+	ThreadID  uint           `gorm:"index" json:"thread_id"`
+	Role      string         `json:"role"` // user|assistant
+	Content   string         `json:"content"`
+	Citations []ChatCitation `gorm:"serializer:json" json:"citations,omitempty"`
+	Proposals []ChatProposal `gorm:"serializer:json" json:"proposals,omitempty"`
+	Provider  string         `json:"provider,omitempty"` // LLM provider that answered
+	Fallback  bool           `json:"fallback,omitempty"` // the model could not be reached; canned answer
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// ChatCitation is a KB passage an answer cites as [N].
+type ChatCitation struct {
+	N       int     `json:"n"`
+	DocID   uint    `json:"doc_id"`
+	ChunkID uint    `json:"chunk_id"`
+	Title   string  `json:"title"`
+	URL     string  `json:"url"`
+	Score   float64 `json:"score"`
+}
+
+// ChatProposal is a task the assistant suggested. Accepting it adds the task
+// to the field's schedule (with the usual edit checks).
+type ChatProposal struct {
+	N      int      `json:"n"` // 1-based within the message
+	Date   string   `json:"date"`
+	Type   string   `json:"type"`
+	Title  string   `json:"title"`
+	Qty    *float64 `json:"qty,omitempty"`
+	Unit   string   `json:"unit,omitempty"`
+	Notes  string   `json:"notes,omitempty"`
+	Status string   `json:"status"` // proposed|accepted|dismissed
+	TaskID *uint    `json:"task_id,omitempty"`
+}
+
+// Chat proposal statuses.
+const (
+	ProposalProposed  = "proposed"
+	ProposalAccepted  = "accepted"
+	ProposalDismissed = "dismissed"
+)
@@ -0,0 +1,24 @@
+package entities
+
+import (
+	"time"
+
+	"aoi/pkg/plan/types"
+)
+
+// PhotoDiagnosis is the vision model's reading of a measurement photo.
+type PhotoDiagnosis struct {
+	DiagnosisID uint           `gorm:"primaryKey" json:"diagnosis_id"`
+	MeasureID   uint           `gorm:"index" json:"measure_id"`
+	FieldID     uint           `gorm:"index" json:"field_id"`
+	PhotoURL    string         `json:"photo_url"`
+	Code        string         `gorm:"index" json:"code"` // problem catalogue code, healthy or unknown
+	Label       string         `json:"label"`             // label of the code, stored in Thai
+	Confidence  float64        `json:"confidence"`        // 0..1
+	Findings    string         `json:"findings"`
+	Actions     []types.PlanOp `gorm:"serializer:json" json:"actions"` // recommended, undated
+	Provider    string         `json:"provider,omitempty"`
+	Fallback    bool           `json:"fallback,omitempty"` // offline stub: the photo was not looked at
+	TaskIDs     []uint         `gorm:"serializer:json" json:"task_ids,omitempty"` // tasks added because of it
+	CreatedAt   time.Time      `json:"created_at"`
+}
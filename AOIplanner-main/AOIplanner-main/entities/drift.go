@@ -0,0 +1,51 @@
+package entities
+
+import (
+	"time"
+
+	"aoi/pkg/plan/types"
+)
+
+// DriftRun is one pass of the nightly drift worker over all active fields.
+type DriftRun struct {
+	RunID      uint       `gorm:"primaryKey" json:"run_id"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Fields     int        `json:"fields"`
+	NoDrift    int        `json:"no_drift"`
+	Replanned  int        `json:"replanned"`
+	Alerts     int        `json:"alerts"`
+	Errors     int        `json:"errors"`
+	Status     string     `json:"status"` // running|done|cancelled
+}
+
+// FieldDriftStatus keeps the last nightly outcome per field.
+type FieldDriftStatus struct {
+	FieldID   uint               `gorm:"primaryKey" json:"field_id"`
+	RunID     uint               `json:"run_id"`
+	PlanID    uint               `json:"plan_id"`
+	Outcome   string             `json:"outcome"` // no_drift|replanned|alert|error
+	Reason    string             `json:"reason"`
+	Drift     types.DriftMetrics `gorm:"serializer:json" json:"drift"`
+	CheckedAt time.Time          `json:"checked_at"`
+}
+
+// DriftAlert is raised instead of replanning when a field's policy is "alert".
+type DriftAlert struct {
+	AlertID   uint               `gorm:"primaryKey" json:"alert_id"`
+	FieldID   uint               `gorm:"index" json:"field_id"`
+	RunID     uint               `json:"run_id"`
+	PlanID    uint               `json:"plan_id"`
+	Reason    string             `json:"reason"`
+	Drift     types.DriftMetrics `gorm:"serializer:json" json:"drift"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+const (
+	DriftPolicyAutoReplan = "auto_replan"
+	DriftPolicyAlert      = "alert"
+	DriftPolicyOff        = "off"
+
+	DriftOutcomeAlert = "alert"
+	DriftOutcomeError = "error"
+)
@@ -16,6 +16,8 @@ type Field struct {
 	BudgetTier    string    `json:"budget_tier"`    // low|med|high
 	FertBase      string    `json:"fert_base"`      // organic|chemical|mixed
 	PlantingDate  time.Time `json:"planting_date"`
+	DriftPolicy   string    `json:"drift_policy"`   // auto_replan|alert|off (nightly drift worker; empty = alert)
+	RequireApproval bool    `json:"require_approval"` // new plan versions stay draft until a reviewer approves
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
@@ -0,0 +1,17 @@
+package entities
+
+import "time"
+
+// IdempotencyKey stores the first response for an Idempotency-Key header so
+// retried submissions get the same result instead of running again.
+type IdempotencyKey struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      string `gorm:"uniqueIndex:idx_idem_user_key"`
+	Key         string `gorm:"column:idem_key;uniqueIndex:idx_idem_user_key"`
+	Method      string
+	Path        string
+	StatusCode  int // 0 while the first request is still running
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
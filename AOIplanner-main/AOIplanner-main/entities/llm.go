@@ -0,0 +1,46 @@
+package entities
+
+import "time"
+
+// LLMCacheEntry is a stored model response. Key is a fingerprint of the
+// model, the prompt template version and the normalized prompt inputs, so
+// an unchanged field/plan reuses the earlier answer instead of calling out.
+type LLMCacheEntry struct {
+	Key       string    `gorm:"column:cache_key;primaryKey;size:64" json:"key"`
+	Kind      string    `gorm:"index" json:"kind"` // summary | propose_ops
+	Model     string    `json:"model"`
+	Provider  string    `json:"provider"` // provider that produced the response
+	FieldID   uint      `gorm:"index" json:"field_id"`
+	Response  string    `json:"-"`
+	Bytes     int       `json:"bytes"`
+	Hits      int       `json:"hits"`
+	CreatedAt time.Time `json:"created_at"`
+	UsedAt    time.Time `gorm:"index" json:"used_at"` // last store or hit; least recently used entries are evicted first
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+}
+
+// LLMCall is one audited ai.Client call: who it was for, which provider and
+// prompt served it, what it cost and how it ended. Prompt and response are
+// truncated; Truncated lists the context cut to fit the prompt token budget.
+type LLMCall struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	FieldID          uint      `gorm:"index" json:"field_id"`
+	PlanID           *uint     `gorm:"index" json:"plan_id,omitempty"` // linked once the plan is saved
+	Kind             string    `gorm:"index" json:"kind"`              // summary | summary_stream | propose_ops | chat | diagnose
+	Provider         string    `gorm:"index" json:"provider"`          // "cache:<name>" for cache hits, "" when none answered
+	Tried            []string  `gorm:"serializer:json" json:"tried,omitempty"`
+	Model            string    `json:"model"`
+	PromptVersion    string    `json:"prompt_version"`
+	PromptHash       string    `gorm:"index" json:"prompt_hash"`
+	Prompt           string    `json:"prompt"`
+	Response         string    `json:"response"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	CostUSD          float64   `json:"cost_usd"`
+	LatencyMS        int64     `json:"latency_ms"`
+	Error            string    `json:"error,omitempty"`
+	Truncated        []string  `gorm:"serializer:json" json:"truncated,omitempty"`
+	Fallback         bool      `json:"fallback"` // the caller got deterministic output instead
+	CacheHit         bool      `json:"cache_hit"`
+	CreatedAt        time.Time `gorm:"index" json:"created_at"`
+}
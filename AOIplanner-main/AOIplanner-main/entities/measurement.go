@@ -14,4 +14,7 @@ type Measurement struct {
 	Note         string    `json:"note"`
 	PhotoURL     string    `json:"photo_url"`
 	CreatedAt    time.Time
+
+	// Diagnosis of the photo, set when it was just diagnosed (not persisted).
+	Diagnosis *PhotoDiagnosis `gorm:"-" json:"diagnosis,omitempty"`
 }
\ No newline at end of file
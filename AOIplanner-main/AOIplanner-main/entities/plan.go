@@ -1,31 +1,110 @@
 package entities
 
-import "time"
+import (
+	"time"
+
+	"aoi/pkg/plan/types"
+)
 
 type Plan struct {
-	PlanID     uint      `gorm:"primaryKey" json:"plan_id"`
-	FieldID    uint      `json:"field_id" gorm:"index"`
-	Version    int       `json:"version"`
-	SummaryMD  string    `json:"summary_md"`
-	StagesJSON string    `json:"stages_json"`
+	PlanID     uint   `gorm:"primaryKey" json:"plan_id"`
+	FieldID    uint   `json:"field_id" gorm:"index;uniqueIndex:idx_plans_field_version"`
+	Version    int    `json:"version" gorm:"uniqueIndex:idx_plans_field_version"`
+	SummaryMD  string `json:"summary_md"`
+	// SummaryProvider is the LLM provider that wrote SummaryMD ("cache:<name>"
+	// when it came from the response cache); empty for the fallback summary.
+	SummaryProvider string `json:"summary_provider,omitempty"`
+	SummaryPrompt   string `json:"summary_prompt,omitempty"` // prompt template version, e.g. "summary/2"
+	StagesJSON string `json:"stages_json"`
 	CreatedAt  time.Time
+
+	// Approval lifecycle: draft → under_review → approved → superseded.
+	// Only the approved plan's tasks are shown on the farmer's schedule.
+	Status     string     `gorm:"index" json:"status"`
+	ApprovedBy string     `json:"approved_by,omitempty"`
+	ApprovedAt *time.Time `json:"approved_at,omitempty"`
+
+	// Citations are loaded from plan_citations when the plan is returned (not a column).
+	Citations []PlanCitation `gorm:"-" json:"citations,omitempty"`
+	// Partial lists the steps (kb, summary, propose_ops) that ran out of time or
+	// failed and fell back to deterministic output while building this response.
+	Partial []string `gorm:"-" json:"partial,omitempty"`
 }
 
+// Plan statuses.
+const (
+	PlanStatusDraft       = "draft"
+	PlanStatusUnderReview = "under_review"
+	PlanStatusApproved    = "approved"
+	PlanStatusSuperseded  = "superseded"
+)
+
+// Review actions recorded in plan_reviews.
+const (
+	ReviewActionSubmit         = "submit"
+	ReviewActionApprove        = "approve"
+	ReviewActionRequestChanges = "request_changes"
+	ReviewActionAutoApprove    = "auto_approve" // field does not require approval
+	ReviewActionSupersede      = "supersede"
+)
+
+// PlanReview is one status transition of a plan: who did it, when and why.
+type PlanReview struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	PlanID     uint      `gorm:"index" json:"plan_id"`
+	FieldID    uint      `gorm:"index" json:"field_id"`
+	Action     string    `json:"action"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	Actor      string    `json:"actor"` // user id, or "system"
+	Comment    string    `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// PlanCitation is a KB chunk that was retrieved while building a plan or a replan.
+type PlanCitation struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	PlanID      uint      `gorm:"index" json:"plan_id"`
+	ReplanLogID *uint     `gorm:"index" json:"replan_log_id,omitempty"` // nil for citations of the plan build itself
+	DocID       uint      `json:"doc_id"`
+	ChunkID     uint      `json:"chunk_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Score       float64   `json:"score"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReplanLog records every replan attempt, including ones where no drift was
+// found and the plan was kept as-is.
 type ReplanLog struct {
-	ID        uint      `gorm:"primaryKey"`
-	FieldID   uint
-	PlanID    uint
-	Reason    string
-	DeltaMD   string
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	FieldID    uint   `gorm:"index" json:"field_id"`
+	PlanID     uint   `json:"plan_id"`      // plan in effect after the replan
+	PrevPlanID uint   `json:"prev_plan_id"` // plan in effect before the replan
+	Outcome    string `json:"outcome"`      // replanned|no_drift
+	Reason     string `json:"reason"`       // drift reason from the rules engine
+	UserReason string `json:"user_reason,omitempty"`
+	DeltaMD    string `json:"delta_md"`
 	// NEW: persist UI-selected problems
-	Problems  []string  `gorm:"serializer:json" json:"problems,omitempty"`
-	CreatedAt time.Time
+	Problems     []string           `gorm:"serializer:json" json:"problems,omitempty"`      // labels (Thai) and free text
+	ProblemCodes []string           `gorm:"serializer:json" json:"problem_codes,omitempty"` // catalogue codes, see pkg/problem
+	Drift        types.DriftMetrics `gorm:"serializer:json" json:"drift"`
+	CreatedAt    time.Time          `json:"created_at"`
 
-	// NEW (not persisted): articles suggested by service for response payload
-	SuggestedArticles []ArticleRef `gorm:"-" json:"suggested_articles,omitempty"`
+	// articles and extra ops suggested by the service (KB + LLM/fallback)
+	SuggestedArticles []ArticleRef   `gorm:"serializer:json" json:"suggested_articles,omitempty"`
+	ProposedOps       []types.PlanOp `gorm:"serializer:json" json:"proposed_ops,omitempty"`
+	OpsSource         string         `json:"ops_source,omitempty"` // llm|fallback
+	OpsProvider       string         `json:"ops_provider,omitempty"` // LLM provider that proposed the ops (OpsSource llm)
+	OpsPrompt         string         `json:"ops_prompt,omitempty"`   // prompt template version used for them
 }
 
+const (
+	ReplanOutcomeReplanned = "replanned"
+	ReplanOutcomeNoDrift   = "no_drift"
+)
+
 type ArticleRef struct {
 	Title string `json:"title"`
 	URL   string `json:"url"`
-}
\ No newline at end of file
+}
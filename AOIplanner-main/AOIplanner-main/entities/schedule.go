@@ -1,6 +1,16 @@
 package entities
 
-import "time"
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TaskStatusDeleted marks a planner task the user removed. The row is kept so a
+// replan does not bring the task back; schedule listings skip it.
+const TaskStatusDeleted = "deleted"
 
 type ScheduleTask struct {
 	TaskID   uint      `gorm:"primaryKey" json:"task_id"`
@@ -12,7 +22,28 @@ type ScheduleTask struct {
 	Qty      *float64  `json:"qty"`
 	Unit     string    `json:"unit"`
 	Notes    string    `json:"notes"`
-	Status   string    `json:"status"` // todo|done|skipped
+	Status   string    `json:"status"` // todo|done|skipped (deleted: tombstone of a removed planner task)
+	Manual   bool      `json:"manual"`  // created or changed by the user; replans carry it over
+	OrigDate *time.Time `json:"orig_date,omitempty"` // planner's date before a manual edit (nil for user-created tasks)
+	MsgKey    string            `json:"msg_key,omitempty"` // catalogue message of Title/Notes (pkg/i18n); "" for user text
+	MsgParams map[string]string `gorm:"serializer:json" json:"msg_params,omitempty"`
+	UID       string            `json:"uid,omitempty"` // calendar identity; survives replans (see BeforeCreate)
 	CreatedAt time.Time
 	UpdatedAt time.Time
-}
\ No newline at end of file
+}
+
+// BeforeCreate gives a task without a UID a random one. Planner tasks are
+// stamped by the plan service from their place in the crop cycle, so a replan
+// regenerates the same UIDs; user tasks and edits carried over by a replan
+// keep theirs.
+func (t *ScheduleTask) BeforeCreate(*gorm.DB) error {
+	if t.UID != "" {
+		return nil
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	t.UID = "u-" + hex.EncodeToString(b)
+	return nil
+}
@@ -0,0 +1,11 @@
+package entities
+
+import "time"
+
+// UserPref holds per-user settings. Users are LINE ids with no table of their
+// own, so a row exists only once a setting has been changed.
+type UserPref struct {
+	UserID    string    `gorm:"primaryKey" json:"user_id"`
+	Locale    string    `json:"locale"` // th|en (pkg/i18n)
+	UpdatedAt time.Time `json:"updated_at"`
+}
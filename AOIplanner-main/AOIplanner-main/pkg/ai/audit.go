@@ -0,0 +1,218 @@
+// pkg/ai/audit.go
+
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"aoi/entities"
+	"aoi/pkg/plan/types"
+)
+
+// Audit call kinds (LLMCall.Kind).
+const (
+	CallSummary       = "summary"
+	CallSummaryStream = "summary_stream"
+	CallProposeOps    = "propose_ops"
+	CallChat          = "chat"
+	CallDiagnose      = "diagnose"
+)
+
+// maxAuditText bounds the prompt and response kept per call, in runes.
+const maxAuditText = 4000
+
+// Price is a provider's token price in USD per million tokens.
+type Price struct{ In, Out float64 }
+
+// Audit wraps a Client and writes one llm_calls row per call, with the
+// provider, prompt, token usage and latency recorded in CallInfo by the
+// layers below. It goes outermost so cache hits are logged too.
+type Audit struct {
+	inner  Client
+	db     *gorm.DB
+	prices map[string]Price // by provider name
+}
+
+var _ Client = (*Audit)(nil)
+
+func NewAudited(inner Client, db *gorm.DB, prices map[string]Price) *Audit {
+	return &Audit{inner: inner, db: db, prices: prices}
+}
+
+func (a *Audit) SummarizePlan(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) (string, error) {
+	ctx, ci := callInfo(ctx)
+	start := time.Now()
+	out, err := a.inner.SummarizePlan(ctx, f, stages, ops, kbCtx)
+	a.record(ctx, ci, CallSummary, f, start, out, err)
+	return out, err
+}
+
+func (a *Audit) StreamSummary(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string, onDelta func(string)) (string, error) {
+	ctx, ci := callInfo(ctx)
+	start := time.Now()
+	out, err := a.inner.StreamSummary(ctx, f, stages, ops, kbCtx, onDelta)
+	a.record(ctx, ci, CallSummaryStream, f, start, out, err)
+	return out, err
+}
+
+func (a *Audit) ProposeOps(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error) {
+	ctx, ci := callInfo(ctx)
+	start := time.Now()
+	out, err := a.inner.ProposeOps(ctx, f, stages, ops, problems, kbCtx)
+	var resp string
+	if err == nil {
+		b, _ := json.Marshal(out)
+		resp = string(b)
+	}
+	a.record(ctx, ci, CallProposeOps, f, start, resp, err)
+	return out, err
+}
+
+func (a *Audit) Chat(ctx context.Context, req ChatRequest) (ChatReply, error) {
+	ctx, ci := callInfo(ctx)
+	start := time.Now()
+	out, err := a.inner.Chat(ctx, req)
+	a.record(ctx, ci, CallChat, req.Field, start, out.Answer, err)
+	return out, err
+}
+
+func (a *Audit) Diagnose(ctx context.Context, req DiagnoseRequest) (Diagnosis, error) {
+	ctx, ci := callInfo(ctx)
+	start := time.Now()
+	out, err := a.inner.Diagnose(ctx, req)
+	a.record(ctx, ci, CallDiagnose, req.Field, start, fmt.Sprintf("%s %.2f", out.Code, out.Confidence), err)
+	return out, err
+}
+
+// record writes the audit row; result is what the caller got back, used as
+// the response when no raw model reply was seen (cache hits).
+func (a *Audit) record(ctx context.Context, ci *CallInfo, kind string, f *entities.Field, start time.Time, result string, err error) {
+	c := entities.LLMCall{
+		PlanID:           ci.PlanID,
+		Kind:             kind,
+		Provider:         ci.Provider,
+		Tried:            ci.Tried,
+		Model:            ci.Model,
+		PromptVersion:    ci.Prompt,
+		PromptHash:       ci.PromptHash,
+		Prompt:           truncate(ci.Request, maxAuditText),
+		Response:         truncate(ci.Response, maxAuditText),
+		PromptTokens:     ci.PromptTokens,
+		CompletionTokens: ci.CompletionTokens,
+		LatencyMS:        time.Since(start).Milliseconds(),
+		Truncated:        ci.Truncated,
+		Fallback:         err != nil,
+		CacheHit:         strings.HasPrefix(ci.Provider, "cache:"),
+		CreatedAt:        time.Now().UTC(), // UTC so Daily's days are UTC days
+	}
+	if f != nil {
+		c.FieldID = f.FieldID
+	}
+	if c.Response == "" && err == nil {
+		c.Response = truncate(result, maxAuditText)
+	}
+	if err != nil {
+		c.Error = err.Error()
+	}
+	if p, ok := a.prices[ci.Provider]; ok {
+		c.CostUSD = (float64(c.PromptTokens)*p.In + float64(c.CompletionTokens)*p.Out) / 1e6
+	}
+	// logged even when the request was cancelled mid-call
+	if err := a.db.WithContext(context.WithoutCancel(ctx)).Create(&c).Error; err != nil {
+		log.Printf("[llm-audit] %v", err)
+		return
+	}
+	ci.CallID = c.ID
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n]) + "…"
+}
+
+// CallFilter selects audit rows; zero values do not filter.
+type CallFilter struct {
+	FieldID  uint
+	PlanID   uint
+	Kind     string
+	Provider string
+	From, To time.Time // To is exclusive
+	Errors   bool      // only calls that failed
+	Limit    int
+	Offset   int
+}
+
+// CallDay aggregates one day's calls per kind and provider.
+type CallDay struct {
+	Day              string  `json:"day"` // YYYY-MM-DD, UTC
+	Kind             string  `json:"kind"`
+	Provider         string  `json:"provider"`
+	Calls            int64   `json:"calls"`
+	Errors           int64   `json:"errors"`
+	CacheHits        int64   `json:"cache_hits"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+	AvgLatencyMS     float64 `json:"avg_latency_ms"`
+}
+
+func (a *Audit) scope(ctx context.Context, f CallFilter) *gorm.DB {
+	q := a.db.WithContext(ctx).Model(&entities.LLMCall{})
+	if f.FieldID > 0 {
+		q = q.Where("field_id = ?", f.FieldID)
+	}
+	if f.PlanID > 0 {
+		q = q.Where("plan_id = ?", f.PlanID)
+	}
+	if f.Kind != "" {
+		q = q.Where("kind = ?", f.Kind)
+	}
+	if f.Provider != "" {
+		q = q.Where("provider = ?", f.Provider)
+	}
+	if !f.From.IsZero() {
+		q = q.Where("created_at >= ?", f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		q = q.Where("created_at < ?", f.To.UTC())
+	}
+	if f.Errors {
+		q = q.Where("error <> ''")
+	}
+	return q
+}
+
+// Calls returns the matching rows, newest first, and their total count.
+func (a *Audit) Calls(ctx context.Context, f CallFilter) ([]entities.LLMCall, int64, error) {
+	var n int64
+	if err := a.scope(ctx, f).Count(&n).Error; err != nil {
+		return nil, 0, err
+	}
+	var out []entities.LLMCall
+	err := a.scope(ctx, f).Order("created_at DESC, id DESC").Limit(f.Limit).Offset(f.Offset).Find(&out).Error
+	return out, n, err
+}
+
+// Daily sums the matching calls per UTC day, kind and provider.
+func (a *Audit) Daily(ctx context.Context, f CallFilter) ([]CallDay, error) {
+	var out []CallDay
+	err := a.scope(ctx, f).Select(`substr(created_at, 1, 10) AS day, kind, provider,
+		COUNT(*) AS calls,
+		SUM(CASE WHEN error <> '' THEN 1 ELSE 0 END) AS errors,
+		SUM(CASE WHEN cache_hit THEN 1 ELSE 0 END) AS cache_hits,
+		SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens,
+		SUM(cost_usd) AS cost_usd, AVG(latency_ms) AS avg_latency_ms`).
+		Group("day, kind, provider").Order("day DESC, kind, provider").Scan(&out).Error
+	return out, err
+}
@@ -0,0 +1,243 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aoi/entities"
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+)
+
+// Cache kinds, one per Client method.
+const (
+	CacheKindSummary    = "summary"
+	CacheKindProposeOps = "propose_ops"
+)
+
+// CacheOptions bound the response cache. A zero MaxEntries or MaxBytes means
+// no limit of that kind.
+type CacheOptions struct {
+	TTL        time.Duration
+	MaxEntries int
+	MaxBytes   int64
+}
+
+// CacheStats are the cache counters since start plus what is stored now.
+type CacheStats struct {
+	Enabled   bool                      `json:"enabled"`
+	Kinds     map[string]CacheKindStats `json:"kinds"`
+	Evictions int64                     `json:"evictions"`
+	Entries   int64                     `json:"entries"`
+	Bytes     int64                     `json:"bytes"`
+	TTLSec    int                       `json:"ttl_sec"`
+}
+
+type CacheKindStats struct {
+	Hits    int64   `json:"hits"`
+	Misses  int64   `json:"misses"`
+	HitRate float64 `json:"hit_rate"`
+}
+
+type kindCounters struct{ hits, misses atomic.Int64 }
+
+// Cache wraps a Client and keeps successful responses in SQLite. Fallback
+// answers (any call that returned an error) are never stored. A hit is
+// reported in CallInfo as "cache:<provider that produced it>".
+type Cache struct {
+	inner Client
+	db    *gorm.DB
+	model string
+	opts  CacheOptions
+
+	counters  map[string]*kindCounters
+	evictions atomic.Int64
+}
+
+var _ Client = (*Cache)(nil)
+
+func NewCached(inner Client, db *gorm.DB, model string, opts CacheOptions) *Cache {
+	return &Cache{inner: inner, db: db, model: model, opts: opts, counters: map[string]*kindCounters{
+		CacheKindSummary:    {},
+		CacheKindProposeOps: {},
+	}}
+}
+
+func (c *Cache) SummarizePlan(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) (string, error) {
+	ctx, ci := callInfo(ctx)
+	pt := pickPrompt(PromptSummary, f)
+	key := c.fingerprint(CacheKindSummary, pt, i18n.FromContext(ctx), f, stages, ops, nil, kbCtx)
+	if resp, ok := c.get(ctx, ci, CacheKindSummary, key); ok {
+		ci.Prompt = pt.id
+		return resp, nil
+	}
+	out, err := c.inner.SummarizePlan(ctx, f, stages, ops, kbCtx)
+	if err == nil {
+		c.put(ctx, CacheKindSummary, key, f.FieldID, ci.Provider, out)
+	}
+	return out, err
+}
+
+// StreamSummary replays a cached summary as a single delta; a miss streams
+// from the wrapped client and stores the completed text.
+func (c *Cache) StreamSummary(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string, onDelta func(string)) (string, error) {
+	ctx, ci := callInfo(ctx)
+	pt := pickPrompt(PromptSummary, f)
+	key := c.fingerprint(CacheKindSummary, pt, i18n.FromContext(ctx), f, stages, ops, nil, kbCtx)
+	if resp, ok := c.get(ctx, ci, CacheKindSummary, key); ok {
+		ci.Prompt = pt.id
+		onDelta(resp)
+		return resp, nil
+	}
+	out, err := c.inner.StreamSummary(ctx, f, stages, ops, kbCtx, onDelta)
+	if err == nil {
+		c.put(ctx, CacheKindSummary, key, f.FieldID, ci.Provider, out)
+	}
+	return out, err
+}
+
+func (c *Cache) ProposeOps(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error) {
+	ctx, ci := callInfo(ctx)
+	pt := pickPrompt(PromptProposeOps, f)
+	key := c.fingerprint(CacheKindProposeOps, pt, i18n.FromContext(ctx), f, stages, ops, problems, kbCtx)
+	if resp, ok := c.get(ctx, ci, CacheKindProposeOps, key); ok {
+		var cached []types.PlanOp
+		if json.Unmarshal([]byte(resp), &cached) == nil {
+			ci.Prompt = pt.id
+			return cached, nil
+		}
+	}
+	out, err := c.inner.ProposeOps(ctx, f, stages, ops, problems, kbCtx)
+	if err == nil {
+		b, _ := json.Marshal(out)
+		c.put(ctx, CacheKindProposeOps, key, f.FieldID, ci.Provider, string(b))
+	}
+	return out, err
+}
+
+// Chat is not cached: every turn depends on the conversation so far.
+func (c *Cache) Chat(ctx context.Context, req ChatRequest) (ChatReply, error) {
+	return c.inner.Chat(ctx, req)
+}
+
+// Diagnose is not cached: photos are rarely sent twice.
+func (c *Cache) Diagnose(ctx context.Context, req DiagnoseRequest) (Diagnosis, error) {
+	return c.inner.Diagnose(ctx, req)
+}
+
+// InvalidateField drops every cached response built for a field.
+func (c *Cache) InvalidateField(ctx context.Context, fieldID uint) (int64, error) {
+	res := c.db.WithContext(ctx).Where("field_id = ?", fieldID).Delete(&entities.LLMCacheEntry{})
+	return res.RowsAffected, res.Error
+}
+
+func (c *Cache) Stats(ctx context.Context) (CacheStats, error) {
+	st := CacheStats{Enabled: true, Kinds: map[string]CacheKindStats{}, Evictions: c.evictions.Load(), TTLSec: int(c.opts.TTL.Seconds())}
+	for kind, k := range c.counters {
+		ks := CacheKindStats{Hits: k.hits.Load(), Misses: k.misses.Load()}
+		if n := ks.Hits + ks.Misses; n > 0 {
+			ks.HitRate = float64(ks.Hits) / float64(n)
+		}
+		st.Kinds[kind] = ks
+	}
+	var agg struct{ N, B int64 }
+	err := c.db.WithContext(ctx).Model(&entities.LLMCacheEntry{}).
+		Where("expires_at > ?", time.Now()).
+		Select("COUNT(*) AS n, COALESCE(SUM(bytes), 0) AS b").Scan(&agg).Error
+	st.Entries, st.Bytes = agg.N, agg.B
+	return st, err
+}
+
+// fingerprint hashes the model, the prompt template (version and source
+// digest, so an edited template misses), the answer's locale and the prompt
+// inputs in a
+// normalized form: JSON rather than the rendered text, and without the
+// field's bookkeeping timestamps.
+func (c *Cache) fingerprint(kind string, p *promptTmpl, loc string, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) string {
+	nf := *f
+	nf.CreatedAt, nf.UpdatedAt = time.Time{}, time.Time{}
+	b, _ := json.Marshal(struct {
+		Model, Kind, Version string
+		Locale               string
+		Field                entities.Field
+		Stages               []types.StagePlan
+		Ops                  []types.PlanOp
+		Problems             []string
+		KB                   string
+	}{c.model, kind, p.id + "@" + p.digest, loc, nf, stages, ops, problems, kbCtx})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *Cache) get(ctx context.Context, ci *CallInfo, kind, key string) (string, bool) {
+	var e entities.LLMCacheEntry
+	err := c.db.WithContext(ctx).Where("cache_key = ? AND expires_at > ?", key, time.Now()).First(&e).Error
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("[llm-cache] get: %v", err)
+		}
+		c.counters[kind].misses.Add(1)
+		return "", false
+	}
+	c.counters[kind].hits.Add(1)
+	ci.Provider = "cache:" + e.Provider
+	c.db.WithContext(ctx).Model(&e).Updates(map[string]any{"hits": gorm.Expr("hits + 1"), "used_at": time.Now()})
+	return e.Response, true
+}
+
+func (c *Cache) put(ctx context.Context, kind, key string, fieldID uint, provider, resp string) {
+	if c.opts.MaxBytes > 0 && int64(len(resp)) > c.opts.MaxBytes {
+		return
+	}
+	now := time.Now()
+	e := entities.LLMCacheEntry{
+		Key: key, Kind: kind, Model: c.model, Provider: provider, FieldID: fieldID,
+		Response: resp, Bytes: len(resp), CreatedAt: now, UsedAt: now, ExpiresAt: now.Add(c.opts.TTL),
+	}
+	// the response is kept even if the request is cancelled right after the call
+	db := c.db.WithContext(context.WithoutCancel(ctx))
+	if err := db.Clauses(clause.OnConflict{UpdateAll: true}).Create(&e).Error; err != nil {
+		log.Printf("[llm-cache] put: %v", err)
+		return
+	}
+	c.evict(db)
+}
+
+// evict removes expired entries, then the least recently used ones until the
+// cache fits MaxEntries and MaxBytes.
+func (c *Cache) evict(db *gorm.DB) {
+	res := db.Where("expires_at <= ?", time.Now()).Delete(&entities.LLMCacheEntry{})
+	c.evictions.Add(res.RowsAffected)
+	if c.opts.MaxEntries <= 0 && c.opts.MaxBytes <= 0 {
+		return
+	}
+	var rows []struct {
+		Key   string
+		Bytes int64
+	}
+	if err := db.Model(&entities.LLMCacheEntry{}).Select("cache_key AS key, bytes").Order("used_at DESC").Scan(&rows).Error; err != nil {
+		log.Printf("[llm-cache] evict: %v", err)
+		return
+	}
+	var total int64
+	var drop []string
+	for i, r := range rows {
+		total += r.Bytes
+		if (c.opts.MaxEntries > 0 && i >= c.opts.MaxEntries) || (c.opts.MaxBytes > 0 && total > c.opts.MaxBytes) {
+			drop = append(drop, r.Key)
+		}
+	}
+	if len(drop) > 0 {
+		res := db.Where("cache_key IN ?", drop).Delete(&entities.LLMCacheEntry{})
+		c.evictions.Add(res.RowsAffected)
+	}
+}
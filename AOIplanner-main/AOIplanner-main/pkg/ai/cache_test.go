@@ -0,0 +1,141 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aoi/database"
+	"aoi/entities"
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+)
+
+// countingClient answers summaries with the field's variety, or fails.
+type countingClient struct {
+	Client
+	calls int
+	fail  bool
+}
+
+func (c *countingClient) SummarizePlan(ctx context.Context, f *entities.Field, _ []types.StagePlan, _ []types.PlanOp, _ string) (string, error) {
+	c.calls++
+	if c.fail {
+		return "fallback", errors.New("provider down")
+	}
+	return "summary of " + f.Variety, nil
+}
+
+func newTestCache(t *testing.T, opts CacheOptions) (*Cache, *countingClient) {
+	t.Helper()
+	db := database.OpenSQLite(filepath.Join(t.TempDir(), "aoi.db"))
+	inner := &countingClient{}
+	return NewCached(inner, db, "test-model", opts), inner
+}
+
+func TestCacheKey(t *testing.T) {
+	c, inner := newTestCache(t, CacheOptions{TTL: time.Hour})
+	ctx := context.Background()
+	f := &entities.Field{FieldID: 1, Variety: "KK3"}
+	ops := []types.PlanOp{{Date: "2026-06-01", Type: "irrigation", Title: "w"}}
+
+	summarize := func(ctx context.Context, f *entities.Field, ops []types.PlanOp) string {
+		t.Helper()
+		out, err := c.SummarizePlan(ctx, f, nil, ops, "kb")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+	first := summarize(ctx, f, ops)
+	touched := *f
+	touched.UpdatedAt = time.Now() // bookkeeping only
+	if got := summarize(ctx, &touched, ops); got != first || inner.calls != 1 {
+		t.Errorf("same inputs: %q after %d calls, want a hit", got, inner.calls)
+	}
+
+	other := append([]types.PlanOp(nil), ops...)
+	other[0].Date = "2026-06-02"
+	summarize(ctx, f, other)
+	summarize(i18n.WithLocale(ctx, i18n.EN), f, ops)
+	renamed := *f
+	renamed.Variety = "LK92-11"
+	summarize(ctx, &renamed, ops)
+	if inner.calls != 4 {
+		t.Errorf("changed ops, locale and field must miss: %d calls, want 4", inner.calls)
+	}
+
+	st, err := c.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := st.Kinds[CacheKindSummary]; s.Hits != 1 || s.Misses != 4 || st.Entries != 4 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestCacheSkipsErrors(t *testing.T) {
+	c, inner := newTestCache(t, CacheOptions{TTL: time.Hour})
+	inner.fail = true
+	f := &entities.Field{FieldID: 1}
+	for i := 0; i < 2; i++ {
+		if _, err := c.SummarizePlan(context.Background(), f, nil, nil, ""); err == nil {
+			t.Fatal("want the provider error")
+		}
+	}
+	if inner.calls != 2 {
+		t.Errorf("a fallback answer was cached: %d calls", inner.calls)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c, inner := newTestCache(t, CacheOptions{TTL: time.Hour, MaxEntries: 2})
+	ctx := context.Background()
+	field := func(v string) *entities.Field { return &entities.Field{FieldID: 1, Variety: v} }
+	summarize := func(v string) {
+		t.Helper()
+		if _, err := c.SummarizePlan(ctx, field(v), nil, nil, ""); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond) // distinct used_at
+	}
+
+	summarize("a")
+	summarize("b")
+	summarize("a") // hit: a is now the most recently used
+	summarize("c") // over MaxEntries: b goes
+	if inner.calls != 3 {
+		t.Fatalf("%d calls, want 3", inner.calls)
+	}
+	summarize("a")
+	summarize("b")
+	if inner.calls != 4 {
+		t.Errorf("want a kept and b evicted: %d calls, want 4", inner.calls)
+	}
+	if st, _ := c.Stats(ctx); st.Evictions < 2 || st.Entries != 2 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c, inner := newTestCache(t, CacheOptions{TTL: time.Hour})
+	ctx := context.Background()
+	f := &entities.Field{FieldID: 1}
+	c.SummarizePlan(ctx, f, nil, nil, "")
+	c.db.Model(&entities.LLMCacheEntry{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Second))
+	c.SummarizePlan(ctx, f, nil, nil, "")
+	if inner.calls != 2 {
+		t.Errorf("expired entry served: %d calls", inner.calls)
+	}
+
+	n, err := c.InvalidateField(ctx, 1)
+	if err != nil || n != 1 {
+		t.Errorf("invalidate: %d, %v", n, err)
+	}
+	c.SummarizePlan(ctx, f, nil, nil, "")
+	if inner.calls != 3 {
+		t.Errorf("invalidated entry served: %d calls", inner.calls)
+	}
+}
@@ -0,0 +1,224 @@
+// pkg/ai/chain.go
+
+package ai
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/outbound"
+	"aoi/pkg/plan/types"
+)
+
+// Chain is a Client that tries its providers in order and returns the first
+// success. A provider whose outbound breaker is open is skipped, unless every
+// provider's is, in which case all are tried anyway.
+type Chain struct {
+	members []*member
+}
+
+var _ Client = (*Chain)(nil)
+
+type member struct {
+	cfg    ProviderConfig
+	client Client
+
+	mu          sync.Mutex
+	lastFail    time.Time
+	lastOK      time.Time
+	served      int64
+	failedTotal int64
+}
+
+// ProviderHealth is a provider's state as shown by GET /llm/providers. The
+// breaker fields come from the provider's outbound target, the same state
+// /health reports; providers that make no HTTP calls are always healthy.
+type ProviderHealth struct {
+	Name                string     `json:"name"`
+	Kind                string     `json:"kind"`
+	Model               string     `json:"model,omitempty"`
+	Healthy             bool       `json:"healthy"`
+	Breaker             string     `json:"breaker,omitempty"` // closed | open | half_open
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DownUntil           *time.Time `json:"down_until,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailure         *time.Time `json:"last_failure,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	Served              int64      `json:"served"`
+	Failed              int64      `json:"failed"`
+}
+
+// NewChain builds the providers in order; names must be unique.
+func NewChain(cfgs []ProviderConfig) (*Chain, error) {
+	if len(cfgs) == 0 {
+		return nil, fmt.Errorf("no llm providers configured")
+	}
+	ch := &Chain{}
+	seen := map[string]bool{}
+	for _, pc := range cfgs {
+		if seen[pc.Name] {
+			return nil, fmt.Errorf("llm provider %q configured twice", pc.Name)
+		}
+		seen[pc.Name] = true
+		c, err := NewProvider(pc)
+		if err != nil {
+			return nil, err
+		}
+		ch.members = append(ch.members, &member{cfg: pc, client: c})
+	}
+	return ch, nil
+}
+
+// Signature identifies the configured chain (kinds and models in order); it
+// is what response cache keys are built from.
+func (ch *Chain) Signature() string {
+	parts := make([]string, len(ch.members))
+	for i, m := range ch.members {
+		parts[i] = m.cfg.Kind + ":" + m.cfg.Model
+	}
+	return strings.Join(parts, ",")
+}
+
+func (ch *Chain) Health() []ProviderHealth {
+	out := make([]ProviderHealth, 0, len(ch.members))
+	for _, m := range ch.members {
+		h := ProviderHealth{Name: m.cfg.Name, Kind: m.cfg.Kind, Model: m.cfg.Model, Healthy: true}
+		if st, ok := m.breaker(); ok {
+			h.Healthy = st.State != outbound.StateOpen
+			h.Breaker, h.ConsecutiveFailures, h.LastError = st.State, st.ConsecutiveFailures, st.LastError
+			h.DownUntil = st.OpenUntil
+		}
+		m.mu.Lock()
+		h.Served, h.Failed = m.served, m.failedTotal
+		if !m.lastFail.IsZero() {
+			t := m.lastFail
+			h.LastFailure = &t
+		}
+		if !m.lastOK.IsZero() {
+			t := m.lastOK
+			h.LastSuccess = &t
+		}
+		m.mu.Unlock()
+		out = append(out, h)
+	}
+	return out
+}
+
+// breaker is the provider's outbound breaker state; false until the
+// provider has a target, and for providers that never call out.
+func (m *member) breaker() (outbound.State, bool) {
+	return outbound.StateOf(outboundTarget(m.cfg.Name))
+}
+
+// order returns the providers to try: those whose breaker is not open, in
+// configured order, or all of them when every breaker is open.
+func (ch *Chain) order() []*member {
+	var up []*member
+	for _, m := range ch.members {
+		if st, ok := m.breaker(); !ok || st.State != outbound.StateOpen {
+			up = append(up, m)
+		}
+	}
+	if len(up) == 0 {
+		return ch.members
+	}
+	return up
+}
+
+func (m *member) ok() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastOK = time.Now()
+	m.served++
+}
+
+func (m *member) fail() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failedTotal++
+	m.lastFail = time.Now()
+}
+
+// try runs call against each provider in turn until one succeeds. A failure
+// caused by the caller's context ending is not held against the provider and
+// stops the failover; so does a call for which retry reports false.
+func try[T any](ctx context.Context, ch *Chain, call func(context.Context, Client) (T, error), retry func() bool) (T, error) {
+	ctx, ci := callInfo(ctx)
+	var out T
+	var err error
+	for _, m := range ch.order() {
+		if ctx.Err() != nil {
+			break
+		}
+		out, err = call(ctx, m.client)
+		if err == nil {
+			m.ok()
+			ci.Provider = m.cfg.Name
+			return out, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		m.fail()
+		ci.Tried = append(ci.Tried, m.cfg.Name)
+		log.Printf("[llm] provider %s failed: %v", m.cfg.Name, err)
+		if !retry() {
+			break
+		}
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return out, err
+}
+
+func always() bool { return true }
+
+func (ch *Chain) SummarizePlan(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) (string, error) {
+	out, err := try(ctx, ch, func(ctx context.Context, c Client) (string, error) {
+		return c.SummarizePlan(ctx, f, stages, ops, kbCtx)
+	}, always)
+	if err != nil && out == "" {
+		out = fallbackSummary(ctx, f, stages, ops, kbCtx)
+	}
+	return out, err
+}
+
+// StreamSummary fails over only while nothing has been streamed yet; once a
+// provider has sent text, switching would garble the reply.
+func (ch *Chain) StreamSummary(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string, onDelta func(string)) (string, error) {
+	sent := false
+	out, err := try(ctx, ch, func(ctx context.Context, c Client) (string, error) {
+		return c.StreamSummary(ctx, f, stages, ops, kbCtx, func(d string) {
+			sent = true
+			onDelta(d)
+		})
+	}, func() bool { return !sent })
+	if err != nil && out == "" {
+		out = fallbackSummary(ctx, f, stages, ops, kbCtx)
+	}
+	return out, err
+}
+
+func (ch *Chain) ProposeOps(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error) {
+	return try(ctx, ch, func(ctx context.Context, c Client) ([]types.PlanOp, error) {
+		return c.ProposeOps(ctx, f, stages, ops, problems, kbCtx)
+	}, always)
+}
+
+func (ch *Chain) Chat(ctx context.Context, req ChatRequest) (ChatReply, error) {
+	return try(ctx, ch, func(ctx context.Context, c Client) (ChatReply, error) {
+		return c.Chat(ctx, req)
+	}, always)
+}
+
+func (ch *Chain) Diagnose(ctx context.Context, req DiagnoseRequest) (Diagnosis, error) {
+	return try(ctx, ch, func(ctx context.Context, c Client) (Diagnosis, error) {
+		return c.Diagnose(ctx, req)
+	}, always)
+}
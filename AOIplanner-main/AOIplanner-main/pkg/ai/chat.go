@@ -0,0 +1,179 @@
+// pkg/ai/chat.go
+
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/plan/types"
+)
+
+// ChatTurn is an earlier message of the conversation.
+type ChatTurn struct {
+	Role    string // user | assistant
+	Content string
+}
+
+// ChatSource is a KB passage the answer may cite as [N].
+type ChatSource struct {
+	N     int
+	Title string
+	Text  string
+}
+
+// ChatRequest is one question about a field, with what the assistant should
+// know about it.
+type ChatRequest struct {
+	Field        *entities.Field
+	Today        string // YYYY-MM-DD in the field's timezone
+	Stage        *types.StagePlan
+	Measurements []entities.Measurement // recent, oldest first
+	Tasks        []types.PlanOp         // upcoming schedule
+	Sources      []ChatSource
+	History      []ChatTurn
+	Question     string
+}
+
+// ChatReply is the assistant's answer. Cites are the Sources it used; Tasks
+// are proposals the user may add to the schedule (validated, dated today or
+// later).
+type ChatReply struct {
+	Answer string
+	Cites  []int
+	Tasks  []types.PlanOp
+}
+
+// maxChatTasks bounds the tasks proposed in one answer.
+const maxChatTasks = 3
+
+func chatSchema() map[string]any {
+	s := proposeOpsSchema()
+	item := s["properties"].(map[string]any)["actions"].(map[string]any)["items"].(map[string]any)
+	item["required"] = []string{"type", "title", "date", "qty", "unit", "notes"}
+	item["properties"].(map[string]any)["date"] = map[string]any{"type": "string"}
+	return map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"answer", "cites", "tasks"},
+		"properties": map[string]any{
+			"answer": map[string]any{"type": "string"},
+			"cites":  map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+			"tasks":  map[string]any{"type": "array", "maxItems": maxChatTasks, "items": item},
+		},
+	}
+}
+
+func (c *chatClient) Chat(ctx context.Context, req ChatRequest) (ChatReply, error) {
+	prompt, err := renderPrompt(ctx, PromptChat, promptData{
+		Field: req.Field, Stages: stageList(req.Stage), Ops: req.Tasks, KB: "",
+		Today: req.Today, Measurements: req.Measurements, Sources: req.Sources, Question: req.Question,
+		MaxActions: maxChatTasks, MaxTitleLen: maxTitleLen,
+	})
+	if err != nil {
+		return ChatReply{}, err
+	}
+	msgs := []chatMsg{{Role: "system", Content: "You are a Thai sugarcane agronomist advising a farmer about their own field. Reply ONLY valid JSON."}}
+	for _, t := range req.History {
+		msgs = append(msgs, chatMsg{Role: t.Role, Content: t.Content})
+	}
+	msgs = append(msgs, chatMsg{Role: "user", Content: prompt})
+	noteRequest(ctx, msgs)
+
+	var content string
+	for {
+		var schema *outputSchema
+		if c.schema.Load() != schemaUnsupported {
+			schema = &outputSchema{Name: "field_chat", Schema: chatSchema()}
+		}
+		content, err = c.api.chat(ctx, msgs, schema)
+		if schema != nil && unsupportedFormat(err) {
+			log.Printf("[llm] endpoint rejects structured output, using plain JSON: %v", err)
+			c.schema.Store(schemaUnsupported)
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return ChatReply{}, err
+	}
+	noteResponse(ctx, content)
+	return parseChatReply(req, content)
+}
+
+func stageList(st *types.StagePlan) []types.StagePlan {
+	if st == nil {
+		return nil
+	}
+	return []types.StagePlan{*st}
+}
+
+var citeRef = regexp.MustCompile(`\[(\d+)\]`)
+
+// parseChatReply reads the JSON reply; a reply that is not JSON is taken as
+// a plain answer. Cites outside Sources and invalid or past tasks are dropped.
+func parseChatReply(req ChatRequest, content string) (ChatReply, error) {
+	var raw struct {
+		Answer string  `json:"answer"`
+		Cites  []int   `json:"cites"`
+		Tasks  []llmOp `json:"tasks"`
+	}
+	if js := extractJSON(content); js == "" || json.Unmarshal([]byte(js), &raw) != nil || raw.Answer == "" {
+		raw.Answer, raw.Cites, raw.Tasks = strings.TrimSpace(content), nil, nil
+	}
+	if raw.Answer == "" {
+		return ChatReply{}, fmt.Errorf("empty answer")
+	}
+	out := ChatReply{Answer: strings.TrimSpace(raw.Answer)}
+
+	// cited sources: the list, plus any [n] in the text
+	valid := map[int]bool{}
+	for _, s := range req.Sources {
+		valid[s.N] = true
+	}
+	seen := map[int]bool{}
+	cites := raw.Cites
+	for _, m := range citeRef.FindAllStringSubmatch(out.Answer, -1) {
+		n, _ := strconv.Atoi(m[1])
+		cites = append(cites, n)
+	}
+	for _, n := range cites {
+		if valid[n] && !seen[n] {
+			seen[n] = true
+			out.Cites = append(out.Cites, n)
+		}
+	}
+	sort.Ints(out.Cites)
+
+	today, _ := time.Parse("2006-01-02", req.Today)
+	for i, a := range raw.Tasks {
+		if len(out.Tasks) == maxChatTasks {
+			break
+		}
+		date := strings.TrimSpace(a.Date)
+		if date == "" {
+			date = req.Today
+		}
+		d, err := time.Parse("2006-01-02", date)
+		if err != nil || (!today.IsZero() && d.Before(today)) {
+			log.Printf("[llm] chat task %d dropped: date %q", i, a.Date)
+			continue
+		}
+		ops, problems := validateOps(req.Field, []llmOp{a})
+		if len(ops) == 0 {
+			log.Printf("[llm] chat task %d dropped: %s", i, strings.Join(problems, "; "))
+			continue
+		}
+		ops[0].Date = date
+		out.Tasks = append(out.Tasks, ops[0])
+	}
+	return out, nil
+}
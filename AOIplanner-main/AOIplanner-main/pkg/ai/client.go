@@ -3,13 +3,28 @@
 package ai
 
 import (
+	"context"
+
 	"aoi/entities"
 	"aoi/pkg/plan/types"
 )
 
+// Client calls the language model. Calls honour ctx cancellation and deadline;
+// SummarizePlan always returns usable Markdown (a deterministic fallback
+// together with the error when the model could not be reached).
 type Client interface {
-	SummarizePlan(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) string
+	SummarizePlan(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) (string, error)
+	// StreamSummary is SummarizePlan with the text passed to onDelta as it
+	// arrives. On error the fallback is returned but not sent to onDelta.
+	StreamSummary(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string, onDelta func(string)) (string, error)
 
 	// NEW: ask the model to propose structured additional actions based on problems + KB context
-	ProposeOps(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error)
+	ProposeOps(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error)
+
+	// Chat answers a question about a field in a conversation (see ChatRequest).
+	Chat(ctx context.Context, req ChatRequest) (ChatReply, error)
+
+	// Diagnose reads a leaf or stalk photo (see DiagnoseRequest); it needs a
+	// vision-capable model.
+	Diagnose(ctx context.Context, req DiagnoseRequest) (Diagnosis, error)
 }
@@ -0,0 +1,11 @@
+package controller
+
+import "github.com/labstack/echo/v4"
+
+type LLMController interface {
+	CacheStats(c echo.Context) error
+	InvalidateField(c echo.Context) error
+	Providers(c echo.Context) error
+	Prompts(c echo.Context) error
+	Calls(c echo.Context) error
+}
@@ -0,0 +1,147 @@
+package controllerImp
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"aoi/pkg/ai"
+	fieldrepo "aoi/pkg/field/repository"
+)
+
+type LLMCtrl struct {
+	cache  *ai.Cache // nil when the response cache is disabled
+	chain  *ai.Chain
+	audit  *ai.Audit // nil when call auditing is disabled
+	fields fieldrepo.FieldRepository
+	admins map[string]bool
+}
+
+// New wires the LLM handlers; admins are the user ids allowed to read the call
+// log, provider health and cache statistics.
+func New(cache *ai.Cache, chain *ai.Chain, audit *ai.Audit, fields fieldrepo.FieldRepository, admins []string) *LLMCtrl {
+	am := map[string]bool{}
+	for _, uid := range admins {
+		am[uid] = true
+	}
+	return &LLMCtrl{cache: cache, chain: chain, audit: audit, fields: fields, admins: am}
+}
+
+func (h *LLMCtrl) admin(c echo.Context) bool {
+	uid, _ := c.Get("uid").(string)
+	return h.admins[uid]
+}
+
+// Providers lists the LLM providers in failover order with their health
+// (admins only: it includes the last provider error).
+func (h *LLMCtrl) Providers(c echo.Context) error {
+	if !h.admin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "admin only"})
+	}
+	return c.JSON(http.StatusOK, map[string]any{"providers": h.chain.Health()})
+}
+
+// Prompts lists the loaded prompt templates and which versions are in use.
+func (h *LLMCtrl) Prompts(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]any{"prompts": ai.Prompts()})
+}
+
+// CacheStats reports hit/miss counters per call kind and the stored size
+// (admins only).
+func (h *LLMCtrl) CacheStats(c echo.Context) error {
+	if !h.admin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "admin only"})
+	}
+	if h.cache == nil {
+		return c.JSON(http.StatusOK, ai.CacheStats{})
+	}
+	st, err := h.cache.Stats(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, st)
+}
+
+// InvalidateField drops the cached summaries and proposals of one field, so
+// the next plan build asks the model again.
+func (h *LLMCtrl) InvalidateField(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	f, err := h.fields.FindByID(uint(fid), uid)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "field not found"})
+	}
+	var n int64
+	if h.cache != nil {
+		if n, err = h.cache.InvalidateField(c.Request().Context(), f.FieldID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+	return c.JSON(http.StatusOK, map[string]any{"field_id": f.FieldID, "removed": n})
+}
+
+// Calls lists audited LLM calls, newest first, with daily totals for cost
+// tracking (admins only). Filters: field_id, plan_id, kind, provider,
+// from/to (YYYY-MM-DD, to inclusive), errors=true; paging: limit (≤500), offset.
+func (h *LLMCtrl) Calls(c echo.Context) error {
+	if !h.admin(c) {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "admin only"})
+	}
+	if h.audit == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "llm call audit is disabled"})
+	}
+	f := ai.CallFilter{
+		Kind:     c.QueryParam("kind"),
+		Provider: c.QueryParam("provider"),
+		Errors:   c.QueryParam("errors") == "true",
+		Limit:    50,
+	}
+	for name, dst := range map[string]*uint{"field_id": &f.FieldID, "plan_id": &f.PlanID} {
+		if v := c.QueryParam(name); v != "" {
+			n, err := strconv.ParseUint(v, 10, 64)
+			if err != nil {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "bad " + name})
+			}
+			*dst = uint(n)
+		}
+	}
+	for name, dst := range map[string]*int{"limit": &f.Limit, "offset": &f.Offset} {
+		if v := c.QueryParam(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": "bad " + name})
+			}
+			*dst = n
+		}
+	}
+	if f.Limit == 0 || f.Limit > 500 {
+		f.Limit = 500
+	}
+	if v := c.QueryParam("from"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be YYYY-MM-DD"})
+		}
+		f.From = t
+	}
+	if v := c.QueryParam("to"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "to must be YYYY-MM-DD"})
+		}
+		f.To = t.AddDate(0, 0, 1)
+	}
+
+	ctx := c.Request().Context()
+	calls, total, err := h.audit.Calls(ctx, f)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	daily, err := h.audit.Daily(ctx, f)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]any{"total": total, "calls": calls, "daily": daily})
+}
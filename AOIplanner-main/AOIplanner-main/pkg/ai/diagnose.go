@@ -0,0 +1,182 @@
+// pkg/ai/diagnose.go
+
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+
+	"aoi/entities"
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+	"aoi/pkg/problem"
+)
+
+// Diagnosis codes besides the problem catalogue's.
+const (
+	DiagnosisHealthy = "healthy"
+	DiagnosisUnknown = "unknown" // not a sugarcane photo, too blurry, or nothing recognisable
+)
+
+// maxDiagnoseActions bounds the actions recommended for one photo.
+const maxDiagnoseActions = 3
+
+// stubConfidence is what the offline stub reports for a problem named in the
+// farmer's note: it never looks at the photo, so it stays below the usual
+// auto-task threshold.
+const stubConfidence = 0.6
+
+// Image is a photo for a vision-capable model.
+type Image struct {
+	MIME string // image/jpeg, image/png, ...
+	Data []byte
+}
+
+// DiagnoseRequest is a leaf or stalk photo taken with a measurement.
+type DiagnoseRequest struct {
+	Field *entities.Field
+	Today string
+	Image Image
+	Note  string // the farmer's note on the measurement
+}
+
+// Diagnosis is the model's reading of a photo. Code is a problem catalogue
+// code (diseases, pests, nutrient problems), DiagnosisHealthy or
+// DiagnosisUnknown; Actions are validated like proposed ops (undated).
+type Diagnosis struct {
+	Code       string
+	Confidence float64 // 0..1
+	Findings   string  // what was seen, in Thai
+	Actions    []types.PlanOp
+}
+
+// diagnosisCodes are the codes a photo can be diagnosed with.
+func diagnosisCodes() []string {
+	var out []string
+	for _, p := range problem.All() {
+		switch p.Category {
+		case problem.CategoryDisease, problem.CategoryPest, problem.CategoryNutrient:
+			out = append(out, p.Code)
+		}
+	}
+	return append(out, DiagnosisHealthy, DiagnosisUnknown)
+}
+
+func diagnoseSchema() map[string]any {
+	s := proposeOpsSchema()
+	acts := s["properties"].(map[string]any)["actions"].(map[string]any)
+	acts["maxItems"] = maxDiagnoseActions
+	return map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"code", "confidence", "findings", "actions"},
+		"properties": map[string]any{
+			"code":       map[string]any{"type": "string", "enum": diagnosisCodes()},
+			"confidence": map[string]any{"type": "number"},
+			"findings":   map[string]any{"type": "string"},
+			"actions":    acts,
+		},
+	}
+}
+
+func (c *chatClient) Diagnose(ctx context.Context, req DiagnoseRequest) (Diagnosis, error) {
+	var codes []string
+	for _, code := range diagnosisCodes() {
+		if p, ok := problem.Lookup(code); ok {
+			code += " = " + p.LabelTH + " (" + p.LabelEN + ")"
+		}
+		codes = append(codes, code)
+	}
+	prompt, err := renderPrompt(ctx, PromptDiagnose, promptData{
+		Field: req.Field, Today: req.Today, Question: req.Note, Problems: codes,
+		MaxActions: maxDiagnoseActions, MaxTitleLen: maxTitleLen,
+	})
+	if err != nil {
+		return Diagnosis{}, err
+	}
+	msgs := []chatMsg{
+		{Role: "system", Content: "You are a sugarcane plant pathologist diagnosing field photos. Reply ONLY valid JSON."},
+		{Role: "user", Content: prompt, Images: []Image{req.Image}},
+	}
+	noteRequest(ctx, msgs)
+
+	var content string
+	for {
+		var schema *outputSchema
+		if c.schema.Load() != schemaUnsupported {
+			schema = &outputSchema{Name: "photo_diagnosis", Schema: diagnoseSchema()}
+		}
+		content, err = c.api.chat(ctx, msgs, schema)
+		if schema != nil && unsupportedFormat(err) {
+			log.Printf("[llm] endpoint rejects structured output, using plain JSON: %v", err)
+			c.schema.Store(schemaUnsupported)
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return Diagnosis{}, err
+	}
+	noteResponse(ctx, content)
+	return parseDiagnosis(req.Field, content)
+}
+
+// parseDiagnosis reads the JSON reply. An unknown code becomes
+// DiagnosisUnknown, confidence is clamped to 0..1 and invalid actions are
+// dropped.
+func parseDiagnosis(f *entities.Field, content string) (Diagnosis, error) {
+	var raw struct {
+		Code       string  `json:"code"`
+		Confidence float64 `json:"confidence"`
+		Findings   string  `json:"findings"`
+		Actions    []llmOp `json:"actions"`
+	}
+	js := extractJSON(content)
+	if js == "" {
+		return Diagnosis{}, fmt.Errorf("no JSON in diagnosis reply")
+	}
+	if err := json.Unmarshal([]byte(js), &raw); err != nil {
+		return Diagnosis{}, fmt.Errorf("diagnosis reply: %w", err)
+	}
+	out := Diagnosis{
+		Code:       strings.ToLower(strings.TrimSpace(raw.Code)),
+		Confidence: math.Max(0, math.Min(1, raw.Confidence)),
+		Findings:   strings.TrimSpace(raw.Findings),
+	}
+	if !contains(diagnosisCodes(), out.Code) {
+		log.Printf("[llm] diagnosis code %q not in catalogue", raw.Code)
+		out.Code, out.Confidence = DiagnosisUnknown, 0
+	}
+	if len(raw.Actions) > maxDiagnoseActions {
+		raw.Actions = raw.Actions[:maxDiagnoseActions]
+	}
+	ops, problems := validateOps(f, raw.Actions)
+	if len(problems) > 0 {
+		log.Printf("[llm] diagnosis actions dropped: %s", strings.Join(problems, "; "))
+	}
+	out.Actions = ops
+	return out, nil
+}
+
+// StubDiagnose is the deterministic diagnosis used offline: it cannot see
+// the photo, so it only reports a catalogue problem named in the farmer's
+// note (at stubConfidence, with the catalogue's actions), otherwise unknown.
+// The findings are written in ctx's locale.
+func StubDiagnose(ctx context.Context, req DiagnoseRequest) Diagnosis {
+	loc := i18n.FromContext(ctx)
+	codes := diagnosisCodes()
+	for _, p := range problem.Match(req.Note) {
+		if contains(codes, p.Code) {
+			return Diagnosis{
+				Code: p.Code, Confidence: stubConfidence,
+				Findings: i18n.T(loc, "diagnosis.from_note", map[string]string{"problem": "@" + problem.LabelKey(p.Code)}),
+				Actions:  append([]types.PlanOp(nil), p.Actions...),
+			}
+		}
+	}
+	return Diagnosis{Code: DiagnosisUnknown, Findings: i18n.T(loc, "diagnosis.not_checked", nil)}
+}
@@ -3,38 +3,47 @@
 package ai
 
 import (
+	"context"
 	"strings"
 
 	"aoi/entities"
+	"aoi/pkg/i18n"
 	"aoi/pkg/plan/types"
+	"aoi/pkg/problem"
 )
 
 type mockClient struct{}
 
 func NewMock() Client { return &mockClient{} }
 
-func (m *mockClient) SummarizePlan(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) string {
-	// ... your existing mock summary ...
-	return "สรุปแผนเบื้องต้น (mock)"
+func (m *mockClient) SummarizePlan(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) (string, error) {
+	return fallbackSummary(ctx, f, stages, ops, kbCtx), nil
+}
+
+func (m *mockClient) StreamSummary(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string, onDelta func(string)) (string, error) {
+	out, _ := m.SummarizePlan(ctx, f, stages, ops, kbCtx)
+	for _, w := range strings.SplitAfter(out, " ") {
+		onDelta(w)
+	}
+	return out, nil
 }
 
 // NEW
-func (m *mockClient) ProposeOps(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error) {
-	out := make([]types.PlanOp, 0, 6)
-	joined := strings.Join(problems, " ")
+func (m *mockClient) ProposeOps(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error) {
+	found, _ := problem.Resolve(nil, problems)
+	return problem.Actions(found), nil
+}
 
-	if strings.Contains(joined, "พายุ") {
-		out = append(out, types.PlanOp{Type: "advisory", Title: "เตรียมระบายน้ำ/ขุดร่อง", Notes: "กันน้ำขังเกิน 48 ชม."})
-	}
-	if strings.Contains(joined, "แห้ง") {
-		q := 20.0
-		out = append(out, types.PlanOp{Type: "irrigation", Title: "เพิ่มน้ำชดเชยความชื้น", Qty: &q, Unit: "mm", Notes: "ตามศักยภาพปั๊ม"})
-	}
-	if strings.Contains(joined, "ใบขาว") || strings.Contains(joined, "กอตะไคร้") || strings.Contains(joined, "แส้ดำ") {
-		out = append(out, types.PlanOp{Type: "inspect", Title: "สำรวจอาการโรคอ้อย", Notes: "สุ่มตรวจ 5 จุด/แปลง พร้อมภาพประกอบ"})
+
+func (m *mockClient) Chat(ctx context.Context, req ChatRequest) (ChatReply, error) {
+	out := ChatReply{Answer: i18n.T(i18n.FromContext(ctx), "chat.mock", map[string]string{"question": req.Question})}
+	if len(req.Sources) > 0 {
+		out.Answer += " [1]"
+		out.Cites = []int{1}
 	}
-	// always add seasonal scouting
-	out = append(out, types.PlanOp{Type: "inspect", Title: "สำรวจโรคตามฤดูกาล", Notes: "ดูใบจุดวงแหวน/เน่าแดงช่วงชื้น"})
 	return out, nil
 }
 
+func (m *mockClient) Diagnose(ctx context.Context, req DiagnoseRequest) (Diagnosis, error) {
+	return StubDiagnose(ctx, req), nil
+}
@@ -0,0 +1,216 @@
+// pkg/ai/offline_summary.go
+
+package ai
+
+import (
+	"bytes"
+	_ "embed"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+)
+
+// The offline summary is written from the plan alone (no model): it is what
+// the mock provider returns and the fallback when every provider fails.
+
+//go:embed offline_summary.md.tmpl
+var offlineSummarySrc string
+
+//go:embed offline_summary_en.md.tmpl
+var offlineSummaryEN string
+
+const (
+	upcomingDays  = 14 // "key dates" window
+	upcomingMax   = 8
+	waterSoonDays = 30
+	articlesMax   = 5
+)
+
+// stageTH names the rule engine's growth stages.
+var stageTH = map[string]string{
+	"Germination": "งอก", "Tillering": "แตกกอ", "Elongation": "ย่างปล้อง",
+	"Ripening": "สุกแก่", "Maturity": "สุกแก่", "Harvest": "เก็บเกี่ยว",
+}
+
+var stageEN = map[string]string{
+	"Germination": "Germination", "Tillering": "Tillering", "Elongation": "Elongation",
+	"Ripening": "Ripening", "Maturity": "Ripening", "Harvest": "Harvest",
+}
+
+var opTypeEN = map[string]string{
+	"irrigation": "Irrigation", "fertilizer": "Fertilizer", "pesticide": "Pest control", "pest": "Pest control",
+	"inspect": "Scouting", "observe": "Measure/record", "advisory": "Advice", "other": "Other",
+}
+
+// offlineSummaryTmpl holds the template per locale.
+var offlineSummaryTmpl = map[string]*template.Template{
+	i18n.TH: offlineTemplate("offline_summary", offlineSummarySrc, stageTH, promptTypeTH),
+	i18n.EN: offlineTemplate("offline_summary_en", offlineSummaryEN, stageEN, opTypeEN),
+}
+
+func offlineTemplate(name, src string, stages, opTypes map[string]string) *template.Template {
+	return template.Must(template.New(name).Funcs(template.FuncMap{
+		"num":    num,
+		"stage":  func(s string) string { return label(stages, s) },
+		"optype": func(t string) string { return label(opTypes, t) },
+		"qty":    opQty,
+		"volume": volume,
+	}).Parse(src))
+}
+
+type offlineStage struct {
+	types.StagePlan
+	Irrigations int
+	Water       map[string]float64 // unit -> total
+}
+
+type offlineData struct {
+	Field    *entities.Field
+	Today    string
+	Current  *offlineStage
+	Next     *offlineStage
+	DaysLeft int // in the current stage, today included
+	Stages   []offlineStage
+
+	Upcoming   []types.PlanOp // key tasks (not routine irrigation/observation) in the next upcomingDays
+	NextWater  *types.PlanOp
+	WaterTotal map[string]float64
+	WaterSoon  map[string]float64 // next waterSoonDays
+	Irrigated  int
+	Fertilizer []types.PlanOp
+	Articles   []string
+}
+
+// offlineSummary writes a Markdown summary of the plan in loc as of today:
+// current stage, key dates ahead, water totals, fertilizer timing and the
+// titles of the KB articles in kbCtx.
+func offlineSummary(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx, loc string, today time.Time) string {
+	d := offlineData{Field: f, Today: today.Format("2006-01-02"), WaterTotal: map[string]float64{}, WaterSoon: map[string]float64{}}
+	if d.Field == nil {
+		d.Field = &entities.Field{}
+	}
+	for _, st := range stages {
+		st.Ops = nil
+		d.Stages = append(d.Stages, offlineStage{StagePlan: st, Water: map[string]float64{}})
+	}
+	for i := range d.Stages {
+		st := &d.Stages[i]
+		switch {
+		case d.Current == nil && st.StartDate <= d.Today && d.Today <= st.EndDate:
+			d.Current = st
+			if end, err := time.Parse("2006-01-02", st.EndDate); err == nil {
+				d.DaysLeft = int(end.Sub(day(today)).Hours()/24) + 1
+			}
+		case d.Next == nil && st.StartDate > d.Today:
+			d.Next = st
+		}
+	}
+
+	sorted := append([]types.PlanOp(nil), ops...)
+	i18n.LocalizeOps(sorted, loc)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date < sorted[j].Date })
+	soon := today.AddDate(0, 0, upcomingDays).Format("2006-01-02")
+	waterSoon := today.AddDate(0, 0, waterSoonDays).Format("2006-01-02")
+	for i := range sorted {
+		op := sorted[i]
+		switch op.Type {
+		case "irrigation":
+			d.Irrigated++
+			if op.Qty != nil {
+				d.WaterTotal[op.Unit] += *op.Qty
+				if op.Date >= d.Today && op.Date <= waterSoon {
+					d.WaterSoon[op.Unit] += *op.Qty
+				}
+			}
+			if d.NextWater == nil && op.Date >= d.Today {
+				d.NextWater = &sorted[i]
+			}
+			for j := range d.Stages {
+				if st := &d.Stages[j]; st.StartDate <= op.Date && op.Date <= st.EndDate {
+					st.Irrigations++
+					if op.Qty != nil {
+						st.Water[op.Unit] += *op.Qty
+					}
+					break
+				}
+			}
+			continue
+		case "fertilizer":
+			d.Fertilizer = append(d.Fertilizer, op)
+		case "observe":
+			continue
+		}
+		if op.Date >= d.Today && op.Date <= soon && len(d.Upcoming) < upcomingMax {
+			d.Upcoming = append(d.Upcoming, op)
+		}
+	}
+	d.Articles = kbTitles(kbCtx, articlesMax)
+
+	t, ok := offlineSummaryTmpl[loc]
+	if !ok {
+		t = offlineSummaryTmpl[i18n.Default]
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, d); err != nil {
+		return i18n.T(loc, "summary.offline", nil)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func opQty(op types.PlanOp) string {
+	if op.Qty == nil {
+		return ""
+	}
+	return strings.TrimSpace(num(*op.Qty) + " " + op.Unit)
+}
+
+// volume prints per-unit totals, e.g. "1440 m3".
+func volume(m map[string]float64) string {
+	units := make([]string, 0, len(m))
+	for u := range m {
+		units = append(units, u)
+	}
+	sort.Strings(units)
+	parts := make([]string, 0, len(units))
+	for _, u := range units {
+		parts = append(parts, strings.TrimSpace(num(m[u])+" "+u))
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	return strings.Join(parts, " + ")
+}
+
+// KBPassage formats a retrieved passage for the kbCtx argument of the
+// summary calls; the title lets summaries name the article.
+func KBPassage(title, text string) string {
+	if title = strings.TrimSpace(title); title != "" {
+		return "\n---\n## " + title + "\n" + text
+	}
+	return "\n---\n" + text
+}
+
+// kbTitles lists the distinct article titles in kbCtx (see KBPassage).
+func kbTitles(kbCtx string, max int) []string {
+	var out []string
+	for _, part := range strings.Split(kbCtx, "\n---\n") {
+		first, _, _ := strings.Cut(strings.TrimLeft(part, "\n"), "\n")
+		t, ok := strings.CutPrefix(first, "## ")
+		if !ok || contains(out, t) {
+			continue
+		}
+		if out = append(out, t); len(out) == max {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,132 @@
+// pkg/ai/ollama.go
+
+package ai
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"aoi/pkg/outbound"
+)
+
+// ollama speaks Ollama's native /api/chat protocol. Structured output goes in
+// "format" and streaming replies are newline-delimited JSON objects.
+type ollama struct {
+	url   string
+	model string
+	httpc *outbound.Client
+}
+
+func newOllama(name, endpoint, model string) *ollama {
+	return &ollama{url: strings.TrimRight(endpoint, "/") + "/api/chat", model: model, httpc: outboundFor(name)}
+}
+
+type ollamaChunk struct {
+	Message struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Done  bool   `json:"done"`
+	Error string `json:"error"`
+
+	PromptEvalCount int `json:"prompt_eval_count"` // set on the final object
+	EvalCount       int `json:"eval_count"`
+}
+
+func (c *ollama) noteUsage(ctx context.Context, ch ollamaChunk) {
+	if ci := callInfoFrom(ctx); ci != nil {
+		ci.addUsage(c.model, ch.PromptEvalCount, ch.EvalCount)
+	}
+}
+
+func (c *ollama) body(msgs []chatMsg, stream bool) map[string]any {
+	wire := make([]map[string]any, len(msgs))
+	for i, m := range msgs {
+		wire[i] = map[string]any{"role": m.Role, "content": m.Content}
+		if len(m.Images) > 0 {
+			imgs := make([]string, len(m.Images))
+			for j, img := range m.Images {
+				imgs[j] = base64.StdEncoding.EncodeToString(img.Data)
+			}
+			wire[i]["images"] = imgs
+		}
+	}
+	return map[string]any{
+		"model":    c.model,
+		"messages": wire,
+		"stream":   stream,
+		"options":  map[string]any{"temperature": 0.2},
+	}
+}
+
+func (c *ollama) chat(ctx context.Context, msgs []chatMsg, schema *outputSchema) (string, error) {
+	reqBody := c.body(msgs, false)
+	if schema != nil {
+		reqBody["format"] = schema.Schema
+	}
+	ctx, cancel := withDeadline(ctx)
+	defer cancel()
+	resp, err := c.httpc.PostJSON(ctx, c.url, nil, reqBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out ollamaChunk
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if out.Error != "" {
+		return "", fmt.Errorf("ollama: %s", out.Error)
+	}
+	c.noteUsage(ctx, out)
+	return out.Message.Content, nil
+}
+
+func (c *ollama) stream(ctx context.Context, msgs []chatMsg, onDelta func(string)) (string, error) {
+	ctx, cancel := withDeadline(ctx)
+	defer cancel()
+	resp, err := c.httpc.PostJSON(ctx, c.url, nil, c.body(msgs, true))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var sb strings.Builder
+	finished := false
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var chunk ollamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return "", fmt.Errorf("stream chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return "", fmt.Errorf("ollama: %s", chunk.Error)
+		}
+		if chunk.Message.Content != "" {
+			sb.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		if chunk.Done {
+			c.noteUsage(ctx, chunk)
+			finished = true
+			break
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return sb.String(), err
+	}
+	if !finished { // connection closed before the done chunk
+		return sb.String(), io.ErrUnexpectedEOF
+	}
+	return sb.String(), nil
+}
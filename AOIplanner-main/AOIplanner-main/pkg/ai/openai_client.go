@@ -3,191 +3,406 @@
 package ai
 
 import (
-	"bytes"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"aoi/entities"
+	"aoi/pkg/i18n"
+	"aoi/pkg/outbound"
 	"aoi/pkg/plan/types"
 )
 
+// defaultTimeout bounds a model call when the caller's context has no deadline.
+const defaultTimeout = 25 * time.Second
+
+// chatAPI is one provider's wire protocol for chat completions.
+type chatAPI interface {
+	// chat returns the reply text. A non-nil schema asks for structured output
+	// matching it.
+	chat(ctx context.Context, msgs []chatMsg, schema *outputSchema) (string, error)
+	// stream passes the reply text to onDelta as it arrives and returns it whole.
+	stream(ctx context.Context, msgs []chatMsg, onDelta func(string)) (string, error)
+}
+
+// chatClient implements Client on top of any chatAPI: prompts, fallbacks,
+// and validation/repair of proposed ops are the same for every provider.
+type chatClient struct {
+	api    chatAPI
+	schema atomic.Int32 // schemaUnknown | schemaSupported | schemaUnsupported
+}
+
+// openAI speaks the OpenAI chat completions protocol, which OpenAI, Azure
+// OpenAI deployments and llama.cpp's server all accept.
 type openAI struct {
-	endpoint string
-	key      string
-	model    string
+	url    string            // full chat completions URL
+	header map[string]string // auth header(s)
+	model  string
+	httpc  *outbound.Client
+
+	streamUsage bool // ask for a final usage chunk when streaming (stream_options)
 }
 
 func NewOpenAI(endpoint, key, model string) Client {
-	return &openAI{endpoint: endpoint, key: key, model: model}
+	return newOpenAI("openai", endpoint, key, model)
+}
+
+// newOpenAI is NewOpenAI with the provider name that keys its breaker.
+func newOpenAI(name, endpoint, key, model string) Client {
+	return &chatClient{api: &openAI{
+		url:    strings.TrimRight(endpoint, "/") + "/v1/chat/completions",
+		header: map[string]string{"Authorization": "Bearer " + key},
+		model:  model,
+		httpc:  outboundFor(name),
+
+		streamUsage: true,
+	}}
 }
 
-func (c *openAI) SummarizePlan(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) string {
-	type chatReq struct {
-		Model     string                 `json:"model"`
-		Messages  []map[string]string    `json:"messages"`
-		Temperature float64              `json:"temperature"`
+// withDeadline applies defaultTimeout unless ctx already has a deadline.
+func withDeadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
 	}
-	reqBody := chatReq{
-		Model: c.model,
-		Messages: []map[string]string{
-			{"role": "system", "content": "You are a Thai sugarcane agronomist who writes concise, actionable summaries in Markdown."},
-			{"role": "user", "content": renderSummaryPrompt(f, stages, ops, kbCtx)},
-		},
-		Temperature: 0.2,
+	return context.WithTimeout(ctx, defaultTimeout)
+}
+
+// noteRequest records the rendered prompt in ctx's CallInfo for the audit log.
+func noteRequest(ctx context.Context, msgs []chatMsg) {
+	ci := callInfoFrom(ctx)
+	if ci == nil {
+		return
 	}
+	h := sha256.New()
+	for _, m := range msgs {
+		h.Write([]byte(m.Role + "\x00" + m.Content + "\x00"))
+		for _, img := range m.Images {
+			h.Write(img.Data)
+		}
+	}
+	ci.PromptHash = hex.EncodeToString(h.Sum(nil))
+	ci.Request = msgs[len(msgs)-1].Content
+}
 
-	b, _ := json.Marshal(reqBody)
-	httpc := &http.Client{Timeout: 25 * time.Second}
-	req, _ := http.NewRequest("POST", strings.TrimRight(c.endpoint, "/")+"/v1/chat/completions", bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+c.key)
-	req.Header.Set("Content-Type", "application/json")
+func noteResponse(ctx context.Context, content string) {
+	if ci := callInfoFrom(ctx); ci != nil {
+		ci.Response = content
+	}
+}
 
-	resp, err := httpc.Do(req)
+func summaryMessages(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) ([]chatMsg, error) {
+	prompt, err := renderPrompt(ctx, PromptSummary, promptData{Field: f, Stages: stages, Ops: ops, KB: kbCtx})
 	if err != nil {
-		// fallback summary (no external call)
-		return fallbackSummary(f, stages)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	msgs := []chatMsg{
+		{Role: "system", Content: "You are a Thai sugarcane agronomist who writes concise, actionable summaries in Markdown."},
+		{Role: "user", Content: prompt},
+	}
+	noteRequest(ctx, msgs)
+	return msgs, nil
+}
 
-	var out struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+func (c *chatClient) SummarizePlan(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) (string, error) {
+	msgs, err := summaryMessages(ctx, f, stages, ops, kbCtx)
+	if err != nil {
+		return fallbackSummary(ctx, f, stages, ops, kbCtx), err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil || len(out.Choices) == 0 {
-		return fallbackSummary(f, stages)
+	content, err := c.api.chat(ctx, msgs, nil)
+	if err != nil {
+		// fallback summary (no external call)
+		return fallbackSummary(ctx, f, stages, ops, kbCtx), err
 	}
-	content := strings.TrimSpace(out.Choices[0].Message.Content)
+	noteResponse(ctx, content)
+	content = strings.TrimSpace(content)
 	if content == "" {
-		return fallbackSummary(f, stages)
+		return fallbackSummary(ctx, f, stages, ops, kbCtx), fmt.Errorf("empty summary")
 	}
-	return content
+	return content, nil
 }
 
-// NEW
-func (c *openAI) ProposeOps(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error) {
-	type llmOp struct {
-		Type  string   `json:"type"`            // irrigation | fertilizer | pesticide | inspect | advisory | other
-		Title string   `json:"title"`
-		Qty   *float64 `json:"qty,omitempty"`   // numeric amount (if any)
-		Unit  string   `json:"unit,omitempty"`  // mm / kg/rai / L / etc
-		Notes string   `json:"notes,omitempty"`
-	}
-	reqBody := map[string]any{
-		"model": c.model,
-		"messages": []map[string]string{
-			{"role": "system", "content": "You are a Thai sugarcane agronomist. Reply ONLY valid JSON."},
-			{"role": "user", "content": renderProposeOpsPrompt(f, stages, ops, problems, kbCtx)},
-		},
-		"temperature": 0.2,
+func (c *chatClient) StreamSummary(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string, onDelta func(string)) (string, error) {
+	msgs, err := summaryMessages(ctx, f, stages, ops, kbCtx)
+	if err != nil {
+		return fallbackSummary(ctx, f, stages, ops, kbCtx), err
 	}
-	b, _ := json.Marshal(reqBody)
-	httpc := &http.Client{Timeout: 25 * time.Second}
-	req, _ := http.NewRequest("POST", strings.TrimRight(c.endpoint, "/")+"/v1/chat/completions", bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+c.key)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := httpc.Do(req)
+	content, err := c.api.stream(ctx, msgs, onDelta)
+	noteResponse(ctx, content)
 	if err != nil {
-		return nil, err
+		return fallbackSummary(ctx, f, stages, ops, kbCtx), err
 	}
-	defer resp.Body.Close()
-
-	var out struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return fallbackSummary(ctx, f, stages, ops, kbCtx), fmt.Errorf("empty summary")
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+	return content, nil
+}
+
+// maxRepairs bounds how often ProposeOps sends a reply back for fixing.
+const maxRepairs = 2
+
+// ProposeOps asks for extra actions as JSON. Endpoints that support
+// structured output get the strict schema; the others are parsed leniently.
+// Either way each action is validated, and a reply with problems is sent
+// back with the validation errors, up to maxRepairs times. Whatever is still
+// invalid after that is dropped.
+func (c *chatClient) ProposeOps(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) ([]types.PlanOp, error) {
+	prompt, err := renderPrompt(ctx, PromptProposeOps, promptData{
+		Field: f, Stages: stages, Ops: ops, Problems: problems, KB: kbCtx,
+		MaxActions: maxActions, MaxTitleLen: maxTitleLen,
+	})
+	if err != nil {
 		return nil, err
 	}
-	if len(out.Choices) == 0 {
-		return nil, fmt.Errorf("no choices")
+	msgs := []chatMsg{
+		{Role: "system", Content: "You are a Thai sugarcane agronomist. Reply ONLY valid JSON."},
+		{Role: "user", Content: prompt},
 	}
+	noteRequest(ctx, msgs)
+	var res []types.PlanOp
+	var issues []string
+	for attempt := 0; ; attempt++ {
+		var schema *outputSchema
+		if c.schema.Load() != schemaUnsupported {
+			schema = &outputSchema{Name: "propose_ops", Schema: proposeOpsSchema()}
+		}
+		content, err := c.api.chat(ctx, msgs, schema)
+		if schema != nil && unsupportedFormat(err) {
+			log.Printf("[llm] endpoint rejects structured output, using plain JSON: %v", err)
+			c.schema.Store(schemaUnsupported)
+			attempt--
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if schema != nil {
+			c.schema.Store(schemaSupported)
+		}
+		noteResponse(ctx, content)
 
-	// Parse JSON payload
-	var payload struct{ Actions []llmOp `json:"actions"` }
-	if err := json.Unmarshal([]byte(out.Choices[0].Message.Content), &payload); err != nil {
-		var arr []llmOp
-		if err2 := json.Unmarshal([]byte(out.Choices[0].Message.Content), &arr); err2 != nil {
-			return nil, fmt.Errorf("parse propose_ops: %v / raw: %s", err, out.Choices[0].Message.Content)
+		acts, perr := parseActions(content)
+		if perr != nil {
+			res, issues = nil, []string{perr.Error()}
+		} else {
+			res, issues = validateOps(f, acts)
+		}
+		if len(issues) == 0 || attempt >= maxRepairs {
+			break
 		}
-		payload.Actions = arr
+		msgs = append(msgs,
+			chatMsg{Role: "assistant", Content: content},
+			chatMsg{Role: "user", Content: "คำตอบไม่ผ่านการตรวจสอบ:\n- " + strings.Join(issues, "\n- ") +
+				"\nแก้ไขแล้วตอบใหม่ทั้งชุดเป็น JSON เท่านั้น ในรูปแบบเดิม {\"actions\":[...]}"},
+		)
 	}
-
-	// Map to PlanOp
-	res := make([]types.PlanOp, 0, len(payload.Actions))
-	for _, a := range payload.Actions {
-		tp := strings.ToLower(strings.TrimSpace(a.Type))
-		if tp == "" { tp = "advisory" }
-		res = append(res, types.PlanOp{
-			Type:  tp,
-			Title: strings.TrimSpace(a.Title),
-			Qty:   a.Qty,
-			Unit:  strings.TrimSpace(a.Unit),
-			Notes: strings.TrimSpace(a.Notes),
-		})
+	if len(res) == 0 {
+		return nil, fmt.Errorf("propose_ops: no valid actions: %s", strings.Join(issues, "; "))
+	}
+	if len(issues) > 0 {
+		log.Printf("[llm] propose_ops dropped invalid actions: %s", strings.Join(issues, "; "))
 	}
+
 	// Ensure at least one inspect
 	hasInspect := false
 	for _, r := range res { if r.Type == "inspect" { hasInspect = true; break } }
 	if !hasInspect {
-		res = append(res, types.PlanOp{Type: "inspect", Title: "สำรวจโรคตามฤดูกาล", Notes: "ตรวจอาการเสี่ยงในช่วงนี้"})
+		res = append(res, i18n.Op("inspect", "task.scout_risks", nil))
 	}
 	return res, nil
 }
 
-func renderProposeOpsPrompt(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, problems []string, kbCtx string) string {
-	return fmt.Sprintf(`
-จงทำหน้าที่นักวิชาการเกษตรอ้อย ช่วย "เสนอรายการปฏิบัติ" เพิ่มเติมจาก CURRENT PLAN เพื่อรับมือ PROBLEMS โดยใช้ KB NOTES ประกอบ
-ข้อกำหนด:
-- อนุญาตให้เสนอการกระทำที่นอกเหนือจากชุดเดิม (เช่น ระบายน้ำ, สำรวจ, สุขอนามัยแปลง)
-- ถ้ามีความเสี่ยงโรค ให้อย่างน้อย 1 task แบบ inspect
-- ให้ระบุปริมาณ/หน่วยถ้าเหมาะสม (mm, kg/rai)
-- ตอบเป็น JSON เท่านั้น: {"actions":[{"type":"irrigation|fertilizer|pesticide|inspect|advisory|other","title":"...","qty":10,"unit":"mm","notes":"..."}, ...]}
+// Structured-output support of the endpoint, learned from the first call.
+const (
+	schemaUnknown int32 = iota
+	schemaSupported
+	schemaUnsupported
+)
 
-FIELD: %+v
+// outputSchema is a named JSON schema for structured output.
+type outputSchema struct {
+	Name   string
+	Schema map[string]any
+}
 
-PROBLEMS: %v
+type chatMsg struct {
+	Role    string  `json:"role"`
+	Content string  `json:"content"`
+	Images  []Image `json:"-"` // sent in each provider's own format
+}
 
-CURRENT PLAN (stages+ops): %v
+// openAIMessages puts images into content parts as data URLs.
+func openAIMessages(msgs []chatMsg) []any {
+	out := make([]any, len(msgs))
+	for i, m := range msgs {
+		if len(m.Images) == 0 {
+			out[i] = m
+			continue
+		}
+		parts := []any{map[string]any{"type": "text", "text": m.Content}}
+		for _, img := range m.Images {
+			parts = append(parts, map[string]any{
+				"type":      "image_url",
+				"image_url": map[string]any{"url": "data:" + img.MIME + ";base64," + base64.StdEncoding.EncodeToString(img.Data)},
+			})
+		}
+		out[i] = map[string]any{"role": m.Role, "content": parts}
+	}
+	return out
+}
 
-KB NOTES:
-%s
-`, f, problems, ops, kbCtx)
+// unsupportedFormat reports whether err is the endpoint refusing the
+// structured-output parameter (response_format, or Ollama's format).
+func unsupportedFormat(err error) bool {
+	var ae *outbound.StatusError
+	if !errors.As(err, &ae) || ae.Status != http.StatusBadRequest && ae.Status != http.StatusUnprocessableEntity {
+		return false
+	}
+	b := strings.ToLower(ae.Body)
+	return strings.Contains(b, "response_format") || strings.Contains(b, "json_schema") || strings.Contains(b, "invalid format")
 }
 
-func renderSummaryPrompt(f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) string {
-	return fmt.Sprintf(`
-สรุป “แผนจัดการอ้อย” ภาษาไทยแบบกระชับ เป็นหัวข้อย่อย Markdown (ไม่เกิน 8 บรรทัด) และชัดเจนเชิงปฏิบัติ
-- หากมี KB NOTES ให้ผูกบริบท/เหตุผล แต่ห้ามคัดลอกยาว
-- ระบุสิ่งที่ต้องทำ, ปริมาณ/หน่วย (mm, kg/rai) เท่าที่เหมาะสม
-- หลีกเลี่ยงภาษาทั่วไป เช่น "ควรใส่ใจ" ให้ใช้ประโยคปฏิบัติได้จริง
+func (c *openAI) chat(ctx context.Context, msgs []chatMsg, schema *outputSchema) (string, error) {
+	reqBody := map[string]any{
+		"model":       c.model,
+		"messages":    openAIMessages(msgs),
+		"temperature": 0.2,
+	}
+	if schema != nil {
+		reqBody["response_format"] = map[string]any{
+			"type":        "json_schema",
+			"json_schema": map[string]any{"name": schema.Name, "strict": true, "schema": schema.Schema},
+		}
+	}
+	ctx, cancel := withDeadline(ctx)
+	defer cancel()
+	resp, err := c.httpc.PostJSON(ctx, c.url, c.header, reqBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
 
-FIELD:
-%+v
+	var out struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage *openAIUsage `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	c.noteUsage(ctx, out.Model, out.Usage)
+	if len(out.Choices) == 0 {
+		return "", fmt.Errorf("no choices")
+	}
+	return out.Choices[0].Message.Content, nil
+}
 
-STAGES (ย่อ):
-%v
+// stream requests stream: true and forwards each content delta of the
+// server-sent chunks. A stream that ends before [DONE] or a finish_reason was
+// cut off and fails with io.ErrUnexpectedEOF.
+func (c *openAI) stream(ctx context.Context, msgs []chatMsg, onDelta func(string)) (string, error) {
+	ctx, cancel := withDeadline(ctx)
+	defer cancel()
+	reqBody := map[string]any{
+		"model":       c.model,
+		"messages":    openAIMessages(msgs),
+		"temperature": 0.2,
+		"stream":      true,
+	}
+	if c.streamUsage {
+		reqBody["stream_options"] = map[string]any{"include_usage": true}
+	}
+	resp, err := c.httpc.PostJSON(ctx, c.url, c.header, reqBody)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
 
-OPS (ย่อ):
-%v
+	var sb strings.Builder
+	finished := false
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			finished = true
+			break
+		}
+		var chunk struct {
+			Model   string `json:"model"`
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			c.noteUsage(ctx, chunk.Model, chunk.Usage)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			sb.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].FinishReason != "" {
+			finished = true
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return sb.String(), err
+	}
+	if !finished {
+		return sb.String(), io.ErrUnexpectedEOF
+	}
+	return sb.String(), nil
+}
 
-KB NOTES (ย่อ/คัดใจความ):
-%s
-`, f, stages, ops, kbCtx)
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
 }
 
-func fallbackSummary(f *entities.Field, stages []types.StagePlan) string {
-	return fmt.Sprintf(
-		"**สรุปแผนเบื้องต้น**\n\n- แปลง: #%d, พื้นที่ %.2f ไร่\n- ระยะ: %d ช่วงการเจริญเติบโต\n- ดำเนินการตามปฏิทินงานที่ระบบจัดไว้ (รดน้ำ/ให้ปุ๋ย/สำรวจศัตรูพืช) และปรับตามสภาพอากาศจริง",
-		f.FieldID, f.AreaRai, len(stages),
-	)
+// noteUsage records the reply's model and token usage (if reported).
+func (c *openAI) noteUsage(ctx context.Context, model string, u *openAIUsage) {
+	ci := callInfoFrom(ctx)
+	if ci == nil {
+		return
+	}
+	if model == "" {
+		model = c.model
+	}
+	if u == nil {
+		u = &openAIUsage{}
+	}
+	ci.addUsage(model, u.PromptTokens, u.CompletionTokens)
+}
+
+
+// fallbackSummary is the offline summary (see offlineSummary) as of today,
+// in ctx's locale.
+func fallbackSummary(ctx context.Context, f *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) string {
+	return offlineSummary(f, stages, ops, kbCtx, i18n.FromContext(ctx), time.Now())
 }
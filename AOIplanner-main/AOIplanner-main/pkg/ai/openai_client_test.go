@@ -0,0 +1,40 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStreamNeedsEnd(t *testing.T) {
+	const (
+		hello  = `data: {"choices":[{"delta":{"content":"สวัส"}}]}` + "\n\n" + `data: {"choices":[{"delta":{"content":"ดี"}}]}` + "\n\n"
+		finish = `data: {"choices":[{"delta":{},"finish_reason":"stop"}]}` + "\n\n"
+	)
+	for _, tc := range []struct {
+		name, body string
+		err        error
+	}{
+		{"done", hello + "data: [DONE]\n\n", nil},
+		{"finish reason", hello + finish, nil},
+		{"cut off", hello, io.ErrUnexpectedEOF},
+	} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			io.WriteString(w, tc.body)
+		}))
+		api := newOpenAI("test-stream", srv.URL, "k", "m").(*chatClient).api
+		var deltas string
+		got, err := api.stream(context.Background(), []chatMsg{{Role: "user", Content: "hi"}}, func(d string) { deltas += d })
+		srv.Close()
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: err %v, want %v", tc.name, err, tc.err)
+		}
+		if got != "สวัสดี" || deltas != got {
+			t.Errorf("%s: got %q, deltas %q", tc.name, got, deltas)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package ai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"aoi/entities"
+	"aoi/pkg/plan/types"
+)
+
+// Limits for proposed actions; anything outside them is sent back to the
+// model for repair and finally dropped.
+const (
+	maxActions  = 8
+	maxTitleLen = 120
+	maxNotesLen = 500
+)
+
+// opTypes are the action types the planner knows how to place.
+var opTypes = []string{"irrigation", "fertilizer", "pesticide", "inspect", "advisory", "other"}
+
+// unitLimit is the largest sensible amount in a unit. Whole-field units are
+// checked against max × field area.
+type unitLimit struct {
+	max   float64
+	field bool
+}
+
+// opUnits lists the units accepted per action type, with their upper bound.
+// Types without units (inspect, advisory, other) take no quantity.
+var opUnits = map[string]map[string]unitLimit{
+	"irrigation": {"mm": {100, false}, "m3/rai": {160, false}, "m3": {160, true}},
+	"fertilizer": {"kg/rai": {150, false}, "kg": {150, true}},
+	"pesticide": {
+		"L/rai": {20, false}, "ml/rai": {20000, false}, "kg/rai": {20, false}, "g/rai": {20000, false},
+		"L": {20, true}, "ml": {20000, true}, "kg": {20, true}, "g": {20000, true},
+	},
+}
+
+// unitAliases maps common spellings (incl. Thai) to the canonical unit.
+var unitAliases = map[string]string{
+	"mm": "mm", "มม.": "mm", "มิลลิเมตร": "mm",
+	"m3": "m3", "m³": "m3", "ลบ.ม.": "m3", "cubic meter": "m3",
+	"kg": "kg", "กก.": "kg", "กิโลกรัม": "kg",
+	"g": "g", "กรัม": "g",
+	"l": "L", "liter": "L", "litre": "L", "ลิตร": "L",
+	"ml": "ml", "มล.": "ml", "มิลลิลิตร": "ml",
+}
+
+// normalizeUnit returns the canonical form of u ("kg/rai", "L", ...) or ""
+// when it is not recognised.
+func normalizeUnit(u string) string {
+	u = strings.ToLower(strings.TrimSpace(u))
+	perRai := false
+	for _, suf := range []string{"/rai", "/ไร่", " per rai", "ต่อไร่"} {
+		if strings.HasSuffix(u, suf) {
+			u, perRai = strings.TrimSpace(strings.TrimSuffix(u, suf)), true
+			break
+		}
+	}
+	base, ok := unitAliases[u]
+	if !ok {
+		return ""
+	}
+	if perRai {
+		return base + "/rai"
+	}
+	return base
+}
+
+// llmOp is one action as the model returns it.
+type llmOp struct {
+	Type  string   `json:"type"`
+	Title string   `json:"title"`
+	Qty   *float64 `json:"qty,omitempty"`
+	Unit  string   `json:"unit,omitempty"`
+	Notes string   `json:"notes,omitempty"`
+	Date  string   `json:"date,omitempty"` // chat tasks only (YYYY-MM-DD)
+}
+
+// proposeOpsSchema is the JSON schema of a ProposeOps reply, for endpoints
+// with structured output (strict mode: every property required, qty nullable).
+func proposeOpsSchema() map[string]any {
+	seen := map[string]bool{}
+	units := []string{}
+	for _, t := range opTypes {
+		for u := range opUnits[t] {
+			if !seen[u] {
+				seen[u] = true
+				units = append(units, u)
+			}
+		}
+	}
+	sort.Strings(units)
+	units = append([]string{""}, units...)
+	return map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"actions"},
+		"properties": map[string]any{
+			"actions": map[string]any{
+				"type":     "array",
+				"maxItems": maxActions,
+				"items": map[string]any{
+					"type":                 "object",
+					"additionalProperties": false,
+					"required":             []string{"type", "title", "qty", "unit", "notes"},
+					"properties": map[string]any{
+						"type":  map[string]any{"type": "string", "enum": opTypes},
+						"title": map[string]any{"type": "string"},
+						"qty":   map[string]any{"type": []string{"number", "null"}},
+						"unit":  map[string]any{"type": "string", "enum": units},
+						"notes": map[string]any{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// parseActions reads {"actions":[...]} or a bare array from a model reply,
+// tolerating Markdown code fences and prose around the JSON.
+func parseActions(content string) ([]llmOp, error) {
+	raw := extractJSON(content)
+	if raw == "" {
+		return nil, errors.New("reply contains no JSON")
+	}
+	var payload struct {
+		Actions []llmOp `json:"actions"`
+	}
+	if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+		var arr []llmOp
+		if err2 := json.Unmarshal([]byte(raw), &arr); err2 != nil {
+			return nil, fmt.Errorf("invalid JSON: %v", err)
+		}
+		payload.Actions = arr
+	}
+	return payload.Actions, nil
+}
+
+// extractJSON strips code fences and returns the outermost object or array.
+func extractJSON(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "```") {
+		if i := strings.Index(s, "\n"); i >= 0 {
+			s = s[i+1:]
+		}
+		if i := strings.LastIndex(s, "```"); i >= 0 {
+			s = s[:i]
+		}
+		s = strings.TrimSpace(s)
+	}
+	start := strings.IndexAny(s, "{[")
+	if start < 0 {
+		return ""
+	}
+	end := strings.LastIndex(s, map[byte]string{'{': "}", '[': "]"}[s[start]])
+	if end < start {
+		return ""
+	}
+	return s[start : end+1]
+}
+
+// validateOps checks each action against the allowed types, units and
+// ranges for the field. It returns the valid actions (type, unit normalized)
+// and one message per problem, numbered as in the reply.
+func validateOps(f *entities.Field, acts []llmOp) ([]types.PlanOp, []string) {
+	var problems []string
+	if len(acts) > maxActions {
+		problems = append(problems, fmt.Sprintf("too many actions (%d), at most %d", len(acts), maxActions))
+		acts = acts[:maxActions]
+	}
+	out := make([]types.PlanOp, 0, len(acts))
+	for i, a := range acts {
+		errs := []string{}
+		tp := strings.ToLower(strings.TrimSpace(a.Type))
+		if tp == "" {
+			tp = "advisory"
+		}
+		if !contains(opTypes, tp) {
+			errs = append(errs, fmt.Sprintf("type %q is not one of %s", a.Type, strings.Join(opTypes, "|")))
+		}
+		title := strings.TrimSpace(a.Title)
+		switch {
+		case title == "":
+			errs = append(errs, "title is empty")
+		case utf8.RuneCountInString(title) > maxTitleLen:
+			errs = append(errs, fmt.Sprintf("title longer than %d characters", maxTitleLen))
+		}
+		notes := strings.TrimSpace(a.Notes)
+		if utf8.RuneCountInString(notes) > maxNotesLen {
+			errs = append(errs, fmt.Sprintf("notes longer than %d characters", maxNotesLen))
+		}
+		unit := strings.TrimSpace(a.Unit)
+		if unit == "" && a.Qty != nil && tp == "irrigation" {
+			unit = "mm" // the planner's default irrigation unit
+		}
+		if contains(opTypes, tp) && (a.Qty != nil || unit != "") {
+			if msg := checkQty(f, tp, a.Qty, unit); msg != "" {
+				errs = append(errs, msg)
+			}
+			unit = normalizeUnit(unit)
+		}
+		if len(errs) > 0 {
+			problems = append(problems, fmt.Sprintf("actions[%d]: %s", i, strings.Join(errs, "; ")))
+			continue
+		}
+		out = append(out, types.PlanOp{Type: tp, Title: title, Qty: a.Qty, Unit: unit, Notes: notes})
+	}
+	return out, problems
+}
+
+func checkQty(f *entities.Field, tp string, qty *float64, unit string) string {
+	limits, ok := opUnits[tp]
+	if !ok {
+		return fmt.Sprintf("%s actions take no qty/unit", tp)
+	}
+	u := normalizeUnit(unit)
+	lim, ok := limits[u]
+	if !ok {
+		allowed := make([]string, 0, len(limits))
+		for k := range limits {
+			allowed = append(allowed, k)
+		}
+		sort.Strings(allowed)
+		return fmt.Sprintf("unit %q not allowed for %s (use one of %s)", unit, tp, strings.Join(allowed, ", "))
+	}
+	if qty == nil {
+		return "" // the planner fills in a default amount
+	}
+	max := lim.max
+	if lim.field && f != nil && f.AreaRai > 0 {
+		max *= f.AreaRai
+	}
+	if *qty <= 0 || *qty > max {
+		return fmt.Sprintf("qty %g %s out of range (0, %g]", *qty, u, max)
+	}
+	return ""
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
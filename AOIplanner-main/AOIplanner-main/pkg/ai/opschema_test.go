@@ -0,0 +1,122 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"aoi/entities"
+)
+
+// scriptedLLM is a chat completions endpoint that returns its replies in
+// turn and records the messages it was sent.
+type scriptedLLM struct {
+	replies []string
+	sent    [][]chatMsg
+}
+
+func (s *scriptedLLM) client(t *testing.T) Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Messages []chatMsg `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("request body: %v", err)
+		}
+		s.sent = append(s.sent, req.Messages)
+		reply := s.replies[0]
+		if len(s.replies) > 1 {
+			s.replies = s.replies[1:]
+		}
+		json.NewEncoder(w).Encode(map[string]any{"choices": []any{map[string]any{"message": map[string]string{"content": reply}}}})
+	}))
+	t.Cleanup(srv.Close)
+	return NewOpenAI(srv.URL, "test", "test-model")
+}
+
+func TestParseActions(t *testing.T) {
+	for _, reply := range []string{
+		`{"actions":[{"type":"inspect","title":"ดูใบ"}]}`,
+		"```json\n{\"actions\":[{\"type\":\"inspect\",\"title\":\"ดูใบ\"}]}\n```",
+		`Here you go: [{"type":"inspect","title":"ดูใบ"}] hope it helps`,
+	} {
+		acts, err := parseActions(reply)
+		if err != nil || len(acts) != 1 || acts[0].Title != "ดูใบ" {
+			t.Errorf("parseActions(%q) = %+v, %v", reply, acts, err)
+		}
+	}
+	if _, err := parseActions("ไม่มีข้อมูล"); err == nil {
+		t.Error("want an error for a reply without JSON")
+	}
+}
+
+func TestValidateOps(t *testing.T) {
+	f := &entities.Field{AreaRai: 10}
+	q := func(v float64) *float64 { return &v }
+	ok, problems := validateOps(f, []llmOp{
+		{Type: "Fertilizer", Title: "ใส่ปุ๋ย", Qty: q(50), Unit: "กก./ไร่"},
+		{Type: "irrigation", Title: "ให้น้ำ", Qty: q(30)},                 // mm by default
+		{Type: "fertilizer", Title: "ทั้งแปลง", Qty: q(1400), Unit: "kg"}, // 150 kg × 10 rai
+		{Type: "spray", Title: "x"},
+		{Type: "fertilizer", Title: "มากไป", Qty: q(151), Unit: "kg/rai"},
+		{Type: "inspect", Title: "ดู", Qty: q(1), Unit: "kg"},
+		{Type: "pesticide", Title: "พ่น", Qty: q(1), Unit: "bucket"},
+		{Type: "advisory", Title: " "},
+	})
+	if len(ok) != 3 || ok[0].Type != "fertilizer" || ok[0].Unit != "kg/rai" || ok[1].Unit != "mm" {
+		t.Errorf("valid actions: %+v", ok)
+	}
+	want := []string{"actions[3]: type", "actions[4]: qty 151", "actions[5]: inspect actions take no", "actions[6]: unit \"bucket\"", "actions[7]: title is empty"}
+	if len(problems) != len(want) {
+		t.Fatalf("problems %q", problems)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(problems[i], w) {
+			t.Errorf("problem %d = %q, want %q…", i, problems[i], w)
+		}
+	}
+}
+
+func TestProposeOpsRepair(t *testing.T) {
+	api := &scriptedLLM{replies: []string{
+		`{"actions":[{"type":"spray","title":"พ่นยา"},{"type":"inspect","title":"ดูใบ"}]}`,
+		`{"actions":[{"type":"pesticide","title":"พ่นยา","qty":1,"unit":"L/rai"},{"type":"inspect","title":"ดูใบ"}]}`,
+	}}
+	c := api.client(t)
+	ops, err := c.ProposeOps(context.Background(), &entities.Field{AreaRai: 5}, nil, nil, []string{"หนอนกอ"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(api.sent) != 2 {
+		t.Fatalf("%d calls, want one repair", len(api.sent))
+	}
+	repair := api.sent[1][len(api.sent[1])-1].Content
+	if !strings.Contains(repair, `actions[0]: type "spray"`) {
+		t.Errorf("repair request does not quote the problem: %q", repair)
+	}
+	if len(ops) != 2 || ops[0].Type != "pesticide" || ops[0].Unit != "L/rai" {
+		t.Errorf("ops %+v", ops)
+	}
+}
+
+func TestProposeOpsGivesUp(t *testing.T) {
+	api := &scriptedLLM{replies: []string{`{"actions":[{"type":"spray","title":"พ่นยา"}]}`}}
+	c := api.client(t)
+	if _, err := c.ProposeOps(context.Background(), &entities.Field{}, nil, nil, nil, ""); err == nil {
+		t.Fatal("want an error when no action is ever valid")
+	}
+	if len(api.sent) != 1+maxRepairs {
+		t.Errorf("%d calls, want %d", len(api.sent), 1+maxRepairs)
+	}
+
+	// valid actions survive next to ones that stay invalid, plus an inspect
+	api = &scriptedLLM{replies: []string{`{"actions":[{"type":"spray","title":"x"},{"type":"advisory","title":"ระวังน้ำขัง"}]}`}}
+	ops, err := api.client(t).ProposeOps(context.Background(), &entities.Field{}, nil, nil, nil, "")
+	if err != nil || len(ops) != 2 || ops[0].Type != "advisory" || ops[1].Type != "inspect" {
+		t.Errorf("ops %+v, %v", ops, err)
+	}
+}
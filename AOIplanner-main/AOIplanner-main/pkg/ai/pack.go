@@ -0,0 +1,201 @@
+// pkg/ai/pack.go
+
+package ai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+)
+
+// DefaultContextTokens is the prompt context budget when none is configured.
+const DefaultContextTokens = 3000
+
+// Shares of the context budget. The field table and recent measurements are
+// small and always sent whole; whatever stages and ops leave over goes to
+// the KB passages.
+const (
+	stagesShare = 0.15
+	opsShare    = 0.35
+
+	stageNotesRunes = 60 // stage notes are shortened to this first
+)
+
+var contextTokens = DefaultContextTokens
+
+// SetContextTokens sets the token budget for the field, stage, op and KB
+// context of every prompt (0 restores the default).
+func SetContextTokens(n int) {
+	if n <= 0 {
+		n = DefaultContextTokens
+	}
+	contextTokens = n
+}
+
+// EstimateTokens approximates how many tokens s costs. BPE vocabularies
+// split Thai much finer than English, so Thai letters count about one
+// token per 1.5 runes against four bytes of ASCII.
+func EstimateTokens(s string) int {
+	var ascii, thai, other int
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			ascii++
+		case unicode.Is(unicode.Thai, r):
+			thai++
+		default:
+			other++
+		}
+	}
+	return (ascii+3)/4 + (thai*2+2)/3 + (other+1)/2
+}
+
+// packContext fits d's variable-size context into budget tokens: stage
+// notes are shortened, ops are summarised by month (then cut from the end),
+// and KB passages and chat sources are kept whole in relevance order until
+// the rest of the budget is used. Monthly rows are written in loc. It returns
+// what it cut, for the audit log.
+func packContext(d promptData, loc string, budget int) (promptData, []string) {
+	var cut []string
+	used := EstimateTokens(fieldTable(d.Field)) + EstimateTokens(measTable(d.Measurements))
+
+	if limit := int(float64(budget) * stagesShare); EstimateTokens(stagesTable(d.Stages)) > limit {
+		short := make([]types.StagePlan, len(d.Stages))
+		for i, st := range d.Stages {
+			st.Notes = truncate(st.Notes, stageNotesRunes)
+			short[i] = st
+		}
+		d.Stages = short
+		cut = append(cut, fmt.Sprintf("stages: notes shortened to %d characters", stageNotesRunes))
+	}
+	used += EstimateTokens(stagesTable(d.Stages))
+
+	if limit := int(float64(budget) * opsShare); EstimateTokens(opsTable(d.Ops)) > limit {
+		monthly := opsByMonth(d.Ops, loc)
+		cut = append(cut, fmt.Sprintf("ops: %d tasks summarised into %d monthly rows", len(d.Ops), len(monthly)))
+		n := len(monthly)
+		for n > 1 && EstimateTokens(opsTable(monthly[:n])) > limit {
+			n--
+		}
+		if n < len(monthly) {
+			cut = append(cut, fmt.Sprintf("ops: monthly rows after %s dropped (%d)", monthly[n-1].Date, len(monthly)-n))
+		}
+		d.Ops = monthly[:n]
+	}
+	used += EstimateTokens(opsTable(d.Ops))
+
+	rest := budget - used
+	if d.KB != "" {
+		var note string
+		d.KB, note = packPassages(d.KB, rest)
+		if note != "" {
+			cut = append(cut, note)
+		}
+		rest -= EstimateTokens(d.KB)
+	}
+	if len(d.Sources) > 0 {
+		var kept []ChatSource
+		var dropped []string
+		for _, s := range d.Sources {
+			if t := EstimateTokens(s.Title + "\n" + s.Text); t <= rest {
+				kept = append(kept, s)
+				rest -= t
+			} else {
+				dropped = append(dropped, fmt.Sprintf("[%d]", s.N))
+			}
+		}
+		if len(dropped) > 0 {
+			cut = append(cut, "sources: dropped "+strings.Join(dropped, " "))
+		}
+		d.Sources = kept
+	}
+	return d, cut
+}
+
+// packPassages keeps the passages of kbCtx (see KBPassage) that fit in
+// budget tokens, whole and in order; callers list them best first. If not
+// even the first fits, it is cut short rather than sending no KB at all.
+func packPassages(kbCtx string, budget int) (string, string) {
+	parts := strings.Split(kbCtx, "\n---\n")
+	var b strings.Builder
+	kept, dropped := 0, 0
+	for _, p := range parts {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		if EstimateTokens(b.String()+"\n---\n"+p) <= budget {
+			b.WriteString("\n---\n" + p)
+			kept++
+		} else {
+			dropped++
+		}
+	}
+	switch {
+	case dropped == 0:
+		return kbCtx, ""
+	case kept == 0 && budget > 0:
+		first := strings.TrimSpace(parts[0])
+		if first == "" && len(parts) > 1 {
+			first = parts[1]
+		}
+		for EstimateTokens(first) > budget && first != "" {
+			first = truncate(first, utf8.RuneCountInString(first)*9/10)
+		}
+		return "\n---\n" + first, fmt.Sprintf("kb: first passage cut to %d tokens, %d dropped", EstimateTokens(first), dropped-1)
+	}
+	return b.String(), fmt.Sprintf("kb: kept %d passages, dropped %d over budget", kept, dropped)
+}
+
+// opsByMonth folds ops into one row per month and type, with the count in
+// Notes (in loc) and the quantities summed when they share a unit.
+func opsByMonth(ops []types.PlanOp, loc string) []types.PlanOp {
+	type key struct{ month, typ string }
+	var order []key
+	rows := map[key]*types.PlanOp{}
+	counts := map[key]int{}
+	titles := map[key][]string{}
+	mixed := map[key]bool{}
+	for _, op := range ops {
+		k := key{op.Date, op.Type}
+		if len(op.Date) >= 7 {
+			k.month = op.Date[:7]
+		}
+		r, ok := rows[k]
+		if !ok {
+			r = &types.PlanOp{Date: k.month, Type: op.Type, Unit: op.Unit}
+			rows[k] = r
+			order = append(order, k)
+		}
+		counts[k]++
+		if !contains(titles[k], op.Title) {
+			titles[k] = append(titles[k], op.Title)
+		}
+		switch {
+		case op.Qty == nil:
+		case r.Qty == nil && !mixed[k]:
+			q := *op.Qty
+			r.Qty, r.Unit = &q, op.Unit
+		case r.Qty != nil && r.Unit == op.Unit:
+			*r.Qty += *op.Qty
+		default:
+			r.Qty, r.Unit, mixed[k] = nil, "", true
+		}
+	}
+	out := make([]types.PlanOp, 0, len(order))
+	for _, k := range order {
+		r := rows[k]
+		ts := titles[k]
+		if len(ts) > 2 {
+			ts = append(ts[:2:2], "…")
+		}
+		r.Title = strings.Join(ts, ", ")
+		r.Notes = i18n.T(loc, "pack.times", map[string]string{"n": strconv.Itoa(counts[k])})
+		out = append(out, *r)
+	}
+	return out
+}
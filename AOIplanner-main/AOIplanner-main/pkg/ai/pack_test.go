@@ -0,0 +1,127 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		want int
+	}{
+		{"", 0},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"ก", 1},
+		{"กขค", 2},     // 1.5 Thai runes per token
+		{"ไร่อ้อย", 5}, // combining marks count as runes
+		{"é", 1},
+		{"ab ก", 2},
+	} {
+		if got := EstimateTokens(tc.s); got != tc.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tc.s, got, tc.want)
+		}
+	}
+}
+
+func kbOf(texts ...string) string {
+	var b strings.Builder
+	for i, s := range texts {
+		b.WriteString(KBPassage("doc "+string(rune('A'+i)), s))
+	}
+	return b.String()
+}
+
+func TestPackPassages(t *testing.T) {
+	a, b, c := strings.Repeat("ใส่ปุ๋ย ", 40), strings.Repeat("ให้น้ำ ", 40), strings.Repeat("ตัดอ้อย ", 40)
+	kb := kbOf(a, b, c)
+
+	if got, note := packPassages(kb, EstimateTokens(kb)); got != kb || note != "" {
+		t.Errorf("everything fits: got note %q", note)
+	}
+
+	two := kbOf(a, b)
+	got, note := packPassages(kb, EstimateTokens(two))
+	if got != two || note != "kb: kept 2 passages, dropped 1 over budget" {
+		t.Errorf("two fit: got %d tokens, note %q", EstimateTokens(got), note)
+	}
+
+	// the budget fits only part of the first passage: it is cut, not dropped
+	budget := EstimateTokens(kbOf(a)) / 3
+	got, note = packPassages(kb, budget)
+	first := strings.TrimPrefix(got, "\n---\n")
+	if !strings.HasPrefix(note, "kb: first passage cut to ") || !strings.HasSuffix(note, ", 2 dropped") {
+		t.Errorf("note %q", note)
+	}
+	if !strings.HasPrefix(first, "## doc A\n") || !strings.HasSuffix(first, "…") {
+		t.Errorf("want the head of the first passage, got %q", first)
+	}
+	if n := EstimateTokens(first); n > budget || n < budget/2 {
+		t.Errorf("first passage cut to %d tokens for a budget of %d", n, budget)
+	}
+	if strings.Contains(got, "ให้น้ำ") || strings.Contains(got, "ตัดอ้อย") {
+		t.Error("later passages kept")
+	}
+
+	if got, _ := packPassages(kb, 0); got != "" {
+		t.Errorf("no budget: got %q", got)
+	}
+}
+
+// seasonOps is a daily irrigation op from June to August.
+func seasonOps() []types.PlanOp {
+	var ops []types.PlanOp
+	for d := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC); d.Month() < 9; d = d.AddDate(0, 0, 1) {
+		q := 10.0
+		ops = append(ops, types.PlanOp{Date: d.Format("2006-01-02"), Type: "irrigation", Title: "ให้น้ำ", Qty: &q, Unit: "mm"})
+	}
+	return ops
+}
+
+func TestPackContextOpsByMonth(t *testing.T) {
+	d := promptData{Field: &entities.Field{FieldID: 1, AreaRai: 5}, Ops: seasonOps()}
+	budget := EstimateTokens(opsTable(d.Ops)) // ops get opsShare of it: too small for daily rows
+
+	for _, tc := range []struct{ loc, june string }{{i18n.EN, "30 times"}, {i18n.TH, "30 ครั้ง"}} {
+		got, cut := packContext(d, tc.loc, budget)
+		if len(got.Ops) != 3 {
+			t.Fatalf("%s: want 3 monthly rows, got %d", tc.loc, len(got.Ops))
+		}
+		june := got.Ops[0]
+		if june.Date != "2026-06" || june.Notes != tc.june || june.Qty == nil || *june.Qty != 300 {
+			t.Errorf("%s: June row %+v", tc.loc, june)
+		}
+		if len(cut) == 0 || cut[0] != "ops: 92 tasks summarised into 3 monthly rows" {
+			t.Errorf("%s: cut %q", tc.loc, cut)
+		}
+	}
+
+	// a budget that fits one monthly row keeps the earliest
+	got, cut := packContext(d, i18n.EN, int(float64(EstimateTokens(opsTable(opsByMonth(d.Ops, i18n.EN)[:1])))/opsShare)+1)
+	if len(got.Ops) != 1 || got.Ops[0].Date != "2026-06" {
+		t.Errorf("want only June, got %+v", got.Ops)
+	}
+	if cut[len(cut)-1] != "ops: monthly rows after 2026-06 dropped (2)" {
+		t.Errorf("cut %q", cut)
+	}
+}
+
+func TestPackContextWithinBudget(t *testing.T) {
+	d := promptData{Field: &entities.Field{FieldID: 1}, Ops: seasonOps()[:3], KB: kbOf("ให้น้ำ", "ใส่ปุ๋ย")}
+	got, cut := packContext(d, i18n.EN, 100000)
+	if len(cut) != 0 || len(got.Ops) != 3 || got.KB != d.KB {
+		t.Errorf("nothing should be cut: %q", cut)
+	}
+
+	d.Sources = []ChatSource{{N: 1, Title: "a", Text: "short"}, {N: 2, Title: "b", Text: strings.Repeat("ยาวมาก ", 2000)}}
+	got, cut = packContext(d, i18n.EN, 1000)
+	if len(got.Sources) != 1 || got.Sources[0].N != 1 || cut[len(cut)-1] != "sources: dropped [2]" {
+		t.Errorf("sources %+v, cut %q", got.Sources, cut)
+	}
+}
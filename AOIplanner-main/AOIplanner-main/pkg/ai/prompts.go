@@ -0,0 +1,383 @@
+// pkg/ai/prompts.go
+
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"aoi/entities"
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+)
+
+// Prompt kinds. Each kind has one or more versioned templates, named
+// "<kind>/<n>" with {{define}} in a .tmpl file.
+const (
+	PromptSummary    = "summary"
+	PromptProposeOps = "propose_ops"
+	PromptChat       = "chat"
+	PromptDiagnose   = "diagnose"
+)
+
+var promptKinds = []string{PromptSummary, PromptProposeOps, PromptChat, PromptDiagnose}
+
+//go:embed prompts/*.tmpl
+var promptFS embed.FS
+
+// promptData is what a template sees.
+type promptData struct {
+	Field       *entities.Field
+	Stages      []types.StagePlan
+	Ops         []types.PlanOp
+	Problems    []string
+	KB          string
+	MaxActions  int
+	MaxTitleLen int
+	Language    string // language to answer in, named in Thai; set by renderPrompt
+
+	// chat and diagnose (Question is then the farmer's note)
+	Today        string
+	Measurements []entities.Measurement
+	Sources      []ChatSource
+	Question     string
+}
+
+type promptTmpl struct {
+	id     string // e.g. "summary/2"
+	file   string
+	digest string // hash of the template source; part of cache keys
+	t      *template.Template
+}
+
+// promptSet is the loaded templates plus, per kind, the versions in use.
+// With more than one version in use, fields are split between them by ID so
+// the versions can be compared on the same kind of fields.
+type promptSet struct {
+	byID   map[string]*promptTmpl
+	active map[string][]string
+}
+
+var (
+	promptsMu sync.RWMutex
+	prompts   = mustLoadPrompts("", nil)
+)
+
+// LoadPrompts replaces the prompt templates: the built-in ones, overridden
+// or extended by the .tmpl files in dir (if set). active picks the versions
+// per kind; kinds not listed use their highest version.
+func LoadPrompts(dir string, active map[string][]string) error {
+	ps, err := loadPrompts(dir, active)
+	if err != nil {
+		return err
+	}
+	promptsMu.Lock()
+	prompts = ps
+	promptsMu.Unlock()
+	return nil
+}
+
+func mustLoadPrompts(dir string, active map[string][]string) *promptSet {
+	ps, err := loadPrompts(dir, active)
+	if err != nil {
+		panic(err)
+	}
+	return ps
+}
+
+func loadPrompts(dir string, active map[string][]string) (*promptSet, error) {
+	ps := &promptSet{byID: map[string]*promptTmpl{}, active: map[string][]string{}}
+	if err := ps.parseFS(promptFS, "prompts"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := ps.parseFS(os.DirFS(dir), "."); err != nil {
+			return nil, err
+		}
+	}
+	for _, kind := range promptKinds {
+		ids := active[kind]
+		if len(ids) == 0 {
+			ids = []string{ps.latest(kind)}
+		}
+		for _, id := range ids {
+			if !strings.HasPrefix(id, kind+"/") {
+				id = kind + "/" + id
+			}
+			if ps.byID[id] == nil {
+				return nil, fmt.Errorf("prompt %s: no such template (have %s)", id, strings.Join(ps.versions(kind), ", "))
+			}
+			ps.active[kind] = append(ps.active[kind], id)
+		}
+	}
+	return ps, nil
+}
+
+// parseFS reads every .tmpl file under root. A file may define several
+// versions; a version defined again (in a later file) replaces the earlier.
+func (ps *promptSet) parseFS(fsys fs.FS, root string) error {
+	files, err := fs.Glob(fsys, path.Join(root, "*.tmpl"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		t, err := template.New(path.Base(file)).Funcs(promptFuncs).Option("missingkey=error").ParseFS(fsys, file)
+		if err != nil {
+			return fmt.Errorf("prompt %s: %w", file, err)
+		}
+		for _, d := range t.Templates() {
+			kind, n, ok := strings.Cut(d.Name(), "/")
+			if !ok || d.Tree == nil {
+				continue
+			}
+			if _, err := strconv.Atoi(n); err != nil {
+				return fmt.Errorf("prompt %s: template %q: version must be <kind>/<number>", file, d.Name())
+			}
+			if !contains(promptKinds, kind) {
+				return fmt.Errorf("prompt %s: unknown kind %q", file, kind)
+			}
+			sum := sha256.Sum256([]byte(d.Tree.Root.String()))
+			ps.byID[d.Name()] = &promptTmpl{id: d.Name(), file: file, digest: hex.EncodeToString(sum[:8]), t: t.Lookup(d.Name())}
+		}
+	}
+	return nil
+}
+
+// versions lists a kind's template IDs by version number.
+func (ps *promptSet) versions(kind string) []string {
+	var ids []string
+	for id := range ps.byID {
+		if strings.HasPrefix(id, kind+"/") {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return promptNum(ids[i]) < promptNum(ids[j]) })
+	return ids
+}
+
+func (ps *promptSet) latest(kind string) string {
+	ids := ps.versions(kind)
+	if len(ids) == 0 {
+		return kind + "/?"
+	}
+	return ids[len(ids)-1]
+}
+
+func promptNum(id string) int {
+	_, n, _ := strings.Cut(id, "/")
+	v, _ := strconv.Atoi(n)
+	return v
+}
+
+// pickPrompt returns the template a field gets for kind.
+func pickPrompt(kind string, f *entities.Field) *promptTmpl {
+	promptsMu.RLock()
+	defer promptsMu.RUnlock()
+	ids := prompts.active[kind]
+	id := ids[0]
+	if len(ids) > 1 && f != nil {
+		id = ids[int(f.FieldID)%len(ids)]
+	}
+	return prompts.byID[id]
+}
+
+// renderPrompt packs d into the context budget (see packContext), renders
+// the field's template for kind in ctx's locale and notes its version and
+// any cuts in ctx's CallInfo.
+func renderPrompt(ctx context.Context, kind string, d promptData) (string, error) {
+	p := pickPrompt(kind, d.Field)
+	loc := i18n.FromContext(ctx)
+	d.Language = i18n.T(i18n.TH, "language."+loc, nil)
+	d.Ops = append([]types.PlanOp(nil), d.Ops...)
+	i18n.LocalizeOps(d.Ops, loc)
+	d, cut := packContext(d, loc, contextTokens)
+	if len(cut) > 0 {
+		log.Printf("[llm] %s context over %d tokens: %s", p.id, contextTokens, strings.Join(cut, "; "))
+	}
+	var sb strings.Builder
+	if err := p.t.Execute(&sb, d); err != nil {
+		return "", fmt.Errorf("prompt %s: %w", p.id, err)
+	}
+	if ci := callInfoFrom(ctx); ci != nil {
+		ci.Prompt, ci.Truncated = p.id, cut
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// PromptInfo describes a loaded template for GET /llm/prompts.
+type PromptInfo struct {
+	ID     string `json:"id"`
+	File   string `json:"file"`
+	Digest string `json:"digest"`
+	Active bool   `json:"active"`
+}
+
+func Prompts() []PromptInfo {
+	promptsMu.RLock()
+	defer promptsMu.RUnlock()
+	var out []PromptInfo
+	for _, kind := range promptKinds {
+		for _, id := range prompts.versions(kind) {
+			p := prompts.byID[id]
+			out = append(out, PromptInfo{ID: id, File: p.file, Digest: p.digest, Active: contains(prompts.active[kind], id)})
+		}
+	}
+	return out
+}
+
+// Thai labels used in the prompt tables.
+var (
+	cropTypeTH   = map[string]string{"new_plant": "อ้อยปลูกใหม่", "ratoon": "อ้อยตอ"}
+	soilTH       = map[string]string{"sand": "ดินทราย", "loam": "ดินร่วน", "clay": "ดินเหนียว"}
+	irrigSrcTH   = map[string]string{"well": "บ่อบาดาล", "surface": "แหล่งน้ำผิวดิน", "none": "ไม่มี (อาศัยน้ำฝน)"}
+	budgetTH     = map[string]string{"low": "ต่ำ", "med": "ปานกลาง", "high": "สูง"}
+	fertBaseTH   = map[string]string{"organic": "อินทรีย์", "chemical": "เคมี", "mixed": "ผสม"}
+	moistTH      = map[string]string{"dry": "แห้ง", "ok": "พอดี", "wet": "แฉะ"}
+	promptTypeTH = map[string]string{
+		"irrigation": "ให้น้ำ", "fertilizer": "ใส่ปุ๋ย", "pesticide": "ป้องกันศัตรูพืช", "pest": "ป้องกันศัตรูพืช",
+		"inspect": "สำรวจ", "observe": "วัด/บันทึก", "advisory": "คำแนะนำ", "other": "อื่น ๆ",
+	}
+)
+
+var promptFuncs = template.FuncMap{
+	"fieldTable":  fieldTable,
+	"stagesTable": stagesTable,
+	"opsTable":    opsTable,
+	"measTable":   measTable,
+	"units": func(tp string) string {
+		us := make([]string, 0, len(opUnits[tp]))
+		for u := range opUnits[tp] {
+			us = append(us, u)
+		}
+		sort.Strings(us)
+		return strings.Join(us, ", ")
+	},
+	"opTypes": func() []string { return opTypes },
+	"join":    strings.Join,
+}
+
+func label(m map[string]string, v string) string {
+	if v == "" {
+		return "-"
+	}
+	if l, ok := m[v]; ok {
+		return l
+	}
+	return v
+}
+
+// num prints v with at most two decimals.
+func num(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// cell makes v safe inside a Markdown table cell.
+func cell(v string) string {
+	v = strings.TrimSpace(strings.NewReplacer("|", "/", "\r", " ", "\n", " ").Replace(v))
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+func table(head []string, rows [][]string) string {
+	var sb strings.Builder
+	sb.WriteString("| " + strings.Join(head, " | ") + " |\n|")
+	for range head {
+		sb.WriteString("---|")
+	}
+	for _, r := range rows {
+		for i := range r {
+			r[i] = cell(r[i])
+		}
+		sb.WriteString("\n| " + strings.Join(r, " | ") + " |")
+	}
+	return sb.String()
+}
+
+func fieldTable(f *entities.Field) string {
+	if f == nil {
+		return "(ไม่มีข้อมูลแปลง)"
+	}
+	pump := "-"
+	if f.PumpM3H != nil {
+		pump = num(*f.PumpM3H) + " ลบ.ม./ชม."
+	}
+	planted := "-"
+	if !f.PlantingDate.IsZero() {
+		planted = f.PlantingDate.Format("2006-01-02")
+	}
+	return table([]string{"รายการ", "ข้อมูล"}, [][]string{
+		{"พันธุ์อ้อย", f.Variety},
+		{"ประเภท", label(cropTypeTH, f.CropType)},
+		{"พื้นที่", num(f.AreaRai) + " ไร่"},
+		{"ที่ตั้ง", strings.TrimSpace(f.District + " " + f.Province)},
+		{"ชนิดดิน", label(soilTH, f.SoilTexture)},
+		{"แหล่งน้ำ", label(irrigSrcTH, f.IrrigationSrc)},
+		{"กำลังปั๊ม", pump},
+		{"งบประมาณ", label(budgetTH, f.BudgetTier)},
+		{"ปุ๋ยหลัก", label(fertBaseTH, f.FertBase)},
+		{"วันปลูก", planted},
+	})
+}
+
+func stagesTable(stages []types.StagePlan) string {
+	if len(stages) == 0 {
+		return "(ไม่มี)"
+	}
+	rows := make([][]string, 0, len(stages))
+	for _, s := range stages {
+		rows = append(rows, []string{s.Stage, s.StartDate, s.EndDate, num(s.WaterMMDay), s.Notes})
+	}
+	return table([]string{"ระยะ", "เริ่ม", "สิ้นสุด", "น้ำ (มม./วัน)", "หมายเหตุ"}, rows)
+}
+
+func opsTable(ops []types.PlanOp) string {
+	if len(ops) == 0 {
+		return "(ไม่มี)"
+	}
+	rows := make([][]string, 0, len(ops))
+	for _, o := range ops {
+		qty := ""
+		if o.Qty != nil {
+			qty = strings.TrimSpace(num(*o.Qty) + " " + o.Unit)
+		}
+		rows = append(rows, []string{o.Date, label(promptTypeTH, o.Type), o.Title, qty, o.Notes})
+	}
+	return table([]string{"วันที่", "ประเภท", "งาน", "ปริมาณ", "หมายเหตุ"}, rows)
+}
+
+func measTable(ms []entities.Measurement) string {
+	if len(ms) == 0 {
+		return "(ไม่มี)"
+	}
+	optNum := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return num(*v)
+	}
+	rows := make([][]string, 0, len(ms))
+	for _, m := range ms {
+		pest := ""
+		if m.PestScale != nil {
+			pest = strconv.Itoa(*m.PestScale)
+		}
+		rows = append(rows, []string{m.Date.Format("2006-01-02"), optNum(m.CaneHeightCM), optNum(m.SoilMoistPct), label(moistTH, m.MoistState), optNum(m.RainfallMM), pest, m.Note})
+	}
+	return table([]string{"วันที่", "ความสูง (ซม.)", "ความชื้นดิน (%)", "สภาพดิน", "ฝน (มม.)", "ศัตรูพืช (0-3)", "บันทึก"}, rows)
+}
@@ -0,0 +1,189 @@
+// pkg/ai/providers.go
+
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"aoi/pkg/outbound"
+)
+
+// ProviderConfig describes one LLM backend. Kind selects the protocol; the
+// other fields are interpreted per kind (see providerKinds).
+type ProviderConfig struct {
+	Name       string
+	Kind       string // openai | azure | ollama | llamacpp | mock
+	Endpoint   string
+	APIKey     string
+	Model      string // for azure: the deployment name
+	APIVersion string // azure only
+
+	// USD per million tokens, for the audit log's cost column (0 = unknown/free).
+	PriceIn, PriceOut float64
+}
+
+// outboundFor is the shared HTTP client of the named provider: retries,
+// breaker and concurrency limit are per provider, not per chain.
+func outboundFor(name string) *outbound.Client { return outbound.New(outboundTarget(name)) }
+
+func outboundTarget(name string) string { return "llm:" + name }
+
+// ProviderFactory builds a Client from its config.
+type ProviderFactory func(pc ProviderConfig) (Client, error)
+
+var (
+	kindsMu       sync.RWMutex
+	providerKinds = map[string]ProviderFactory{
+		"openai":   newOpenAIProvider,
+		"azure":    newAzureProvider,
+		"ollama":   newOllamaProvider,
+		"llamacpp": newLlamaCppProvider,
+		"mock":     func(ProviderConfig) (Client, error) { return NewMock(), nil },
+	}
+)
+
+// RegisterProvider adds (or replaces) a provider kind.
+func RegisterProvider(kind string, f ProviderFactory) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	providerKinds[kind] = f
+}
+
+// ProviderKinds lists the registered kinds.
+func ProviderKinds() []string {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	out := make([]string, 0, len(providerKinds))
+	for k := range providerKinds {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// NewProvider builds the client for pc.Kind.
+func NewProvider(pc ProviderConfig) (Client, error) {
+	kindsMu.RLock()
+	f, ok := providerKinds[pc.Kind]
+	kindsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("llm provider %q: unknown kind %q (one of %s)", pc.Name, pc.Kind, strings.Join(ProviderKinds(), ", "))
+	}
+	c, err := f(pc)
+	if err != nil {
+		return nil, fmt.Errorf("llm provider %q: %w", pc.Name, err)
+	}
+	return c, nil
+}
+
+func newOpenAIProvider(pc ProviderConfig) (Client, error) {
+	if pc.Endpoint == "" {
+		pc.Endpoint = "https://api.openai.com"
+	}
+	if pc.APIKey == "" || pc.Model == "" {
+		return nil, fmt.Errorf("openai needs an API key and a model")
+	}
+	return newOpenAI(pc.Name, pc.Endpoint, pc.APIKey, pc.Model), nil
+}
+
+// newAzureProvider targets an Azure OpenAI deployment: the deployment is in
+// the path, the API version in the query and the key in an api-key header.
+func newAzureProvider(pc ProviderConfig) (Client, error) {
+	if pc.Endpoint == "" || pc.APIKey == "" || pc.Model == "" {
+		return nil, fmt.Errorf("azure needs an endpoint, an API key and a deployment (model)")
+	}
+	if pc.APIVersion == "" {
+		pc.APIVersion = "2024-08-01-preview"
+	}
+	return &chatClient{api: &openAI{
+		url: strings.TrimRight(pc.Endpoint, "/") + "/openai/deployments/" + url.PathEscape(pc.Model) +
+			"/chat/completions?api-version=" + url.QueryEscape(pc.APIVersion),
+		header: map[string]string{"api-key": pc.APIKey},
+		model:  pc.Model,
+		httpc:  outboundFor(pc.Name),
+	}}, nil
+}
+
+func newOllamaProvider(pc ProviderConfig) (Client, error) {
+	if pc.Endpoint == "" {
+		pc.Endpoint = "http://localhost:11434"
+	}
+	if pc.Model == "" {
+		return nil, fmt.Errorf("ollama needs a model")
+	}
+	return &chatClient{api: newOllama(pc.Name, pc.Endpoint, pc.Model)}, nil
+}
+
+// newLlamaCppProvider targets llama.cpp's server, which serves the OpenAI
+// protocol for whatever model it was started with; the key is optional.
+func newLlamaCppProvider(pc ProviderConfig) (Client, error) {
+	if pc.Endpoint == "" {
+		return nil, fmt.Errorf("llamacpp needs an endpoint")
+	}
+	header := map[string]string{}
+	if pc.APIKey != "" {
+		header["Authorization"] = "Bearer " + pc.APIKey
+	}
+	return &chatClient{api: &openAI{
+		url:    strings.TrimRight(pc.Endpoint, "/") + "/v1/chat/completions",
+		header: header,
+		model:  pc.Model,
+		httpc:  outboundFor(pc.Name),
+	}}, nil
+}
+
+// CallInfo records which provider served a call and with which prompt
+// template. Attach one with WithCallInfo before calling a Client and read it
+// afterwards.
+type CallInfo struct {
+	Provider string   // "" when no provider answered (the result is a fallback)
+	Tried    []string // providers that failed before, in order
+	Prompt   string   // prompt template version, e.g. "summary/2"
+
+	Truncated []string // context cut to fit the token budget (see packContext)
+
+	// Filled in by the wire protocol for the audit log (see Audit).
+	Model            string
+	PromptHash       string // sha256 of the rendered messages
+	Request          string // rendered user prompt
+	Response         string // raw model reply (last one when repaired)
+	PromptTokens     int    // summed over attempts and repairs
+	CompletionTokens int
+
+	PlanID *uint // set by the caller when the call is for an existing plan
+	CallID uint  // audit row written for the call (0 when not audited)
+}
+
+// addUsage records the token usage of one model reply.
+func (ci *CallInfo) addUsage(model string, prompt, completion int) {
+	ci.Model = model
+	ci.PromptTokens += prompt
+	ci.CompletionTokens += completion
+}
+
+type callInfoKey struct{}
+
+func WithCallInfo(ctx context.Context) (context.Context, *CallInfo) {
+	ci := &CallInfo{}
+	return context.WithValue(ctx, callInfoKey{}, ci), ci
+}
+
+// callInfoFrom returns the CallInfo attached to ctx, or nil.
+func callInfoFrom(ctx context.Context) *CallInfo {
+	ci, _ := ctx.Value(callInfoKey{}).(*CallInfo)
+	return ci
+}
+
+// callInfo returns the CallInfo attached to ctx, attaching a fresh one when
+// there is none so callers can always record into it.
+func callInfo(ctx context.Context) (context.Context, *CallInfo) {
+	if ci := callInfoFrom(ctx); ci != nil {
+		return ctx, ci
+	}
+	return WithCallInfo(ctx)
+}
@@ -5,4 +5,5 @@ import "github.com/labstack/echo/v4"
 type AuthController interface {
 	DevLogin(c echo.Context) error
 	WhoAmI(c echo.Context) error
+	SetLocale(c echo.Context) error
 }
@@ -2,13 +2,16 @@ package controllerImp
 
 import (
 	"net/http"
+	"strings"
 	"github.com/labstack/echo/v4"
 	"aoi/pkg/auth/controller"
+	"aoi/pkg/auth/repository"
+	"aoi/pkg/i18n"
 )
 
-type authCtrl struct{}
+type authCtrl struct{ prefs repository.PrefRepository }
 
-func NewAuthController() controller.AuthController { return &authCtrl{} }
+func NewAuthController(prefs repository.PrefRepository) controller.AuthController { return &authCtrl{prefs} }
 
 func (h *authCtrl) DevLogin(c echo.Context) error {
 	uid := c.QueryParam("uid")
@@ -20,5 +23,21 @@ func (h *authCtrl) DevLogin(c echo.Context) error {
 func (h *authCtrl) WhoAmI(c echo.Context) error {
 	v := c.Get("uid")
 	uid, _ := v.(string)
-	return c.JSON(http.StatusOK, map[string]string{"uid": uid})
+	saved, _ := h.prefs.Locale(uid)
+	loc, _ := c.Get("locale").(string)
+	return c.JSON(http.StatusOK, map[string]any{"uid": uid, "locale": loc, "saved_locale": saved, "locales": i18n.Supported()})
+}
+
+// SetLocale saves the user's language: {"locale":"en"}. It takes precedence
+// over the browser's Accept-Language.
+func (h *authCtrl) SetLocale(c echo.Context) error {
+	uid, _ := c.Get("uid").(string)
+	var body struct{ Locale string `json:"locale"` }
+	if err := c.Bind(&body); err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"bad json"}) }
+	loc := i18n.Normalize(body.Locale)
+	if loc == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "locale must be one of " + strings.Join(i18n.Supported(), ", ")})
+	}
+	if err := h.prefs.SetLocale(uid, loc); err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()}) }
+	return c.JSON(http.StatusOK, map[string]string{"uid": uid, "locale": loc})
 }
@@ -0,0 +1,7 @@
+package repository
+
+type PrefRepository interface {
+	// Locale is the user's saved locale, "" if none.
+	Locale(uid string) (string, error)
+	SetLocale(uid, locale string) error
+}
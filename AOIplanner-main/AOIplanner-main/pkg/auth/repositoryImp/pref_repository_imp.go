@@ -0,0 +1,24 @@
+package repositoryImp
+
+import (
+	"gorm.io/gorm"
+
+	"aoi/entities"
+	"aoi/pkg/auth/repository"
+)
+
+type prefRepo struct{ db *gorm.DB }
+
+func New(db *gorm.DB) repository.PrefRepository { return &prefRepo{db} }
+
+// Locale is "" for users who never chose one. It runs on every request, so
+// it uses Find rather than First to keep "record not found" out of the log.
+func (r *prefRepo) Locale(uid string) (string, error) {
+	var p entities.UserPref
+	err := r.db.Where("user_id = ?", uid).Limit(1).Find(&p).Error
+	return p.Locale, err
+}
+
+func (r *prefRepo) SetLocale(uid, locale string) error {
+	return r.db.Save(&entities.UserPref{UserID: uid, Locale: locale}).Error
+}
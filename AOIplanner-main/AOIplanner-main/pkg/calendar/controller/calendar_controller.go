@@ -0,0 +1,10 @@
+package controller
+
+import "github.com/labstack/echo/v4"
+
+type CalendarController interface {
+	Token(c echo.Context) error
+	RotateToken(c echo.Context) error
+	UserFeed(c echo.Context) error
+	FieldFeed(c echo.Context) error
+}
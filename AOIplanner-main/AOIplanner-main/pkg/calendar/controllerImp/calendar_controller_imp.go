@@ -0,0 +1,171 @@
+package controllerImp
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"aoi/entities"
+	authrepo "aoi/pkg/auth/repository"
+	"aoi/pkg/calendar"
+	calrepo "aoi/pkg/calendar/repository"
+	fieldrepo "aoi/pkg/field/repository"
+	"aoi/pkg/i18n"
+	planrepo "aoi/pkg/plan/repository"
+	schedrepo "aoi/pkg/schedule/repository"
+)
+
+type CalendarCtrl struct {
+	tokens calrepo.CalendarRepository
+	fields fieldrepo.FieldRepository
+	plans  planrepo.PlanRepository
+	sched  schedrepo.ScheduleRepository
+	prefs  authrepo.PrefRepository
+	tz     string
+}
+
+func New(tokens calrepo.CalendarRepository, fields fieldrepo.FieldRepository, plans planrepo.PlanRepository, sched schedrepo.ScheduleRepository, prefs authrepo.PrefRepository, tz string) *CalendarCtrl {
+	return &CalendarCtrl{tokens: tokens, fields: fields, plans: plans, sched: sched, prefs: prefs, tz: tz}
+}
+
+// Token returns the caller's feed token (creating one on first use) and the
+// subscription URLs.
+func (h *CalendarCtrl) Token(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	t, err := h.tokens.TokenByUser(uid)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		t, err = h.issue(uid)
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, feedURLs(c, t.Token))
+}
+
+// RotateToken replaces the caller's token; previously shared feed URLs stop working.
+func (h *CalendarCtrl) RotateToken(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	t, err := h.issue(uid)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, feedURLs(c, t.Token))
+}
+
+// UserFeed serves one calendar with the active-plan tasks of all the token owner's fields.
+func (h *CalendarCtrl) UserFeed(c echo.Context) error {
+	uid, ok := h.auth(c)
+	if !ok {
+		return c.String(http.StatusUnauthorized, "invalid token")
+	}
+	fields, err := h.fields.ListByUser(uid)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	var all []calendar.FeedTask
+	for _, f := range fields {
+		tasks, err := h.activeTasks(f.FieldID)
+		if err != nil {
+			return c.String(http.StatusInternalServerError, err.Error())
+		}
+		for _, t := range tasks {
+			all = append(all, calendar.FeedTask{Task: t, Field: f})
+		}
+	}
+	loc := h.locale(c, uid)
+	return h.writeICS(c, i18n.T(loc, "cal.name", nil), loc, all)
+}
+
+// FieldFeed serves the active-plan tasks of one field owned by the token owner.
+func (h *CalendarCtrl) FieldFeed(c echo.Context) error {
+	uid, ok := h.auth(c)
+	if !ok {
+		return c.String(http.StatusUnauthorized, "invalid token")
+	}
+	fid, _ := strconv.Atoi(c.Param("id"))
+	f, err := h.fields.FindByID(uint(fid), uid)
+	if err != nil {
+		return c.String(http.StatusNotFound, "field not found")
+	}
+	tasks, err := h.activeTasks(f.FieldID)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	out := make([]calendar.FeedTask, 0, len(tasks))
+	for _, t := range tasks {
+		out = append(out, calendar.FeedTask{Task: t})
+	}
+	loc := h.locale(c, uid)
+	return h.writeICS(c, calendar.FieldName(*f, loc), loc, out)
+}
+
+// activeTasks returns the tasks of the field's approved plan (none if no plan is approved yet).
+func (h *CalendarCtrl) activeTasks(fieldID uint) ([]entities.ScheduleTask, error) {
+	p, err := h.plans.CurrentByField(fieldID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.sched.ListByPlan(p.PlanID)
+}
+
+func (h *CalendarCtrl) auth(c echo.Context) (string, bool) {
+	tok := strings.TrimSpace(c.QueryParam("token"))
+	if tok == "" {
+		return "", false
+	}
+	uid, err := h.tokens.UserByToken(tok)
+	return uid, err == nil
+}
+
+// locale is the feed's language: the token owner's saved preference, else
+// Accept-Language if the calendar app sends one. Feeds carry no login, so the
+// Locale middleware cannot look the owner up.
+func (h *CalendarCtrl) locale(c echo.Context, uid string) string {
+	if saved, err := h.prefs.Locale(uid); err == nil {
+		if loc := i18n.Normalize(saved); loc != "" {
+			return loc
+		}
+	}
+	if loc := i18n.FromAcceptLanguage(c.Request().Header.Get("Accept-Language")); loc != "" {
+		return loc
+	}
+	return i18n.Default
+}
+
+func (h *CalendarCtrl) issue(uid string) (*entities.CalendarToken, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	t := &entities.CalendarToken{UserID: uid, Token: hex.EncodeToString(buf)}
+	if old, err := h.tokens.TokenByUser(uid); err == nil {
+		t.CreatedAt = old.CreatedAt
+	}
+	return t, h.tokens.SaveToken(t)
+}
+
+func (h *CalendarCtrl) writeICS(c echo.Context, name, loc string, tasks []calendar.FeedTask) error {
+	var b strings.Builder
+	calendar.WriteICS(&b, name, h.tz, loc, tasks)
+	c.Response().Header().Set("Cache-Control", "private, max-age=300")
+	c.Response().Header().Set("Content-Language", loc)
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", []byte(b.String()))
+}
+
+func feedURLs(c echo.Context, token string) map[string]string {
+	base := c.Scheme() + "://" + c.Request().Host
+	return map[string]string{
+		"token":          token,
+		"feed_url":       base + "/calendar.ics?token=" + token,
+		"field_feed_url": base + "/fields/{field_id}/schedule.ics?token=" + token,
+	}
+}
@@ -0,0 +1,127 @@
+// Package calendar renders schedule tasks as RFC 5545 iCalendar feeds.
+package calendar
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/i18n"
+)
+
+// FeedTask is a task plus the field it belongs to. Field is left zero in
+// single-field feeds; when set, the field name prefixes the event summary.
+type FeedTask struct {
+	Task  entities.ScheduleTask
+	Field entities.Field
+}
+
+// WriteICS renders tasks as all-day VEVENTs in loc. UIDs come from the task's
+// UID, which survives replans, so subscribed calendars update events in place
+// after a status change or a new plan version.
+func WriteICS(b *strings.Builder, name, tz, loc string, tasks []FeedTask) {
+	line(b, "BEGIN:VCALENDAR")
+	line(b, "VERSION:2.0")
+	line(b, "PRODID:-//AOI Planner//Sugarcane Schedule//TH")
+	line(b, "CALSCALE:GREGORIAN")
+	line(b, "METHOD:PUBLISH")
+	line(b, "X-WR-CALNAME:"+escape(name))
+	if tz != "" {
+		line(b, "X-WR-TIMEZONE:"+tz)
+	}
+	line(b, "REFRESH-INTERVAL;VALUE=DURATION:PT6H")
+	line(b, "X-PUBLISHED-TTL:PT6H")
+
+	now := time.Now().UTC().Format("20060102T150405Z")
+	for _, ft := range tasks {
+		t := ft.Task
+		i18n.LocalizeTask(&t, loc)
+		stamp := now
+		if !t.UpdatedAt.IsZero() {
+			stamp = t.UpdatedAt.UTC().Format("20060102T150405Z")
+		}
+		summary := t.Title
+		if t.Status == "done" {
+			summary = "✓ " + summary
+		}
+		if ft.Field.FieldID != 0 {
+			summary = fmt.Sprintf("[%s] %s", FieldName(ft.Field, loc), summary)
+		}
+
+		line(b, "BEGIN:VEVENT")
+		uid := t.UID
+		if uid == "" { // rows from before tasks had a UID
+			uid = fmt.Sprintf("task-%d", t.TaskID)
+		}
+		line(b, "UID:"+uid+"@aoi-planner")
+		line(b, "DTSTAMP:"+stamp)
+		line(b, "LAST-MODIFIED:"+stamp)
+		line(b, "DTSTART;VALUE=DATE:"+t.Date.Format("20060102"))
+		line(b, "DTEND;VALUE=DATE:"+t.Date.AddDate(0, 0, 1).Format("20060102"))
+		line(b, "SUMMARY:"+escape(summary))
+		line(b, "DESCRIPTION:"+escape(description(t, loc)))
+		line(b, "CATEGORIES:"+escape(t.Type))
+		line(b, "STATUS:"+eventStatus(t.Status))
+		line(b, "TRANSP:TRANSPARENT")
+		line(b, "END:VEVENT")
+	}
+	line(b, "END:VCALENDAR")
+}
+
+// FieldName is the display name of a field in calendars ("แปลง #3 KK3").
+func FieldName(f entities.Field, loc string) string {
+	id := strconv.FormatUint(uint64(f.FieldID), 10)
+	if f.Variety != "" {
+		return i18n.T(loc, "cal.field_variety", map[string]string{"id": id, "variety": f.Variety})
+	}
+	return i18n.T(loc, "cal.field", map[string]string{"id": id})
+}
+
+func description(t entities.ScheduleTask, loc string) string {
+	parts := []string{
+		i18n.T(loc, "cal.type", map[string]string{"type": t.Type}),
+		i18n.T(loc, "cal.status", map[string]string{"status": t.Status}),
+	}
+	if t.Qty != nil {
+		parts = append(parts, i18n.T(loc, "cal.qty", map[string]string{"qty": fmt.Sprintf("%.2f", *t.Qty), "unit": t.Unit}))
+	}
+	if t.Notes != "" {
+		parts = append(parts, i18n.T(loc, "cal.notes", map[string]string{"notes": t.Notes}))
+	}
+	return strings.Join(parts, "\n")
+}
+
+func eventStatus(s string) string {
+	switch s {
+	case "skipped":
+		return "CANCELLED"
+	case "done":
+		return "CONFIRMED"
+	}
+	return "TENTATIVE"
+}
+
+// escape applies RFC 5545 TEXT escaping.
+func escape(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return r.Replace(s)
+}
+
+// line writes a content line folded at 75 octets (without splitting UTF-8
+// sequences) and terminated by CRLF.
+func line(b *strings.Builder, s string) {
+	const max = 75
+	n := 0
+	for _, r := range s {
+		rl := len(string(r))
+		if n+rl > max {
+			b.WriteString("\r\n ")
+			n = 1
+		}
+		b.WriteRune(r)
+		n += rl
+	}
+	b.WriteString("\r\n")
+}
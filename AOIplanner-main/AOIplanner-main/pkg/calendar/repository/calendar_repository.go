@@ -0,0 +1,9 @@
+package repository
+
+import "aoi/entities"
+
+type CalendarRepository interface {
+	TokenByUser(uid string) (*entities.CalendarToken, error)
+	UserByToken(token string) (string, error)
+	SaveToken(t *entities.CalendarToken) error
+}
@@ -0,0 +1,30 @@
+package repositoryImp
+
+import (
+	"gorm.io/gorm"
+
+	"aoi/entities"
+	"aoi/pkg/calendar/repository"
+)
+
+type calRepo struct{ db *gorm.DB }
+
+func New(db *gorm.DB) repository.CalendarRepository { return &calRepo{db} }
+
+func (r *calRepo) TokenByUser(uid string) (*entities.CalendarToken, error) {
+	var t entities.CalendarToken
+	if err := r.db.Where("user_id = ?", uid).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *calRepo) UserByToken(token string) (string, error) {
+	var t entities.CalendarToken
+	if err := r.db.Where("token = ?", token).First(&t).Error; err != nil {
+		return "", err
+	}
+	return t.UserID, nil
+}
+
+func (r *calRepo) SaveToken(t *entities.CalendarToken) error { return r.db.Save(t).Error }
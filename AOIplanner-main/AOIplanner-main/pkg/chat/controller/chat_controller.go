@@ -0,0 +1,11 @@
+package controller
+
+import "github.com/labstack/echo/v4"
+
+type ChatController interface {
+	Ask(c echo.Context) error
+	Threads(c echo.Context) error
+	Thread(c echo.Context) error
+	Accept(c echo.Context) error
+	Dismiss(c echo.Context) error
+}
@@ -0,0 +1,100 @@
+package controllerImp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"aoi/pkg/chat/service"
+	"aoi/pkg/chat/serviceImp"
+	schedSvcImp "aoi/pkg/schedule/serviceImp"
+)
+
+type ChatCtrl struct{ svc service.ChatService }
+
+func New(svc service.ChatService) *ChatCtrl { return &ChatCtrl{svc: svc} }
+
+type askReq struct {
+	ThreadID uint   `json:"thread_id"` // omit to start a new thread
+	Message  string `json:"message"`
+}
+
+// Ask answers a question about the field. The reply cites the KB passages it
+// used and may propose tasks, which the user accepts or dismisses one by one.
+func (h *ChatCtrl) Ask(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	var req askReq
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	t, q, a, err := h.svc.Ask(c.Request().Context(), uint(fid), uid, req.ThreadID, req.Message)
+	if err != nil {
+		return chatError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]any{"thread": t, "question": q, "answer": a})
+}
+
+// Threads lists the user's conversations about the field, most recent first.
+func (h *ChatCtrl) Threads(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	ts, err := h.svc.Threads(uint(fid), uid)
+	if err != nil {
+		return chatError(c, err)
+	}
+	return c.JSON(http.StatusOK, ts)
+}
+
+// Thread returns a conversation with all its messages.
+func (h *ChatCtrl) Thread(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	id, _ := strconv.Atoi(c.Param("thread_id"))
+	t, ms, err := h.svc.Thread(uint(id), uid)
+	if err != nil {
+		return chatError(c, err)
+	}
+	return c.JSON(http.StatusOK, map[string]any{"thread": t, "messages": ms})
+}
+
+// Accept adds a proposed task to the field's schedule, with the same checks
+// as a manual edit.
+func (h *ChatCtrl) Accept(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	id, _ := strconv.Atoi(c.Param("msg_id"))
+	n, _ := strconv.Atoi(c.Param("n"))
+	task, m, err := h.svc.AcceptProposal(uint(id), n, uid)
+	if err != nil {
+		return chatError(c, err)
+	}
+	return c.JSON(http.StatusCreated, map[string]any{"task": task, "message": m})
+}
+
+func (h *ChatCtrl) Dismiss(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	id, _ := strconv.Atoi(c.Param("msg_id"))
+	n, _ := strconv.Atoi(c.Param("n"))
+	m, err := h.svc.DismissProposal(uint(id), n, uid)
+	if err != nil {
+		return chatError(c, err)
+	}
+	return c.JSON(http.StatusOK, m)
+}
+
+func chatError(c echo.Context, err error) error {
+	var ce *schedSvcImp.ConstraintError
+	switch {
+	case errors.Is(err, serviceImp.ErrEmptyQuestion), errors.Is(err, schedSvcImp.ErrBadEdit):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.As(err, &ce):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": ce.Msg, "rule": ce.Rule})
+	case errors.Is(err, serviceImp.ErrProposalClosed), errors.Is(err, schedSvcImp.ErrNoActivePlan):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
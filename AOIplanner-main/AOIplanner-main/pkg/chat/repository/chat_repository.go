@@ -0,0 +1,19 @@
+package repository
+
+import "aoi/entities"
+
+type ChatRepository interface {
+	CreateThread(t *entities.ChatThread) error
+	FindThread(threadID uint, uid string) (*entities.ChatThread, error)     // uid must own the thread
+	ThreadsByField(fieldID uint, uid string) ([]entities.ChatThread, error) // most recent first
+	TouchThread(threadID uint) error
+
+	AddMessage(m *entities.ChatMessage) error
+	SaveMessage(m *entities.ChatMessage) error
+	// UpdateProposal stores p in place of the message's proposal p.N, but only
+	// while that proposal's status is still from; false means it was not.
+	UpdateProposal(messageID uint, p entities.ChatProposal, from string) (bool, error)
+	FindMessage(messageID uint) (*entities.ChatMessage, error)
+	Messages(threadID uint) ([]entities.ChatMessage, error)            // oldest first
+	LastMessages(threadID uint, n int) ([]entities.ChatMessage, error) // the n latest, oldest first
+}
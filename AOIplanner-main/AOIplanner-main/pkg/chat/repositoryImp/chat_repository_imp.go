@@ -0,0 +1,94 @@
+package repositoryImp
+
+import (
+	"encoding/json"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aoi/entities"
+	"aoi/pkg/chat/repository"
+)
+
+type chatRepo struct{ db *gorm.DB }
+
+func New(db *gorm.DB) repository.ChatRepository { return &chatRepo{db} }
+
+func (r *chatRepo) CreateThread(t *entities.ChatThread) error { return r.db.Create(t).Error }
+
+func (r *chatRepo) FindThread(threadID uint, uid string) (*entities.ChatThread, error) {
+	var t entities.ChatThread
+	if err := r.db.Where("thread_id = ? AND user_id = ?", threadID, uid).First(&t).Error; err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *chatRepo) ThreadsByField(fieldID uint, uid string) ([]entities.ChatThread, error) {
+	var out []entities.ChatThread
+	if err := r.db.Where("field_id = ? AND user_id = ?", fieldID, uid).Order("updated_at DESC, thread_id DESC").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *chatRepo) TouchThread(threadID uint) error {
+	return r.db.Model(&entities.ChatThread{}).Where("thread_id = ?", threadID).Update("updated_at", time.Now()).Error
+}
+
+func (r *chatRepo) AddMessage(m *entities.ChatMessage) error { return r.db.Create(m).Error }
+
+func (r *chatRepo) SaveMessage(m *entities.ChatMessage) error { return r.db.Save(m).Error }
+
+func (r *chatRepo) UpdateProposal(messageID uint, p entities.ChatProposal, from string) (bool, error) {
+	ok := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var m entities.ChatMessage
+		if err := tx.First(&m, messageID).Error; err != nil {
+			return err
+		}
+		old, err := json.Marshal(m.Proposals)
+		if err != nil {
+			return err
+		}
+		for i := range m.Proposals {
+			if m.Proposals[i].N == p.N && m.Proposals[i].Status == from {
+				m.Proposals[i] = p
+				// conditional on the proposals read above, so a concurrent
+				// change in between makes this a no-op instead of a lost update
+				res := tx.Model(&m).Where("proposals = ?", string(old)).Select("proposals").Updates(&m)
+				ok = res.RowsAffected == 1
+				return res.Error
+			}
+		}
+		return nil
+	})
+	return ok, err
+}
+
+func (r *chatRepo) FindMessage(messageID uint) (*entities.ChatMessage, error) {
+	var m entities.ChatMessage
+	if err := r.db.First(&m, messageID).Error; err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+func (r *chatRepo) Messages(threadID uint) ([]entities.ChatMessage, error) {
+	var out []entities.ChatMessage
+	if err := r.db.Where("thread_id = ?", threadID).Order("message_id ASC").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *chatRepo) LastMessages(threadID uint, n int) ([]entities.ChatMessage, error) {
+	var out []entities.ChatMessage
+	if err := r.db.Where("thread_id = ?", threadID).Order("message_id DESC").Limit(n).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	"context"
+
+	"aoi/entities"
+)
+
+type ChatService interface {
+	// Ask adds a question to a thread of the field (a new thread when
+	// threadID is 0) and returns the thread, the stored question and answer.
+	Ask(ctx context.Context, fieldID uint, uid string, threadID uint, question string) (*entities.ChatThread, *entities.ChatMessage, *entities.ChatMessage, error)
+	Threads(fieldID uint, uid string) ([]entities.ChatThread, error)
+	Thread(threadID uint, uid string) (*entities.ChatThread, []entities.ChatMessage, error)
+
+	// AcceptProposal adds proposal n of an assistant message to the schedule.
+	AcceptProposal(messageID uint, n int, uid string) (*entities.ScheduleTask, *entities.ChatMessage, error)
+	DismissProposal(messageID uint, n int, uid string) (*entities.ChatMessage, error)
+}
@@ -0,0 +1,397 @@
+package serviceImp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aoi/entities"
+	"aoi/pkg/ai"
+	"aoi/pkg/chat/repository"
+	"aoi/pkg/chat/service"
+	fieldrepo "aoi/pkg/field/repository"
+	"aoi/pkg/i18n"
+	measrepo "aoi/pkg/measure/repository"
+	planrepo "aoi/pkg/plan/repository"
+	planSvc "aoi/pkg/plan/serviceImp"
+	"aoi/pkg/plan/types"
+	schedrepo "aoi/pkg/schedule/repository"
+	schedsvc "aoi/pkg/schedule/service"
+)
+
+// ErrEmptyQuestion is returned when the message is blank.
+var ErrEmptyQuestion = errors.New("message is required")
+
+// ErrProposalClosed is returned when a proposal was already accepted or
+// dismissed (or does not exist on the message).
+var ErrProposalClosed = errors.New("proposal is not open")
+
+type kbSearcher interface {
+	Search(ctx context.Context, query string, k int) ([]entities.KBChunk, error)
+	DocsMeta(ctx context.Context, ids []uint) (map[uint]entities.KBDocument, error)
+}
+
+// Context given to the model with each question.
+const (
+	historyMessages = 10 // earlier messages of the thread
+	recentDays      = 14 // measurements from the last two weeks...
+	maxMeasurements = 5  // ...at most this many, newest kept
+	upcomingDays    = 14 // schedule window from today
+	maxUpcoming     = 10
+	kbPassages      = 4
+	maxTitleRunes   = 60
+)
+
+type chatSvc struct {
+	repo   repository.ChatRepository
+	fields fieldrepo.FieldRepository
+	plans  planrepo.PlanRepository
+	meas   measrepo.MeasureRepository
+	sched  schedrepo.ScheduleRepository
+	edits  schedsvc.ScheduleService
+	kb     kbSearcher
+	llm    ai.Client
+	loc    *time.Location
+
+	kbTimeout  time.Duration
+	llmTimeout time.Duration
+}
+
+var _ service.ChatService = (*chatSvc)(nil)
+
+// New builds the chat service; a zero timeout takes the planner's default
+// budget for that step.
+func New(repo repository.ChatRepository, fields fieldrepo.FieldRepository, plans planrepo.PlanRepository, meas measrepo.MeasureRepository,
+	sched schedrepo.ScheduleRepository, edits schedsvc.ScheduleService, kb kbSearcher, llm ai.Client, loc *time.Location, kbTimeout, llmTimeout time.Duration) service.ChatService {
+	if loc == nil {
+		loc = time.Local
+	}
+	if kbTimeout <= 0 {
+		kbTimeout = planSvc.DefaultBudgets.KBSearch
+	}
+	if llmTimeout <= 0 {
+		llmTimeout = planSvc.DefaultBudgets.Summary
+	}
+	return &chatSvc{repo: repo, fields: fields, plans: plans, meas: meas, sched: sched, edits: edits, kb: kb, llm: llm, loc: loc, kbTimeout: kbTimeout, llmTimeout: llmTimeout}
+}
+
+func (s *chatSvc) Ask(ctx context.Context, fieldID uint, uid string, threadID uint, question string) (*entities.ChatThread, *entities.ChatMessage, *entities.ChatMessage, error) {
+	question = strings.TrimSpace(question)
+	if question == "" {
+		return nil, nil, nil, ErrEmptyQuestion
+	}
+	f, err := s.fields.FindByID(fieldID, uid)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	t, err := s.thread(f, uid, threadID, question)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	history, err := s.repo.LastMessages(t.ThreadID, historyMessages)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	q := &entities.ChatMessage{ThreadID: t.ThreadID, Role: "user", Content: question}
+	if err := s.repo.AddMessage(q); err != nil {
+		return nil, nil, nil, err
+	}
+
+	today := time.Now().In(s.loc).Format("2006-01-02")
+	req := ai.ChatRequest{Field: f, Today: today, Question: question}
+	req.Stage = s.currentStage(f.FieldID, today)
+	req.Measurements = s.recentMeasurements(f.FieldID)
+	req.Tasks = s.upcomingTasks(f.FieldID, today)
+	for _, m := range history {
+		req.History = append(req.History, ai.ChatTurn{Role: m.Role, Content: m.Content})
+	}
+	cites := s.retrieve(ctx, f, question)
+	for _, c := range cites {
+		req.Sources = append(req.Sources, ai.ChatSource{N: c.N, Title: c.Title, Text: c.text})
+	}
+
+	a := &entities.ChatMessage{ThreadID: t.ThreadID, Role: "assistant"}
+	lctx, cancel := context.WithTimeout(ctx, s.llmTimeout)
+	defer cancel()
+	lctx, ci := ai.WithCallInfo(lctx)
+	reply, err := s.llm.Chat(lctx, req)
+	if err != nil {
+		log.Printf("[chat] field #%d thread #%d fell back: %v", f.FieldID, t.ThreadID, err)
+		a.Content, a.Fallback = fallbackAnswer(cites, i18n.FromContext(ctx)), true
+		a.Citations = citationsOf(cites, nil)
+	} else {
+		a.Content, a.Provider = reply.Answer, ci.Provider
+		a.Citations = citationsOf(cites, reply.Cites)
+		for i, op := range reply.Tasks {
+			a.Proposals = append(a.Proposals, entities.ChatProposal{
+				N: i + 1, Date: op.Date, Type: op.Type, Title: op.Title, Qty: op.Qty, Unit: op.Unit, Notes: op.Notes,
+				Status: entities.ProposalProposed,
+			})
+		}
+	}
+	// the answer is stored even if the client has gone
+	if err := s.repo.AddMessage(a); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := s.repo.TouchThread(t.ThreadID); err != nil {
+		return nil, nil, nil, err
+	}
+	return t, q, a, nil
+}
+
+// thread returns the user's thread on the field, or starts one titled after
+// the question.
+func (s *chatSvc) thread(f *entities.Field, uid string, threadID uint, question string) (*entities.ChatThread, error) {
+	if threadID != 0 {
+		t, err := s.repo.FindThread(threadID, uid)
+		if err != nil {
+			return nil, err
+		}
+		if t.FieldID != f.FieldID {
+			return nil, fmt.Errorf("thread #%d belongs to another field: %w", threadID, gorm.ErrRecordNotFound)
+		}
+		return t, nil
+	}
+	title := []rune(question)
+	if len(title) > maxTitleRunes {
+		title = append(title[:maxTitleRunes-1], '…')
+	}
+	t := &entities.ChatThread{FieldID: f.FieldID, UserID: uid, Title: string(title)}
+	if err := s.repo.CreateThread(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// currentStage is the stage of the field's current plan (the latest version
+// when none is approved yet) that contains today.
+func (s *chatSvc) currentStage(fieldID uint, today string) *types.StagePlan {
+	p, err := s.plans.CurrentByField(fieldID)
+	if err != nil {
+		if p, err = s.plans.LatestByField(fieldID); err != nil {
+			return nil
+		}
+	}
+	var stages []types.StagePlan
+	_ = json.Unmarshal([]byte(p.StagesJSON), &stages)
+	for i := range stages {
+		if stages[i].StartDate <= today && today <= stages[i].EndDate {
+			st := stages[i]
+			st.Ops = nil
+			return &st
+		}
+	}
+	return nil
+}
+
+func (s *chatSvc) recentMeasurements(fieldID uint) []entities.Measurement {
+	ms, err := s.meas.Recent(fieldID, recentDays)
+	if err != nil {
+		return nil
+	}
+	if len(ms) > maxMeasurements {
+		ms = ms[len(ms)-maxMeasurements:]
+	}
+	return ms
+}
+
+func (s *chatSvc) upcomingTasks(fieldID uint, today string) []types.PlanOp {
+	t0, _ := time.ParseInLocation("2006-01-02", today, s.loc)
+	tasks, err := s.sched.List(fieldID, today, t0.AddDate(0, 0, upcomingDays).Format("2006-01-02"))
+	if err != nil {
+		return nil
+	}
+	var ops []types.PlanOp
+	for _, t := range tasks {
+		if t.Status != "" && t.Status != "todo" {
+			continue
+		}
+		ops = append(ops, types.PlanOp{Date: t.Date.Format("2006-01-02"), Type: t.Type, Title: t.Title, Qty: t.Qty, Unit: t.Unit, Notes: t.Notes, Key: t.MsgKey, Params: t.MsgParams})
+		if len(ops) == maxUpcoming {
+			break
+		}
+	}
+	return ops
+}
+
+// source is a retrieved passage numbered for citation.
+type source struct {
+	entities.ChatCitation
+	text string
+}
+
+// retrieve searches the KB for the question (with the field's variety for
+// context) within the KB timeout; on error the model answers without sources.
+func (s *chatSvc) retrieve(ctx context.Context, f *entities.Field, question string) []source {
+	if s.kb == nil {
+		return nil
+	}
+	kctx, cancel := context.WithTimeout(ctx, s.kbTimeout)
+	defer cancel()
+	chunks, err := s.kb.Search(kctx, question+" "+f.Variety+" sugarcane", kbPassages)
+	if err != nil {
+		log.Printf("[chat] kb search for field #%d: %v", f.FieldID, err)
+		return nil
+	}
+	ids := make([]uint, 0, len(chunks))
+	for _, ch := range chunks {
+		ids = append(ids, ch.DocID)
+	}
+	meta, _ := s.kb.DocsMeta(kctx, ids)
+	out := make([]source, 0, len(chunks))
+	for i, ch := range chunks {
+		d := meta[ch.DocID]
+		out = append(out, source{
+			ChatCitation: entities.ChatCitation{N: i + 1, DocID: ch.DocID, ChunkID: ch.ChunkID, Title: d.Title, URL: d.SourceURL, Score: ch.Score},
+			text:         ch.Text,
+		})
+	}
+	return out
+}
+
+// citationsOf keeps the sources the answer cited, in the order they were
+// numbered. A fallback answer (used == nil) lists them all.
+func citationsOf(srcs []source, used []int) []entities.ChatCitation {
+	var out []entities.ChatCitation
+	for _, src := range srcs {
+		if used == nil || containsInt(used, src.N) {
+			out = append(out, src.ChatCitation)
+		}
+	}
+	return out
+}
+
+// fallbackAnswer is stored when the model cannot be reached: an apology and
+// the passages found for the question, so the farmer can read them directly.
+func fallbackAnswer(srcs []source, loc string) string {
+	var b strings.Builder
+	b.WriteString(i18n.T(loc, "chat.unavailable", nil))
+	if len(srcs) > 0 {
+		b.WriteString("\n\n" + i18n.T(loc, "chat.sources", nil))
+		for _, src := range srcs {
+			title := src.Title
+			if title == "" {
+				title = i18n.T(loc, "chat.doc", map[string]string{"id": strconv.FormatUint(uint64(src.DocID), 10)})
+			}
+			fmt.Fprintf(&b, "\n[%d] %s", src.N, title)
+		}
+	}
+	return b.String()
+}
+
+func (s *chatSvc) Threads(fieldID uint, uid string) ([]entities.ChatThread, error) {
+	if _, err := s.fields.FindByID(fieldID, uid); err != nil {
+		return nil, err
+	}
+	return s.repo.ThreadsByField(fieldID, uid)
+}
+
+func (s *chatSvc) Thread(threadID uint, uid string) (*entities.ChatThread, []entities.ChatMessage, error) {
+	t, err := s.repo.FindThread(threadID, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	ms, err := s.repo.Messages(threadID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, ms, nil
+}
+
+// AcceptProposal claims the proposal before adding its task, so a repeated or
+// concurrent accept cannot add the task twice; the claim is released if the
+// task is rejected.
+func (s *chatSvc) AcceptProposal(messageID uint, n int, uid string) (*entities.ScheduleTask, *entities.ChatMessage, error) {
+	t, m, p, err := s.proposal(messageID, n, uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	date, err := time.ParseInLocation("2006-01-02", p.Date, s.loc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("proposal date %q: %w", p.Date, err)
+	}
+	open, accepted := *p, *p
+	accepted.Status = entities.ProposalAccepted
+	if err := s.setProposal(m.MessageID, accepted, entities.ProposalProposed); err != nil {
+		return nil, nil, err
+	}
+	task, err := s.edits.Create(t.FieldID, uid, schedsvc.NewTask{Date: date, Type: p.Type, Title: p.Title, Qty: p.Qty, Unit: p.Unit, Notes: p.Notes})
+	if err != nil {
+		if rerr := s.setProposal(m.MessageID, open, entities.ProposalAccepted); rerr != nil {
+			log.Printf("[chat] message #%d proposal %d left accepted without a task: %v", m.MessageID, n, rerr)
+		}
+		return nil, nil, err
+	}
+	accepted.TaskID = &task.TaskID
+	if err := s.setProposal(m.MessageID, accepted, entities.ProposalAccepted); err != nil {
+		return nil, nil, err
+	}
+	*p = accepted
+	return task, m, nil
+}
+
+func (s *chatSvc) DismissProposal(messageID uint, n int, uid string) (*entities.ChatMessage, error) {
+	_, m, p, err := s.proposal(messageID, n, uid)
+	if err != nil {
+		return nil, err
+	}
+	dismissed := *p
+	dismissed.Status = entities.ProposalDismissed
+	if err := s.setProposal(m.MessageID, dismissed, entities.ProposalProposed); err != nil {
+		return nil, err
+	}
+	*p = dismissed
+	return m, nil
+}
+
+// setProposal stores p if its stored status is still from, and reports
+// ErrProposalClosed if another request changed it first.
+func (s *chatSvc) setProposal(messageID uint, p entities.ChatProposal, from string) error {
+	ok, err := s.repo.UpdateProposal(messageID, p, from)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrProposalClosed
+	}
+	return nil
+}
+
+// proposal finds open proposal n of a message in one of uid's threads.
+func (s *chatSvc) proposal(messageID uint, n int, uid string) (*entities.ChatThread, *entities.ChatMessage, *entities.ChatProposal, error) {
+	m, err := s.repo.FindMessage(messageID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	t, err := s.repo.FindThread(m.ThreadID, uid)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for i := range m.Proposals {
+		p := &m.Proposals[i]
+		if p.N != n {
+			continue
+		}
+		if p.Status != entities.ProposalProposed {
+			return nil, nil, nil, ErrProposalClosed
+		}
+		return t, m, p, nil
+	}
+	return nil, nil, nil, ErrProposalClosed
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
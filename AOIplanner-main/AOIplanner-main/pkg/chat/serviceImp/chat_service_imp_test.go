@@ -0,0 +1,100 @@
+package serviceImp
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aoi/database"
+	"aoi/entities"
+	chatRepoImp "aoi/pkg/chat/repositoryImp"
+	fieldRepoImp "aoi/pkg/field/repositoryImp"
+	measRepoImp "aoi/pkg/measure/repositoryImp"
+	planRepoImp "aoi/pkg/plan/repositoryImp"
+	"aoi/pkg/plan/types"
+	schedRepoImp "aoi/pkg/schedule/repositoryImp"
+	schedsvc "aoi/pkg/schedule/service"
+	schedSvcImp "aoi/pkg/schedule/serviceImp"
+)
+
+// proposalFixture stores an assistant message of user u1 proposing an
+// observation inside the crop cycle (1) and one before it (2).
+func proposalFixture(t *testing.T) (*chatSvc, *entities.ChatMessage, func() int64) {
+	t.Helper()
+	db := database.OpenSQLite(filepath.Join(t.TempDir(), "aoi.db"))
+	f := entities.Field{UserID: "u1"}
+	db.Create(&f)
+	stages, _ := json.Marshal([]types.StagePlan{{Stage: "all", StartDate: "2026-05-01", EndDate: "2027-05-01"}})
+	db.Create(&entities.Plan{FieldID: f.FieldID, Version: 1, StagesJSON: string(stages), Status: entities.PlanStatusApproved})
+	th := entities.ChatThread{FieldID: f.FieldID, UserID: "u1"}
+	db.Create(&th)
+	m := &entities.ChatMessage{ThreadID: th.ThreadID, Role: "assistant", Proposals: []entities.ChatProposal{
+		{N: 1, Date: "2026-06-01", Type: "observe", Title: "ดูใบ", Status: entities.ProposalProposed},
+		{N: 2, Date: "2026-01-01", Type: "observe", Title: "ก่อนปลูก", Status: entities.ProposalProposed},
+	}}
+	db.Create(m)
+
+	sched, plans, meas, fields := schedRepoImp.New(db), planRepoImp.New(db), measRepoImp.New(db), fieldRepoImp.New(db)
+	edits := schedSvcImp.NewScheduleService(sched, plans, meas, fields)
+	s := New(chatRepoImp.New(db), fields, plans, meas, sched, edits, nil, nil, time.UTC, 0, 0).(*chatSvc)
+	tasks := func() int64 {
+		var n int64
+		db.Model(&entities.ScheduleTask{}).Count(&n)
+		return n
+	}
+	return s, m, tasks
+}
+
+// racingEdits accepts the same proposal again while the first accept is
+// adding its task, like a double tap arriving mid-request.
+type racingEdits struct {
+	schedsvc.ScheduleService
+	again func() error
+	err   error
+}
+
+func (r *racingEdits) Create(fieldID uint, uid string, nt schedsvc.NewTask) (*entities.ScheduleTask, error) {
+	if r.again != nil {
+		again := r.again
+		r.again = nil
+		r.err = again()
+	}
+	return r.ScheduleService.Create(fieldID, uid, nt)
+}
+
+func TestAcceptProposalOnce(t *testing.T) {
+	s, m, tasks := proposalFixture(t)
+	race := &racingEdits{ScheduleService: s.edits}
+	race.again = func() error { _, _, err := s.AcceptProposal(m.MessageID, 1, "u1"); return err }
+	s.edits = race
+
+	if _, _, err := s.AcceptProposal(m.MessageID, 1, "u1"); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(race.err, ErrProposalClosed) || tasks() != 1 {
+		t.Fatalf("accept during accept: %v, %d tasks; want ErrProposalClosed and 1 task", race.err, tasks())
+	}
+
+	stored, _ := s.repo.FindMessage(m.MessageID)
+	if p := stored.Proposals[0]; p.Status != entities.ProposalAccepted || p.TaskID == nil {
+		t.Errorf("accepted proposal: %+v", p)
+	}
+	if _, err := s.DismissProposal(m.MessageID, 1, "u1"); !errors.Is(err, ErrProposalClosed) {
+		t.Errorf("dismiss after accept: want ErrProposalClosed, got %v", err)
+	}
+}
+
+func TestAcceptProposalReleasesRejected(t *testing.T) {
+	s, m, tasks := proposalFixture(t)
+
+	var ce *schedSvcImp.ConstraintError
+	if _, _, err := s.AcceptProposal(m.MessageID, 2, "u1"); !errors.As(err, &ce) {
+		t.Fatalf("outside the crop cycle: want a ConstraintError, got %v", err)
+	}
+	stored, _ := s.repo.FindMessage(m.MessageID)
+	if p := stored.Proposals[1]; p.Status != entities.ProposalProposed || p.TaskID != nil || tasks() != 0 {
+		t.Errorf("rejected proposal must stay open: %+v, %d tasks", p, tasks())
+	}
+}
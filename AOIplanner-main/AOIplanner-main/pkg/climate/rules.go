@@ -14,6 +14,7 @@ import (
 	"github.com/xuri/excelize/v2"
 
 	"aoi/entities"
+	"aoi/pkg/i18n"
 	"aoi/pkg/plan/types"
 )
 
@@ -21,9 +22,13 @@ type RulesEngine interface {
 	BuildStages(*entities.Field) []types.StagePlan
 	ExpandDaily(*entities.Field, []types.StagePlan) []types.PlanOp
 	ToSchedule(*entities.Field, uint, []types.PlanOp) []entities.ScheduleTask
-	EvaluateDrift(*entities.Field, []entities.Measurement, []types.StagePlan) (bool, string)
+	EvaluateDrift(*entities.Field, []entities.Measurement, []types.StagePlan) (bool, string, types.DriftMetrics)
 }
 
+// FertilizerStage reports whether fertilizer is applied in a growth stage
+// (ExpandDaily schedules it at the stage start).
+func FertilizerStage(stage string) bool { return stage == "Tillering" || stage == "Elongation" }
+
 type stageRow struct {
 	Name         string
 	Days         int
@@ -184,7 +189,9 @@ func (r *rules) ExpandDaily(f *entities.Field, stages []types.StagePlan) []types
 			dayStr := d.Format("2006-01-02")
 			// Observation every 2 days
 			if d.Sub(sd).Hours()/24.0 == 0 || int(d.Sub(sd).Hours()/24.0)%2 == 0 {
-				ops = append(ops, types.PlanOp{Date: dayStr, Type:"observe", Title:"วัดความสูงและความชื้น", Notes:"บันทึกค่าให้ระบบปรับแผน"})
+				op := i18n.Op("observe", "task.observe", nil)
+				op.Date = dayStr
+				ops = append(ops, op)
 			}
 			// Irrigation per interval
 			daysFromStageStart := int(d.Sub(sd).Hours()/24.0)
@@ -192,12 +199,16 @@ func (r *rules) ExpandDaily(f *entities.Field, stages []types.StagePlan) []types
 				mm := st.WaterMMDay * float64(interval)
 				volPerRaiM3 := mm * 0.001 * 1600.0 // mm -> m * m^2 (1 rai ≈ 1600 m2)
 				qty := volPerRaiM3 * f.AreaRai
-				ops = append(ops, types.PlanOp{Date: dayStr, Type:"irrigation", Title:"รดน้ำตามรอบ", Qty:&qty, Unit:"m3", Notes:fmt.Sprintf("%.1f mm ต่อ %d วัน", mm, interval)})
+				op := i18n.Op("irrigation", "task.irrigate", map[string]string{"mm": fmt.Sprintf("%.1f", mm), "days": strconv.Itoa(interval)})
+				op.Date, op.Qty, op.Unit = dayStr, &qty, "m3"
+				ops = append(ops, op)
 			}
 			// Fertilizer marker at stage boundaries
-			if d.Equal(sd) && (st.Stage=="Tillering" || st.Stage=="Elongation") {
+			if d.Equal(sd) && FertilizerStage(st.Stage) {
 				qty := 30.0 * f.AreaRai // simple placeholder kg/rai
-				ops = append(ops, types.PlanOp{Date: dayStr, Type:"fertilizer", Title:"ใส่ปุ๋ย 15-15-15", Qty:&qty, Unit:"kg", Notes:"ตัวอย่าง: ปรับในภายหลังตามงบประมาณ"})
+				op := i18n.Op("fertilizer", "task.fertilize", nil)
+				op.Date, op.Qty, op.Unit = dayStr, &qty, "kg"
+				ops = append(ops, op)
 			}
 		}
 	}
@@ -212,26 +223,32 @@ func (r *rules) ToSchedule(f *entities.Field, planID uint, ops []types.PlanOp) [
 		d, _ := time.Parse("2006-01-02", op.Date)
 		out = append(out, entities.ScheduleTask{
 			FieldID: f.FieldID, PlanID: planID, Date: d, Title: op.Title, Type: op.Type, Qty: op.Qty, Unit: op.Unit, Notes: op.Notes, Status: "todo",
+			MsgKey: op.Key, MsgParams: op.Params,
 		})
 	}
 	return out
 }
 
-func (r *rules) EvaluateDrift(f *entities.Field, recent []entities.Measurement, stages []types.StagePlan) (bool, string) {
+func (r *rules) EvaluateDrift(f *entities.Field, recent []entities.Measurement, stages []types.StagePlan) (bool, string, types.DriftMetrics) {
 	// Very simple rule: if last height < expected*0.85 OR 3 consecutive moist_state==dry
-	if len(recent) == 0 { return false, "" }
+	m := types.DriftMetrics{Samples: len(recent)}
+	if len(recent) == 0 { return false, "", m }
 	last := recent[len(recent)-1]
 	// expected height: naive 1.2 cm/day since planting (placeholder)
 	days := int(time.Since(f.PlantingDate).Hours()/24.0)
 	expected := 1.2 * float64(days)
-	if last.CaneHeightCM != nil && *last.CaneHeightCM < 0.85*expected {
-		return true, fmt.Sprintf("height drift: got %.1f vs %.1f", *last.CaneHeightCM, expected)
-	}
+	m.DaysSincePlanting = days
+	m.ExpectedHeightCM = expected
+	m.LastHeightCM = last.CaneHeightCM
 	// moisture state
 	cntDry := 0
 	for i := len(recent)-1; i>=0 && i>=len(recent)-5; i-- {
 		if recent[i].MoistState == "dry" { cntDry++ } else { break }
 	}
-	if cntDry >= 3 { return true, "soil moisture low 3+ days" }
-	return false, ""
-}
\ No newline at end of file
+	m.DryStreak = cntDry
+	if last.CaneHeightCM != nil && *last.CaneHeightCM < 0.85*expected {
+		return true, fmt.Sprintf("height drift: got %.1f vs %.1f", *last.CaneHeightCM, expected), m
+	}
+	if cntDry >= 3 { return true, "soil moisture low 3+ days", m }
+	return false, "", m
+}
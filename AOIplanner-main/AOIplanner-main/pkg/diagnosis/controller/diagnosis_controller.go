@@ -0,0 +1,8 @@
+package controller
+
+import "github.com/labstack/echo/v4"
+
+type DiagnosisController interface {
+	List(c echo.Context) error
+	Rediagnose(c echo.Context) error
+}
@@ -0,0 +1,55 @@
+package controllerImp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"aoi/pkg/diagnosis/service"
+	"aoi/pkg/diagnosis/serviceImp"
+	"aoi/pkg/i18n"
+)
+
+type DiagnosisCtrl struct{ svc service.DiagnosisService }
+
+func New(svc service.DiagnosisService) *DiagnosisCtrl { return &DiagnosisCtrl{svc: svc} }
+
+// List returns the field's photo diagnoses, newest first.
+func (h *DiagnosisCtrl) List(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	ds, err := h.svc.List(uint(fid), uid)
+	if err != nil {
+		return diagnosisError(c, err)
+	}
+	loc := i18n.FromContext(c.Request().Context())
+	for i := range ds {
+		serviceImp.Localize(&ds[i], loc)
+	}
+	return c.JSON(http.StatusOK, ds)
+}
+
+// Rediagnose reads a measurement's photo again (e.g. after a vision model
+// was configured).
+func (h *DiagnosisCtrl) Rediagnose(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	id, _ := strconv.Atoi(c.Param("measure_id"))
+	d, err := h.svc.Rediagnose(c.Request().Context(), uint(id), uid)
+	if err != nil {
+		return diagnosisError(c, err)
+	}
+	return c.JSON(http.StatusCreated, d)
+}
+
+func diagnosisError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, serviceImp.ErrNoPhoto):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "not found"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,15 @@
+package repository
+
+import (
+	"time"
+
+	"aoi/entities"
+)
+
+type DiagnosisRepository interface {
+	Create(d *entities.PhotoDiagnosis) error
+	Save(d *entities.PhotoDiagnosis) error
+	ListByField(fieldID uint, limit int) ([]entities.PhotoDiagnosis, error) // newest first
+	ListByMeasure(measureID uint) ([]entities.PhotoDiagnosis, error)        // newest first
+	Confident(fieldID uint, since time.Time, minConfidence float64) ([]entities.PhotoDiagnosis, error)
+}
@@ -0,0 +1,43 @@
+package repositoryImp
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"aoi/entities"
+	"aoi/pkg/diagnosis/repository"
+)
+
+type diagnosisRepo struct{ db *gorm.DB }
+
+func New(db *gorm.DB) repository.DiagnosisRepository { return &diagnosisRepo{db} }
+
+func (r *diagnosisRepo) Create(d *entities.PhotoDiagnosis) error { return r.db.Create(d).Error }
+
+func (r *diagnosisRepo) Save(d *entities.PhotoDiagnosis) error { return r.db.Save(d).Error }
+
+func (r *diagnosisRepo) ListByField(fieldID uint, limit int) ([]entities.PhotoDiagnosis, error) {
+	var out []entities.PhotoDiagnosis
+	if err := r.db.Where("field_id = ?", fieldID).Order("created_at DESC, diagnosis_id DESC").Limit(limit).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *diagnosisRepo) ListByMeasure(measureID uint) ([]entities.PhotoDiagnosis, error) {
+	var out []entities.PhotoDiagnosis
+	if err := r.db.Where("measure_id = ?", measureID).Order("created_at DESC, diagnosis_id DESC").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (r *diagnosisRepo) Confident(fieldID uint, since time.Time, minConfidence float64) ([]entities.PhotoDiagnosis, error) {
+	var out []entities.PhotoDiagnosis
+	if err := r.db.Where("field_id = ? AND created_at >= ? AND confidence >= ?", fieldID, since, minConfidence).
+		Order("created_at DESC, diagnosis_id DESC").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,20 @@
+package service
+
+import (
+	"context"
+
+	"aoi/entities"
+)
+
+type DiagnosisService interface {
+	// Diagnose reads the measurement's photo and stores the result; uid must
+	// own the field. A confident finding adds tasks to the schedule.
+	Diagnose(ctx context.Context, m *entities.Measurement, uid string) (*entities.PhotoDiagnosis, error)
+	// Rediagnose runs Diagnose again on a stored measurement.
+	Rediagnose(ctx context.Context, measureID uint, uid string) (*entities.PhotoDiagnosis, error)
+	List(fieldID uint, uid string) ([]entities.PhotoDiagnosis, error)
+
+	// RecentCodes are the problem codes confidently diagnosed on the field
+	// lately, for the replan problem list.
+	RecentCodes(ctx context.Context, fieldID uint) ([]string, error)
+}
@@ -0,0 +1,268 @@
+package serviceImp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/ai"
+	"aoi/pkg/diagnosis/repository"
+	"aoi/pkg/diagnosis/service"
+	fieldrepo "aoi/pkg/field/repository"
+	"aoi/pkg/i18n"
+	measrepo "aoi/pkg/measure/repository"
+	planSvc "aoi/pkg/plan/serviceImp"
+	"aoi/pkg/plan/types"
+	"aoi/pkg/problem"
+	schedsvc "aoi/pkg/schedule/service"
+)
+
+// ErrNoPhoto is returned when the measurement has no photo, or the photo
+// cannot be read as an image.
+var ErrNoPhoto = errors.New("measurement has no readable photo")
+
+const (
+	// UploadPrefix is the URL path uploaded photos are served under.
+	UploadPrefix = "/uploads/"
+	// MaxPhotoBytes bounds an uploaded photo.
+	MaxPhotoBytes = 8 << 20
+
+	recentDays = 14 // diagnoses that feed a replan
+	listLimit  = 50
+	dedupeDays = 7 // an auto task is skipped if the same one is scheduled this soon
+)
+
+type diagnosisSvc struct {
+	repo    repository.DiagnosisRepository
+	fields  fieldrepo.FieldRepository
+	meas    measrepo.MeasureRepository
+	edits   schedsvc.ScheduleService
+	llm     ai.Client
+	loc     *time.Location
+	uploads string  // directory behind UploadPrefix
+	minConf float64 // confidence from which findings add tasks and feed replans
+	timeout time.Duration
+}
+
+var _ service.DiagnosisService = (*diagnosisSvc)(nil)
+
+// New builds the diagnosis service; a zero timeout takes the planner's
+// default LLM budget.
+func New(repo repository.DiagnosisRepository, fields fieldrepo.FieldRepository, meas measrepo.MeasureRepository, edits schedsvc.ScheduleService,
+	llm ai.Client, loc *time.Location, uploads string, minConf float64, timeout time.Duration) service.DiagnosisService {
+	if loc == nil {
+		loc = time.Local
+	}
+	if timeout <= 0 {
+		timeout = planSvc.DefaultBudgets.Summary
+	}
+	return &diagnosisSvc{repo: repo, fields: fields, meas: meas, edits: edits, llm: llm, loc: loc, uploads: uploads, minConf: minConf,
+		timeout: timeout}
+}
+
+func (s *diagnosisSvc) Diagnose(ctx context.Context, m *entities.Measurement, uid string) (*entities.PhotoDiagnosis, error) {
+	f, err := s.fields.FindByID(m.FieldID, uid)
+	if err != nil {
+		return nil, err
+	}
+	img, err := s.loadImage(m.PhotoURL)
+	if err != nil {
+		return nil, err
+	}
+	today := time.Now().In(s.loc).Format("2006-01-02")
+	req := ai.DiagnoseRequest{Field: f, Today: today, Image: img, Note: m.Note}
+
+	lctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	lctx, ci := ai.WithCallInfo(lctx)
+	res, err := s.llm.Diagnose(lctx, req)
+	d := &entities.PhotoDiagnosis{MeasureID: m.MeasureID, FieldID: f.FieldID, PhotoURL: m.PhotoURL, Provider: ci.Provider}
+	if err != nil {
+		log.Printf("[diagnosis] measurement #%d fell back to the stub: %v", m.MeasureID, err)
+		res = ai.StubDiagnose(ctx, req)
+		d.Provider, d.Fallback = "", true
+	}
+	d.Code, d.Label, d.Confidence, d.Findings, d.Actions = res.Code, label(res.Code, i18n.Default), res.Confidence, res.Findings, res.Actions
+	if err := s.repo.Create(d); err != nil {
+		return nil, err
+	}
+	if p, ok := s.confident(d); ok {
+		d.TaskIDs = s.addTasks(f, uid, p, d, today)
+		if len(d.TaskIDs) > 0 {
+			if err := s.repo.Save(d); err != nil {
+				return nil, err
+			}
+		}
+	}
+	Localize(d, i18n.FromContext(ctx))
+	return d, nil
+}
+
+func (s *diagnosisSvc) Rediagnose(ctx context.Context, measureID uint, uid string) (*entities.PhotoDiagnosis, error) {
+	m, err := s.meas.FindByID(measureID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Diagnose(ctx, m, uid)
+}
+
+func (s *diagnosisSvc) List(fieldID uint, uid string) ([]entities.PhotoDiagnosis, error) {
+	if _, err := s.fields.FindByID(fieldID, uid); err != nil {
+		return nil, err
+	}
+	return s.repo.ListByField(fieldID, listLimit)
+}
+
+func (s *diagnosisSvc) RecentCodes(ctx context.Context, fieldID uint) ([]string, error) {
+	ds, err := s.repo.Confident(fieldID, time.Now().AddDate(0, 0, -recentDays), s.minConf)
+	if err != nil {
+		return nil, err
+	}
+	var codes []string
+	for i := range ds {
+		if _, ok := s.confident(&ds[i]); ok && !contains(codes, ds[i].Code) {
+			codes = append(codes, ds[i].Code)
+		}
+	}
+	return codes, nil
+}
+
+// confident returns the catalogue problem of a diagnosis that is sure enough
+// to act on.
+func (s *diagnosisSvc) confident(d *entities.PhotoDiagnosis) (problem.Problem, bool) {
+	if d.Confidence < s.minConf {
+		return problem.Problem{}, false
+	}
+	return problem.Lookup(d.Code)
+}
+
+// addTasks schedules today the inspect and treatment (pesticide) actions of
+// a confident diagnosis, with an inspection when none was recommended. Tasks
+// already scheduled in the coming week are skipped; edits the schedule
+// rejects (no active plan, crop cycle...) are logged and skipped.
+func (s *diagnosisSvc) addTasks(f *entities.Field, uid string, p problem.Problem, d *entities.PhotoDiagnosis, today string) []uint {
+	var ops []types.PlanOp
+	for _, op := range d.Actions {
+		if op.Type == "inspect" || op.Type == "pesticide" {
+			ops = append(ops, op)
+		}
+	}
+	if !hasType(ops, "inspect") {
+		ops = append([]types.PlanOp{i18n.Op("inspect", "diagnosis.confirm", map[string]string{"problem": "@" + problem.LabelKey(p.Code)})}, ops...)
+	}
+	date, _ := time.ParseInLocation("2006-01-02", today, s.loc)
+	existing, err := s.edits.List(f.FieldID, today, date.AddDate(0, 0, dedupeDays).Format("2006-01-02"))
+	if err != nil {
+		log.Printf("[diagnosis] field #%d schedule: %v", f.FieldID, err)
+		return nil
+	}
+	var ids []uint
+	for _, op := range ops {
+		// stored text is in the default locale, whatever the request's
+		key, params := op.Key, op.Params
+		if key == "" {
+			key, params = i18n.Verbatim, i18n.VerbatimParams(op.Title, op.Notes)
+		}
+		params = i18n.AddNote(params, "note.diagnosis", map[string]string{
+			"diagnosis":  strconv.FormatUint(uint64(d.DiagnosisID), 10),
+			"problem":    "@" + problem.LabelKey(p.Code),
+			"confidence": fmt.Sprintf("%.0f", d.Confidence*100),
+		})
+		title, notes := i18n.Task(i18n.Default, key, params)
+		if scheduled(existing, op.Type, title) {
+			continue
+		}
+		t, err := s.edits.Create(f.FieldID, uid, schedsvc.NewTask{
+			Date: date, Type: op.Type, Title: title, Qty: op.Qty, Unit: op.Unit, Notes: notes, MsgKey: key, MsgParams: params,
+		})
+		if err != nil {
+			log.Printf("[diagnosis] field #%d task %q not added: %v", f.FieldID, title, err)
+			continue
+		}
+		ids = append(ids, t.TaskID)
+	}
+	return ids
+}
+
+func scheduled(tasks []entities.ScheduleTask, typ, title string) bool {
+	for _, t := range tasks {
+		if t.Type == typ && t.Title == title {
+			return true
+		}
+	}
+	return false
+}
+
+func hasType(ops []types.PlanOp, typ string) bool {
+	for _, op := range ops {
+		if op.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// loadImage reads a photo this server saved in the upload directory. Other
+// URLs (a photo_url sent by the client) are never fetched: the server would
+// otherwise make requests to any host on the user's behalf.
+func (s *diagnosisSvc) loadImage(url string) (ai.Image, error) {
+	name, ok := strings.CutPrefix(url, UploadPrefix)
+	if !ok || name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return ai.Image{}, fmt.Errorf("%w: %q is not an uploaded photo", ErrNoPhoto, url)
+	}
+	fh, err := os.Open(filepath.Join(s.uploads, name))
+	if err != nil {
+		return ai.Image{}, fmt.Errorf("%w: %v", ErrNoPhoto, err)
+	}
+	defer fh.Close()
+	data, err := io.ReadAll(io.LimitReader(fh, MaxPhotoBytes+1))
+	if err != nil {
+		return ai.Image{}, fmt.Errorf("%w: %v", ErrNoPhoto, err)
+	}
+	if len(data) > MaxPhotoBytes {
+		return ai.Image{}, fmt.Errorf("%w: larger than %d MB", ErrNoPhoto, MaxPhotoBytes>>20)
+	}
+	mime := http.DetectContentType(data)
+	if !strings.HasPrefix(mime, "image/") {
+		return ai.Image{}, fmt.Errorf("%w: %s is not an image", ErrNoPhoto, mime)
+	}
+	return ai.Image{MIME: mime, Data: data}, nil
+}
+
+// Localize renders a stored diagnosis's label and catalogue actions in loc;
+// the findings stay in the language they were written in.
+func Localize(d *entities.PhotoDiagnosis, loc string) {
+	d.Label = label(d.Code, loc)
+	i18n.LocalizeOps(d.Actions, loc)
+}
+
+func label(code, loc string) string {
+	switch code {
+	case ai.DiagnosisHealthy:
+		return i18n.T(loc, "diagnosis.healthy", nil)
+	case ai.DiagnosisUnknown:
+		return i18n.T(loc, "diagnosis.unknown", nil)
+	}
+	if p, ok := problem.Lookup(code); ok {
+		return p.Label(loc)
+	}
+	return code
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
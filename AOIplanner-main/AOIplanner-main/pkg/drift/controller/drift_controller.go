@@ -0,0 +1,7 @@
+package controller
+
+import "github.com/labstack/echo/v4"
+
+type DriftController interface {
+	Status(c echo.Context) error
+}
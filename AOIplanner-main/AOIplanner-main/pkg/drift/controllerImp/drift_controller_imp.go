@@ -0,0 +1,40 @@
+package controllerImp
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"aoi/pkg/drift/service"
+	fieldrepo "aoi/pkg/field/repository"
+)
+
+type DriftCtrl struct {
+	svc    service.DriftService
+	fields fieldrepo.FieldRepository
+}
+
+func New(svc service.DriftService, fields fieldrepo.FieldRepository) *DriftCtrl {
+	return &DriftCtrl{svc: svc, fields: fields}
+}
+
+// Status returns the field's last nightly drift outcome and its recent alerts.
+func (h *DriftCtrl) Status(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	f, err := h.fields.FindByID(uint(fid), uid)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "field not found"})
+	}
+	st, alerts, err := h.svc.Status(f.FieldID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]any{
+		"field_id":    f.FieldID,
+		"policy":      f.DriftPolicy,
+		"last_status": st,
+		"alerts":      alerts,
+	})
+}
@@ -0,0 +1,12 @@
+package repository
+
+import "aoi/entities"
+
+type DriftRepository interface {
+	CreateRun(r *entities.DriftRun) error
+	SaveRun(r *entities.DriftRun) error
+	UpsertStatus(st *entities.FieldDriftStatus) error
+	StatusByField(fieldID uint) (*entities.FieldDriftStatus, error)
+	CreateAlert(a *entities.DriftAlert) error
+	AlertsByField(fieldID uint, limit int) ([]entities.DriftAlert, error)
+}
@@ -0,0 +1,39 @@
+package repositoryImp
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"aoi/entities"
+	"aoi/pkg/drift/repository"
+)
+
+type driftRepo struct{ db *gorm.DB }
+
+func New(db *gorm.DB) repository.DriftRepository { return &driftRepo{db} }
+
+func (r *driftRepo) CreateRun(run *entities.DriftRun) error { return r.db.Create(run).Error }
+
+func (r *driftRepo) SaveRun(run *entities.DriftRun) error { return r.db.Save(run).Error }
+
+func (r *driftRepo) UpsertStatus(st *entities.FieldDriftStatus) error {
+	return r.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(st).Error
+}
+
+func (r *driftRepo) StatusByField(fieldID uint) (*entities.FieldDriftStatus, error) {
+	var st entities.FieldDriftStatus
+	if err := r.db.Where("field_id = ?", fieldID).First(&st).Error; err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+func (r *driftRepo) CreateAlert(a *entities.DriftAlert) error { return r.db.Create(a).Error }
+
+func (r *driftRepo) AlertsByField(fieldID uint, limit int) ([]entities.DriftAlert, error) {
+	var out []entities.DriftAlert
+	if err := r.db.Where("field_id = ?", fieldID).Order("alert_id DESC").Limit(limit).Find(&out).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
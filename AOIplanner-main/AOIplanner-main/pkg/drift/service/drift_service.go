@@ -0,0 +1,13 @@
+package service
+
+import (
+	"context"
+
+	"aoi/entities"
+)
+
+type DriftService interface {
+	// RunOnce evaluates every active field now and returns the persisted run.
+	RunOnce(ctx context.Context) (*entities.DriftRun, error)
+	Status(fieldID uint) (*entities.FieldDriftStatus, []entities.DriftAlert, error)
+}
@@ -0,0 +1,207 @@
+package serviceImp
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aoi/entities"
+	"aoi/pkg/drift/repository"
+	"aoi/pkg/drift/service"
+	fieldrepo "aoi/pkg/field/repository"
+	planSvc "aoi/pkg/plan/serviceImp"
+	"aoi/pkg/plan/types"
+)
+
+type planner interface {
+	CheckDrift(ctx context.Context, f *entities.Field) (*planSvc.DriftCheck, error)
+	ReplanWithOptions(ctx context.Context, f *entities.Field, opts planSvc.ReplanOptions) (*entities.Plan, []entities.ScheduleTask, *entities.ReplanLog, error)
+}
+
+// Worker evaluates drift on every active field once a day at hour:00 in loc
+// and, per field policy, either replans or raises an alert.
+type Worker struct {
+	repo   repository.DriftRepository
+	fields fieldrepo.FieldRepository
+	plans  planner
+	loc    *time.Location
+	hour   int
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+var _ service.DriftService = (*Worker)(nil)
+
+func New(repo repository.DriftRepository, fields fieldrepo.FieldRepository, plans planner, loc *time.Location, hour int) *Worker {
+	if loc == nil {
+		loc = time.Local
+	}
+	return &Worker{repo: repo, fields: fields, plans: plans, loc: loc, hour: hour}
+}
+
+// Start launches the daily loop in the background; Stop ends it.
+func (w *Worker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go w.loop(ctx)
+}
+
+// Stop cancels the loop (and a run in progress, including its LLM and KB
+// calls) and waits for it to exit or for ctx to expire.
+func (w *Worker) Stop(ctx context.Context) error {
+	if w.cancel == nil {
+		return nil
+	}
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	defer close(w.done)
+	for {
+		next := nextRunAt(time.Now().In(w.loc), w.hour)
+		log.Printf("[drift] next run at %s", next.Format(time.RFC3339))
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		if _, err := w.RunOnce(ctx); err != nil {
+			log.Printf("[drift] run failed: %v", err)
+		}
+	}
+}
+
+// nextRunAt returns the next hour:00 strictly after now, in now's location.
+func nextRunAt(now time.Time, hour int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+func (w *Worker) RunOnce(ctx context.Context) (*entities.DriftRun, error) {
+	run := &entities.DriftRun{StartedAt: time.Now(), Status: "running"}
+	if err := w.repo.CreateRun(run); err != nil {
+		return nil, err
+	}
+	fields, err := w.fields.ListAll()
+	if err != nil {
+		run.Status = "error"
+		w.finish(run)
+		return run, err
+	}
+
+	today := time.Now().In(w.loc).Format("2006-01-02")
+	for i := range fields {
+		if ctx.Err() != nil {
+			run.Status = "cancelled"
+			break
+		}
+		f := fields[i]
+		policy := f.DriftPolicy
+		if policy == "" {
+			policy = entities.DriftPolicyAlert
+		}
+		if policy == entities.DriftPolicyOff {
+			continue
+		}
+
+		chk, err := w.plans.CheckDrift(ctx, &f)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue // no plan yet
+		}
+		st := &entities.FieldDriftStatus{FieldID: f.FieldID, RunID: run.RunID, CheckedAt: time.Now()}
+		if err != nil {
+			run.Errors++
+			st.Outcome, st.Reason = entities.DriftOutcomeError, err.Error()
+			w.saveStatus(st)
+			continue
+		}
+		if !seasonActive(chk.Stages, today) {
+			continue
+		}
+
+		run.Fields++
+		st.PlanID, st.Reason, st.Drift = chk.Plan.PlanID, chk.Reason, chk.Metrics
+		switch {
+		case !chk.Need:
+			run.NoDrift++
+			st.Outcome = entities.ReplanOutcomeNoDrift
+		case policy == entities.DriftPolicyAutoReplan:
+			p, _, _, err := w.plans.ReplanWithOptions(ctx, &f, planSvc.ReplanOptions{Reason: "nightly drift check"})
+			if err != nil {
+				run.Errors++
+				st.Outcome, st.Reason = entities.DriftOutcomeError, err.Error()
+				break
+			}
+			run.Replanned++
+			st.Outcome, st.PlanID = entities.ReplanOutcomeReplanned, p.PlanID
+		default:
+			a := &entities.DriftAlert{FieldID: f.FieldID, RunID: run.RunID, PlanID: chk.Plan.PlanID, Reason: chk.Reason, Drift: chk.Metrics}
+			if err := w.repo.CreateAlert(a); err != nil {
+				run.Errors++
+				st.Outcome, st.Reason = entities.DriftOutcomeError, err.Error()
+				break
+			}
+			run.Alerts++
+			st.Outcome = entities.DriftOutcomeAlert
+		}
+		w.saveStatus(st)
+	}
+
+	if run.Status == "running" {
+		run.Status = "done"
+	}
+	w.finish(run)
+	log.Printf("[drift] run #%d %s: fields=%d no_drift=%d replanned=%d alerts=%d errors=%d",
+		run.RunID, run.Status, run.Fields, run.NoDrift, run.Replanned, run.Alerts, run.Errors)
+	return run, nil
+}
+
+func (w *Worker) Status(fieldID uint) (*entities.FieldDriftStatus, []entities.DriftAlert, error) {
+	st, err := w.repo.StatusByField(fieldID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+	alerts, err := w.repo.AlertsByField(fieldID, 20)
+	if err != nil {
+		return nil, nil, err
+	}
+	return st, alerts, nil
+}
+
+func (w *Worker) finish(run *entities.DriftRun) {
+	now := time.Now()
+	run.FinishedAt = &now
+	if err := w.repo.SaveRun(run); err != nil {
+		log.Printf("[drift] save run #%d: %v", run.RunID, err)
+	}
+}
+
+func (w *Worker) saveStatus(st *entities.FieldDriftStatus) {
+	if err := w.repo.UpsertStatus(st); err != nil {
+		log.Printf("[drift] save status field #%d: %v", st.FieldID, err)
+	}
+}
+
+// seasonActive reports whether today falls before the end of the last stage.
+func seasonActive(stages []types.StagePlan, today string) bool {
+	if len(stages) == 0 {
+		return true
+	}
+	return stages[len(stages)-1].EndDate >= today
+}
@@ -0,0 +1,8 @@
+package controller
+
+import "github.com/labstack/echo/v4"
+
+type ExportController interface {
+	Workbook(c echo.Context) error
+	Report(c echo.Context) error
+}
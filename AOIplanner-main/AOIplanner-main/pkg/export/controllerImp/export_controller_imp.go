@@ -0,0 +1,62 @@
+package controllerImp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"aoi/pkg/export/service"
+)
+
+type ExportCtrl struct{ svc service.ExportService }
+
+func New(svc service.ExportService) *ExportCtrl { return &ExportCtrl{svc: svc} }
+
+// Workbook downloads field profile, stages, task calendar, monthly summary,
+// measurements, deliveries and replan history as one .xlsx file.
+func (h *ExportCtrl) Workbook(c echo.Context) error {
+	d, err := h.load(c)
+	if err != nil || d == nil {
+		return err
+	}
+	b, err := h.svc.Workbook(d)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	name := fmt.Sprintf("field-%d-%s.xlsx", d.Field.FieldID, time.Now().Format("20060102"))
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+name+`"`)
+	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", b)
+}
+
+// Report serves the printable HTML season report of a field.
+func (h *ExportCtrl) Report(c echo.Context) error {
+	d, err := h.load(c)
+	if err != nil || d == nil {
+		return err
+	}
+	b, err := h.svc.Report(d)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.HTMLBlob(http.StatusOK, b)
+}
+
+// load fetches the caller's field dossier; on failure it writes the error
+// response and returns a nil dossier.
+func (h *ExportCtrl) load(c echo.Context) (*service.Dossier, error) {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	d, err := h.svc.Load(uint(fid), uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.JSON(http.StatusNotFound, map[string]string{"error": "field not found"})
+		}
+		return nil, c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return d, nil
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"aoi/entities"
+	"aoi/pkg/delivery"
+	"aoi/pkg/plan/types"
+)
+
+// Dossier is everything known about one field, gathered for exports and reports.
+type Dossier struct {
+	Field        *entities.Field
+	Plan         *entities.Plan // approved plan; nil until one is approved
+	Stages       []types.StagePlan
+	Tasks        []entities.ScheduleTask // tasks of the active plan
+	Measurements []entities.Measurement
+	Deliveries   []delivery.Delivery
+	Replans      []entities.ReplanLog
+}
+
+type ExportService interface {
+	Load(fieldID uint, uid string) (*Dossier, error)
+	Workbook(d *Dossier) ([]byte, error)
+	Report(d *Dossier) ([]byte, error)
+}
@@ -0,0 +1,60 @@
+package serviceImp
+
+import (
+	"encoding/json"
+	"errors"
+
+	"gorm.io/gorm"
+
+	dsvc "aoi/pkg/delivery/service"
+	"aoi/pkg/export/service"
+	fieldrepo "aoi/pkg/field/repository"
+	measrepo "aoi/pkg/measure/repository"
+	planrepo "aoi/pkg/plan/repository"
+	schedrepo "aoi/pkg/schedule/repository"
+)
+
+type exportSvc struct {
+	fields     fieldrepo.FieldRepository
+	plans      planrepo.PlanRepository
+	sched      schedrepo.ScheduleRepository
+	meas       measrepo.MeasureRepository
+	deliveries dsvc.Service
+}
+
+func New(fr fieldrepo.FieldRepository, pr planrepo.PlanRepository, sr schedrepo.ScheduleRepository, mr measrepo.MeasureRepository, ds dsvc.Service) service.ExportService {
+	return &exportSvc{fields: fr, plans: pr, sched: sr, meas: mr, deliveries: ds}
+}
+
+// Load gathers the field (owned by uid), its approved plan with stages and
+// tasks, all measurements, deliveries and the replan timeline.
+func (s *exportSvc) Load(fieldID uint, uid string) (*service.Dossier, error) {
+	f, err := s.fields.FindByID(fieldID, uid)
+	if err != nil {
+		return nil, err
+	}
+	d := &service.Dossier{Field: f}
+
+	p, err := s.plans.CurrentByField(f.FieldID)
+	switch {
+	case err == nil:
+		d.Plan = p
+		_ = json.Unmarshal([]byte(p.StagesJSON), &d.Stages)
+		if d.Tasks, err = s.sched.ListByPlan(p.PlanID); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	if d.Measurements, err = s.meas.ListByField(f.FieldID); err != nil {
+		return nil, err
+	}
+	if d.Deliveries, err = s.deliveries.ListByField(f.FieldID, nil, nil); err != nil {
+		return nil, err
+	}
+	if d.Replans, err = s.plans.ListReplanLogs(f.FieldID); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,268 @@
+package serviceImp
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+	"time"
+
+	"aoi/pkg/export/service"
+)
+
+//go:embed templates/report.html
+var reportFS embed.FS
+
+var reportTmpl = template.Must(template.New("report.html").Funcs(template.FuncMap{
+	"taskType": TaskTypeLabel,
+	"num":      func(v float64) string { return fmt.Sprintf("%.1f", v) },
+	"nump": func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%.1f", *v)
+	},
+	"date": func(t time.Time) string { return t.Format("2006-01-02") },
+}).ParseFS(reportFS, "templates/report.html"))
+
+type reportData struct {
+	Dossier     *service.Dossier
+	Generated   time.Time
+	SummaryHTML template.HTML
+	Timeline    template.HTML
+	HeightChart template.HTML
+	MoistChart  template.HTML
+	RainChart   template.HTML
+	Months      []monthRow
+	Types       []string
+	Total       monthRow
+	DelivTon    float64
+	DelivAmount float64
+}
+
+// Report renders the dossier as a self-contained, print-optimised HTML page.
+func (s *exportSvc) Report(d *service.Dossier) ([]byte, error) {
+	rd := reportData{Dossier: d, Generated: time.Now()}
+	if d.Plan != nil {
+		rd.SummaryHTML = markdownHTML(d.Plan.SummaryMD)
+	}
+	rd.Timeline = stageTimeline(d)
+	rd.Months, rd.Types, rd.Total = monthlySummary(d.Tasks)
+
+	var height, moist, rain []point
+	for _, m := range d.Measurements {
+		if m.CaneHeightCM != nil {
+			height = append(height, point{m.Date, *m.CaneHeightCM})
+		}
+		if m.SoilMoistPct != nil {
+			moist = append(moist, point{m.Date, *m.SoilMoistPct})
+		}
+		if m.RainfallMM != nil {
+			rain = append(rain, point{m.Date, *m.RainfallMM})
+		}
+	}
+	rd.HeightChart = lineChart(height, "ซม.", "#2e7d32", false)
+	rd.MoistChart = lineChart(moist, "%", "#1565c0", false)
+	rd.RainChart = lineChart(rain, "มม.", "#0097a7", true)
+
+	for _, dl := range d.Deliveries {
+		if dl.ActualWeightTon != nil {
+			rd.DelivTon += *dl.ActualWeightTon
+		}
+		if dl.NetAmount != nil {
+			rd.DelivAmount += *dl.NetAmount
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := reportTmpl.Execute(&buf, rd); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var (
+	mdBold   = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mdItalic = regexp.MustCompile(`(^|[^*])\*([^*]+?)\*`)
+	mdCode   = regexp.MustCompile("`([^`]+)`")
+)
+
+// markdownHTML renders the small Markdown subset the planner emits (headings,
+// bullet/numbered lists, bold, italic, code, paragraphs). All text is escaped
+// before any tag is added, so LLM output can never inject markup.
+func markdownHTML(md string) template.HTML {
+	var b strings.Builder
+	list := ""
+	closeList := func() {
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+	openList := func(tag string) {
+		if list != tag {
+			closeList()
+			b.WriteString("<" + tag + ">\n")
+			list = tag
+		}
+	}
+	inline := func(s string) string {
+		s = html.EscapeString(strings.TrimSpace(s))
+		s = mdCode.ReplaceAllString(s, "<code>$1</code>")
+		s = mdBold.ReplaceAllString(s, "<strong>$1</strong>")
+		return mdItalic.ReplaceAllString(s, "$1<em>$2</em>")
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(md, "\r\n", "\n"), "\n") {
+		t := strings.TrimSpace(line)
+		switch {
+		case t == "":
+			closeList()
+		case strings.HasPrefix(t, "#"):
+			closeList()
+			lvl := len(t) - len(strings.TrimLeft(t, "#"))
+			if lvl > 4 {
+				lvl = 4
+			}
+			// the report itself uses h1/h2, so summary headings start at h3
+			tag := fmt.Sprintf("h%d", min(lvl+2, 6))
+			b.WriteString("<" + tag + ">" + inline(strings.TrimLeft(t, "#")) + "</" + tag + ">\n")
+		case strings.HasPrefix(t, "- ") || strings.HasPrefix(t, "* "):
+			openList("ul")
+			b.WriteString("<li>" + inline(t[2:]) + "</li>\n")
+		case isOrdered(t):
+			openList("ol")
+			b.WriteString("<li>" + inline(t[strings.Index(t, ".")+1:]) + "</li>\n")
+		default:
+			closeList()
+			b.WriteString("<p>" + inline(t) + "</p>\n")
+		}
+	}
+	closeList()
+	return template.HTML(b.String())
+}
+
+func isOrdered(t string) bool {
+	i := 0
+	for i < len(t) && t[i] >= '0' && t[i] <= '9' {
+		i++
+	}
+	return i > 0 && i+1 < len(t) && t[i] == '.' && t[i+1] == ' '
+}
+
+type point struct {
+	Date  time.Time
+	Value float64
+}
+
+const (
+	chartW   = 680
+	chartH   = 180
+	chartPad = 36
+)
+
+// lineChart draws values over time as an inline SVG (bars when bars is set).
+// Only numbers and fixed labels go into the markup.
+func lineChart(pts []point, unit, color string, bars bool) template.HTML {
+	if len(pts) == 0 {
+		return ""
+	}
+	t0, t1 := pts[0].Date, pts[len(pts)-1].Date
+	span := t1.Sub(t0).Hours()
+	if span <= 0 {
+		span = 24
+	}
+	vmax := 0.0
+	for _, p := range pts {
+		vmax = max(vmax, p.Value)
+	}
+	if vmax <= 0 {
+		vmax = 1
+	}
+	plotW, plotH := float64(chartW-2*chartPad), float64(chartH-2*chartPad)
+	x := func(t time.Time) float64 { return chartPad + t.Sub(t0).Hours()/span*plotW }
+	y := func(v float64) float64 { return chartPad + plotH - v/vmax*plotH }
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">`, chartW, chartH)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, chartPad, chartH-chartPad, chartW-chartPad, chartH-chartPad)
+	fmt.Fprintf(&b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="#999"/>`, chartPad, chartPad, chartPad, chartH-chartPad)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="10" text-anchor="end">%.0f</text>`, chartPad-4, chartPad+4, vmax)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="10" text-anchor="end">0</text>`, chartPad-4, chartH-chartPad)
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="10">%s</text>`, 4, chartPad-12, html.EscapeString(unit))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="10">%s</text>`, chartPad, chartH-chartPad+16, t0.Format("2006-01-02"))
+	fmt.Fprintf(&b, `<text x="%d" y="%d" font-size="10" text-anchor="end">%s</text>`, chartW-chartPad, chartH-chartPad+16, t1.Format("2006-01-02"))
+
+	if bars {
+		bw := max(plotW/float64(len(pts))*0.6, 2)
+		for _, p := range pts {
+			fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`, x(p.Date)-bw/2, y(p.Value), bw, chartPad+plotH-y(p.Value), color)
+		}
+	} else {
+		coords := make([]string, len(pts))
+		for i, p := range pts {
+			coords[i] = fmt.Sprintf("%.1f,%.1f", x(p.Date), y(p.Value))
+		}
+		fmt.Fprintf(&b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(coords, " "))
+		for _, c := range coords {
+			xy := strings.SplitN(c, ",", 2)
+			fmt.Fprintf(&b, `<circle cx="%s" cy="%s" r="2.5" fill="%s"/>`, xy[0], xy[1], color)
+		}
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// stageTimeline draws the plan's stages as a horizontal Gantt bar with a
+// marker for today.
+func stageTimeline(d *service.Dossier) template.HTML {
+	type span struct {
+		name       string
+		start, end time.Time
+	}
+	var spans []span
+	for _, st := range d.Stages {
+		s, err1 := time.Parse("2006-01-02", st.StartDate)
+		e, err2 := time.Parse("2006-01-02", st.EndDate)
+		if err1 != nil || err2 != nil || e.Before(s) {
+			continue
+		}
+		spans = append(spans, span{st.Stage, s, e.AddDate(0, 0, 1)})
+	}
+	if len(spans) == 0 {
+		return ""
+	}
+	t0, t1 := spans[0].start, spans[0].end
+	for _, sp := range spans {
+		if sp.start.Before(t0) {
+			t0 = sp.start
+		}
+		if sp.end.After(t1) {
+			t1 = sp.end
+		}
+	}
+	total := t1.Sub(t0).Hours()
+	colors := []string{"#a5d6a7", "#81c784", "#66bb6a", "#4caf50", "#388e3c", "#2e7d32"}
+	const rowH, labelW = 22, 120
+	plotW := float64(chartW - labelW - 10)
+	x := func(t time.Time) float64 { return labelW + t.Sub(t0).Hours()/total*plotW }
+	h := len(spans)*rowH + 24
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg class="chart" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">`, chartW, h)
+	for i, sp := range spans {
+		yy := i * rowH
+		fmt.Fprintf(&b, `<text x="0" y="%d" font-size="11">%s</text>`, yy+15, html.EscapeString(sp.name))
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s"/>`, x(sp.start), yy+3, x(sp.end)-x(sp.start), rowH-6, colors[i%len(colors)])
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" font-size="9" fill="#333">%s – %s</text>`, x(sp.start)+3, yy+15, sp.start.Format("02/01"), sp.end.AddDate(0, 0, -1).Format("02/01/06"))
+	}
+	if now := time.Now(); now.After(t0) && now.Before(t1) {
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="0" x2="%.1f" y2="%d" stroke="#c62828" stroke-dasharray="4 2"/>`, x(now), x(now), len(spans)*rowH)
+		fmt.Fprintf(&b, `<text x="%.1f" y="%d" font-size="10" fill="#c62828" text-anchor="middle">วันนี้</text>`, x(now), len(spans)*rowH+14)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
@@ -0,0 +1,61 @@
+package serviceImp
+
+import (
+	"sort"
+
+	"aoi/entities"
+)
+
+// monthRow aggregates the tasks of one month ("YYYY-MM", or "รวม" for the total row).
+type monthRow struct {
+	Month   string
+	ByType  map[string]int
+	Done    int
+	Total   int
+	WaterM3 float64
+	FertKg  float64
+}
+
+// monthlySummary groups tasks by month and type; it returns the month rows in
+// order, the sorted task types seen, and a grand-total row.
+func monthlySummary(tasks []entities.ScheduleTask) ([]monthRow, []string, monthRow) {
+	months := map[string]*monthRow{}
+	typeSet := map[string]bool{}
+	total := monthRow{Month: "รวม", ByType: map[string]int{}}
+	for _, t := range tasks {
+		m := t.Date.Format("2006-01")
+		r := months[m]
+		if r == nil {
+			r = &monthRow{Month: m, ByType: map[string]int{}}
+			months[m] = r
+		}
+		for _, a := range []*monthRow{r, &total} {
+			a.ByType[t.Type]++
+			a.Total++
+			if t.Status == "done" {
+				a.Done++
+			}
+			if t.Qty != nil {
+				switch {
+				case t.Type == "irrigation" && t.Unit == "m3":
+					a.WaterM3 += *t.Qty
+				case t.Type == "fertilizer" && t.Unit == "kg":
+					a.FertKg += *t.Qty
+				}
+			}
+		}
+		typeSet[t.Type] = true
+	}
+
+	rows := make([]monthRow, 0, len(months))
+	for _, r := range months {
+		rows = append(rows, *r)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Month < rows[j].Month })
+	types := make([]string, 0, len(typeSet))
+	for t := range typeSet {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return rows, types, total
+}
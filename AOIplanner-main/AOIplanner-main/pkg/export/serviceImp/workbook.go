@@ -0,0 +1,279 @@
+package serviceImp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"aoi/pkg/export/service"
+)
+
+// Sheet names (Thai, as used by mill extension officers).
+const (
+	sheetProfile      = "ข้อมูลแปลง"
+	sheetStages       = "ระยะการเจริญเติบโต"
+	sheetTasks        = "ปฏิทินงาน"
+	sheetMonthly      = "สรุปรายเดือน"
+	sheetMeasurements = "ผลการวัด"
+	sheetDeliveries   = "การส่งอ้อย"
+	sheetReplans      = "ประวัติการปรับแผน"
+)
+
+var taskTypeTH = map[string]string{
+	"irrigation": "ให้น้ำ",
+	"fertilizer": "ใส่ปุ๋ย",
+	"observe":    "วัด/บันทึก",
+	"inspect":    "สำรวจ",
+	"pesticide":  "ป้องกันศัตรูพืช",
+	"pest":       "ป้องกันศัตรูพืช",
+	"advisory":   "คำแนะนำ",
+}
+
+var statusTH = map[string]string{"todo": "รอทำ", "done": "เสร็จแล้ว", "skipped": "ข้าม"}
+
+// TaskTypeLabel returns the Thai label of a task type (or the type itself).
+func TaskTypeLabel(t string) string {
+	if v, ok := taskTypeTH[t]; ok {
+		return v
+	}
+	return t
+}
+
+// StatusLabel returns the Thai label of a task status (or the status itself).
+func StatusLabel(s string) string {
+	if v, ok := statusTH[s]; ok {
+		return v
+	}
+	return s
+}
+
+// Workbook renders the dossier as an .xlsx file.
+func (s *exportSvc) Workbook(d *service.Dossier) ([]byte, error) {
+	x := excelize.NewFile()
+	defer x.Close()
+
+	w := &sheetWriter{x: x}
+	if err := w.styles(); err != nil {
+		return nil, err
+	}
+
+	f := d.Field
+	pump := ""
+	if f.PumpM3H != nil {
+		pump = fmt.Sprintf("%.1f", *f.PumpM3H)
+	}
+	profile := [][]any{
+		{"รหัสแปลง", f.FieldID},
+		{"พันธุ์", f.Variety},
+		{"ประเภทอ้อย", f.CropType},
+		{"พื้นที่ (ไร่)", f.AreaRai},
+		{"จังหวัด", f.Province},
+		{"อำเภอ", f.District},
+		{"ลักษณะดิน", f.SoilTexture},
+		{"แหล่งน้ำ", f.IrrigationSrc},
+		{"ปั๊มน้ำ (ม³/ชม.)", pump},
+		{"ระดับงบประมาณ", f.BudgetTier},
+		{"ฐานปุ๋ย", f.FertBase},
+		{"วันปลูก", f.PlantingDate.Format("2006-01-02")},
+	}
+	if d.Plan != nil {
+		profile = append(profile,
+			[]any{"แผนฉบับที่", d.Plan.Version},
+			[]any{"สร้างแผนเมื่อ", d.Plan.CreatedAt},
+		)
+	}
+	w.table(sheetProfile, []string{"หัวข้อ", "ข้อมูล"}, profile, []float64{22, 40}, 0)
+
+	var stages [][]any
+	for _, st := range d.Stages {
+		stages = append(stages, []any{st.Stage, st.StartDate, st.EndDate, st.WaterMMDay, st.Notes})
+	}
+	w.table(sheetStages, []string{"ระยะ", "เริ่ม", "สิ้นสุด", "ความต้องการน้ำ (มม./วัน)", "หมายเหตุ"}, stages, []float64{18, 12, 12, 22, 40}, 0)
+
+	var tasks [][]any
+	for _, t := range d.Tasks {
+		var qty any
+		if t.Qty != nil {
+			qty = *t.Qty
+		}
+		tasks = append(tasks, []any{t.Date, t.Date.Format("2006-01"), TaskTypeLabel(t.Type), t.Title, qty, t.Unit, StatusLabel(t.Status), t.Notes})
+	}
+	w.table(sheetTasks, []string{"วันที่", "เดือน", "ประเภท", "งาน", "ปริมาณ", "หน่วย", "สถานะ", "หมายเหตุ"}, tasks, []float64{12, 9, 14, 30, 10, 8, 10, 40}, 1)
+
+	w.monthly(d)
+
+	var meas [][]any
+	for _, m := range d.Measurements {
+		meas = append(meas, []any{m.Date, deref(m.CaneHeightCM), deref(m.SoilMoistPct), m.MoistState, deref(m.RainfallMM), derefInt(m.PestScale), m.Note})
+	}
+	w.table(sheetMeasurements, []string{"วันที่", "ความสูง (ซม.)", "ความชื้นดิน (%)", "สภาพความชื้น", "ฝน (มม.)", "ระดับศัตรูพืช", "บันทึก"}, meas, []float64{12, 12, 14, 12, 10, 12, 40}, 1)
+
+	var dels [][]any
+	for _, dl := range d.Deliveries {
+		ticket := ""
+		if dl.TicketNo != nil {
+			ticket = *dl.TicketNo
+		}
+		dels = append(dels, []any{dl.Date, dl.MillName, dl.MillQuotaTon, dl.Status, ticket, deref(dl.ActualWeightTon), deref(dl.PricePerTon), deref(dl.NetAmount), dl.Notes})
+	}
+	w.table(sheetDeliveries, []string{"วันที่", "โรงงาน", "โควตา (ตัน)", "สถานะ", "เลขตั๋ว", "น้ำหนักจริง (ตัน)", "ราคา/ตัน", "ยอดสุทธิ (บาท)", "หมายเหตุ"}, dels, []float64{12, 20, 12, 12, 12, 16, 10, 14, 30}, 0)
+
+	var reps [][]any
+	for _, r := range d.Replans {
+		titles := make([]string, 0, len(r.ProposedOps))
+		for _, op := range r.ProposedOps {
+			titles = append(titles, op.Title)
+		}
+		reps = append(reps, []any{r.CreatedAt, r.Outcome, r.Reason, r.UserReason, strings.Join(r.Problems, ", "), strings.Join(titles, ", "), r.PlanID})
+	}
+	w.table(sheetReplans, []string{"วันที่", "ผลลัพธ์", "เหตุผล (ระบบ)", "เหตุผล (ผู้ใช้)", "ปัญหา", "งานที่เสนอ", "แผน"}, reps, []float64{18, 12, 30, 24, 24, 40, 8}, 0)
+
+	if err := w.err; err != nil {
+		return nil, err
+	}
+	x.SetActiveSheet(0)
+	x.DeleteSheet("Sheet1")
+	buf, err := x.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// monthly writes the month × task type pivot with water and fertilizer totals.
+func (w *sheetWriter) monthly(d *service.Dossier) {
+	months, types, sum := monthlySummary(d.Tasks)
+
+	head := []string{"เดือน"}
+	widths := []float64{10}
+	for _, t := range types {
+		head = append(head, TaskTypeLabel(t))
+		widths = append(widths, 12)
+	}
+	head = append(head, "งานทั้งหมด", "เสร็จแล้ว", "น้ำ (ม³)", "ปุ๋ย (กก.)")
+	widths = append(widths, 12, 10, 12, 12)
+
+	rows := make([][]any, 0, len(months)+1)
+	if len(months) > 0 {
+		months = append(months, sum)
+	}
+	for _, m := range months {
+		row := []any{m.Month}
+		for _, t := range types {
+			row = append(row, m.ByType[t])
+		}
+		rows = append(rows, append(row, m.Total, m.Done, m.WaterM3, m.FertKg))
+	}
+	w.table(sheetMonthly, head, rows, widths, 0)
+	if len(rows) > 0 {
+		last := len(rows) + 1
+		w.check(w.x.SetCellStyle(sheetMonthly, cellName(1, last), cellName(len(head)-2, last), w.total))
+		w.check(w.x.SetCellStyle(sheetMonthly, cellName(len(head)-1, last), cellName(len(head), last), w.totalNum))
+	}
+}
+
+type sheetWriter struct {
+	x                            *excelize.File
+	head, date, datetime, number int
+	total, totalNum              int
+	err                          error
+}
+
+func (w *sheetWriter) check(err error) {
+	if w.err == nil && err != nil {
+		w.err = err
+	}
+}
+
+func (w *sheetWriter) styles() error {
+	var err error
+	border := []excelize.Border{{Type: "bottom", Color: "1F4E78", Style: 2}}
+	if w.head, err = w.x.NewStyle(&excelize.Style{
+		Font:      &excelize.Font{Bold: true, Color: "FFFFFF"},
+		Fill:      excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"2E75B6"}},
+		Alignment: &excelize.Alignment{Horizontal: "center", Vertical: "center", WrapText: true},
+		Border:    border,
+	}); err != nil {
+		return err
+	}
+	dateFmt := "yyyy-mm-dd"
+	if w.date, err = w.x.NewStyle(&excelize.Style{CustomNumFmt: &dateFmt}); err != nil {
+		return err
+	}
+	dateTimeFmt := "yyyy-mm-dd hh:mm"
+	if w.datetime, err = w.x.NewStyle(&excelize.Style{CustomNumFmt: &dateTimeFmt}); err != nil {
+		return err
+	}
+	if w.number, err = w.x.NewStyle(&excelize.Style{NumFmt: 4}); err != nil { // #,##0.00
+		return err
+	}
+	totalFill := excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"DDEBF7"}}
+	if w.total, err = w.x.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}, Fill: totalFill}); err != nil {
+		return err
+	}
+	w.totalNum, err = w.x.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}, Fill: totalFill, NumFmt: 4})
+	return err
+}
+
+// table writes a header row plus data rows into a new sheet, freezes the
+// header and applies date/number formats. dateCol is the 1-based column
+// holding date-only values (0 = none); other times get a date-time format.
+func (w *sheetWriter) table(sheet string, head []string, rows [][]any, widths []float64, dateCol int) {
+	if w.err != nil {
+		return
+	}
+	if _, err := w.x.NewSheet(sheet); err != nil {
+		w.check(err)
+		return
+	}
+	hdr := make([]any, len(head))
+	for i, h := range head {
+		hdr[i] = h
+	}
+	w.check(w.x.SetSheetRow(sheet, "A1", &hdr))
+	w.check(w.x.SetCellStyle(sheet, "A1", cellName(len(head), 1), w.head))
+	w.check(w.x.SetRowHeight(sheet, 1, 24))
+	for i, wd := range widths {
+		col, _ := excelize.ColumnNumberToName(i + 1)
+		w.check(w.x.SetColWidth(sheet, col, col, wd))
+	}
+	for r, row := range rows {
+		w.check(w.x.SetSheetRow(sheet, cellName(1, r+2), &row))
+		for c, v := range row {
+			switch v.(type) {
+			case float64:
+				w.check(w.x.SetCellStyle(sheet, cellName(c+1, r+2), cellName(c+1, r+2), w.number))
+			case time.Time:
+				w.check(w.x.SetCellStyle(sheet, cellName(c+1, r+2), cellName(c+1, r+2), w.datetime))
+			}
+		}
+	}
+	if dateCol > 0 && len(rows) > 0 {
+		w.check(w.x.SetCellStyle(sheet, cellName(dateCol, 2), cellName(dateCol, len(rows)+1), w.date))
+	}
+	w.check(w.x.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}))
+	if len(rows) > 0 {
+		w.check(w.x.AutoFilter(sheet, "A1:"+cellName(len(head), len(rows)+1), nil))
+	}
+}
+
+func cellName(col, row int) string {
+	n, _ := excelize.CoordinatesToCellName(col, row)
+	return n
+}
+
+func deref(v *float64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func derefInt(v *int) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
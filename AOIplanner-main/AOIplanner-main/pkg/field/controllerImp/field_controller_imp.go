@@ -9,9 +9,15 @@ import (
 	"aoi/pkg/field/repository"
 )
 
-type FieldCtrl struct{ repo repository.FieldRepository }
+type FieldCtrl struct{ repo repository.FieldRepository; reviewers map[string]bool }
 
-func New(repo repository.FieldRepository) *FieldCtrl { return &FieldCtrl{repo} }
+// New wires the field handlers; reviewers are the user ids allowed to change
+// a field's require_approval.
+func New(repo repository.FieldRepository, reviewers []string) *FieldCtrl {
+	rv := map[string]bool{}
+	for _, uid := range reviewers { rv[uid] = true }
+	return &FieldCtrl{repo: repo, reviewers: rv}
+}
 
 type createReq struct {
 	Variety string `json:"variety"`
@@ -25,14 +31,16 @@ type createReq struct {
 	BudgetTier string `json:"budget_tier"`
 	FertBase string `json:"fert_base"`
 	PlantingDate string `json:"planting_date"`
+	DriftPolicy string `json:"drift_policy"`
 }
 
 func (h *FieldCtrl) Create(c echo.Context) error {
 	uid := c.Get("uid").(string)
 	var req createReq
 	if err := c.Bind(&req); err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"bad json"}) }
+	if !validDriftPolicy(req.DriftPolicy) { return c.JSON(http.StatusBadRequest, map[string]string{"error":"drift_policy must be auto_replan, alert or off"}) }
 	pd, _ := time.Parse("2006-01-02", req.PlantingDate)
-	f := &entities.Field{UserID: uid, Variety: req.Variety, CropType: req.CropType, AreaRai: req.AreaRai, Province: req.Province, District: req.District, SoilTexture: req.SoilTexture, PumpM3H: req.PumpM3H, IrrigationSrc: req.IrrigationSrc, BudgetTier: req.BudgetTier, FertBase: req.FertBase, PlantingDate: pd}
+	f := &entities.Field{UserID: uid, Variety: req.Variety, CropType: req.CropType, AreaRai: req.AreaRai, Province: req.Province, District: req.District, SoilTexture: req.SoilTexture, PumpM3H: req.PumpM3H, IrrigationSrc: req.IrrigationSrc, BudgetTier: req.BudgetTier, FertBase: req.FertBase, PlantingDate: pd, DriftPolicy: req.DriftPolicy}
 	if err := h.repo.Create(f); err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()}) }
 	return c.JSON(http.StatusCreated, f)
 }
@@ -43,4 +51,45 @@ func (h *FieldCtrl) Get(c echo.Context) error {
 	f, err := h.repo.FindByID(uint(id), uid)
 	if err != nil { return c.JSON(http.StatusNotFound, map[string]string{"error":"not found"}) }
 	return c.JSON(http.StatusOK, f)
-}
\ No newline at end of file
+}
+
+// Update changes a field's planner settings; omitted keys are left as they are.
+// The owner sets drift_policy; require_approval is the reviewers' gate, so
+// only they may change it (on any field).
+func (h *FieldCtrl) Update(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	id, _ := strconv.Atoi(c.Param("id"))
+	owner := true
+	f, err := h.repo.FindByID(uint(id), uid)
+	if err != nil && h.reviewers[uid] {
+		owner = false
+		f, err = h.repo.Find(uint(id))
+	}
+	if err != nil { return c.JSON(http.StatusNotFound, map[string]string{"error":"not found"}) }
+	var req struct {
+		DriftPolicy     *string `json:"drift_policy"`
+		RequireApproval *bool   `json:"require_approval"`
+	}
+	if err := c.Bind(&req); err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"bad json"}) }
+	if req.DriftPolicy != nil {
+		if !owner { return c.JSON(http.StatusForbidden, map[string]string{"error":"only the field owner can change drift_policy"}) }
+		if !validDriftPolicy(*req.DriftPolicy) { return c.JSON(http.StatusBadRequest, map[string]string{"error":"drift_policy must be auto_replan, alert or off"}) }
+		f.DriftPolicy = *req.DriftPolicy
+	}
+	if req.RequireApproval != nil {
+		if !h.reviewers[uid] { return c.JSON(http.StatusForbidden, map[string]string{"error":"only reviewers can change require_approval"}) }
+		f.RequireApproval = *req.RequireApproval
+	}
+	if err := h.repo.Save(f); err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()}) }
+	return c.JSON(http.StatusOK, f)
+}
+
+// validDriftPolicy: "" (the default, alert) or one of the drift policies the
+// drift worker knows.
+func validDriftPolicy(p string) bool {
+	switch p {
+	case "", entities.DriftPolicyAutoReplan, entities.DriftPolicyAlert, entities.DriftPolicyOff:
+		return true
+	}
+	return false
+}
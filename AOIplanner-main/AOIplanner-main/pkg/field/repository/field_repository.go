@@ -5,4 +5,8 @@ import "aoi/entities"
 type FieldRepository interface {
 	Create(f *entities.Field) error
 	FindByID(id uint, uid string) (*entities.Field, error)
+	Find(id uint) (*entities.Field, error) // any owner's; for reviewers
+	ListAll() ([]entities.Field, error)
+	ListByUser(uid string) ([]entities.Field, error)
+	Save(f *entities.Field) error
 }
\ No newline at end of file
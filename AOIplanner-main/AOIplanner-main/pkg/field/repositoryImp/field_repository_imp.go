@@ -16,4 +16,24 @@ func (r *fieldRepo) FindByID(id uint, uid string) (*entities.Field, error) {
 	var f entities.Field
 	if err := r.db.Where("field_id = ? AND user_id = ?", id, uid).First(&f).Error; err != nil { return nil, err }
 	return &f, nil
-}
\ No newline at end of file
+}
+
+func (r *fieldRepo) Find(id uint) (*entities.Field, error) {
+	var f entities.Field
+	if err := r.db.First(&f, id).Error; err != nil { return nil, err }
+	return &f, nil
+}
+
+func (r *fieldRepo) ListAll() ([]entities.Field, error) {
+	var fs []entities.Field
+	if err := r.db.Order("field_id ASC").Find(&fs).Error; err != nil { return nil, err }
+	return fs, nil
+}
+
+func (r *fieldRepo) ListByUser(uid string) ([]entities.Field, error) {
+	var fs []entities.Field
+	if err := r.db.Where("user_id = ?", uid).Order("field_id ASC").Find(&fs).Error; err != nil { return nil, err }
+	return fs, nil
+}
+
+func (r *fieldRepo) Save(f *entities.Field) error { return r.db.Save(f).Error }
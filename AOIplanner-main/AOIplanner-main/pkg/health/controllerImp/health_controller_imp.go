@@ -7,6 +7,8 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"gorm.io/gorm"
+
+	"aoi/pkg/outbound"
 )
 
 var appStart = time.Now()
@@ -37,6 +39,16 @@ func (h *HealthCtrl) Health(c echo.Context) error {
 		dbErr = "gorm db is nil"
 	}
 
+	// Open breakers do not fail the check: callers fall back while a target
+	// is down, so the service is degraded rather than unavailable.
+	breakers := outbound.States()
+	degraded := false
+	for _, b := range breakers {
+		if b.State != outbound.StateClosed {
+			degraded = true
+		}
+	}
+
 	allOK := dbOK
 	status := http.StatusOK
 	if !allOK {
@@ -49,12 +61,13 @@ func (h *HealthCtrl) Health(c echo.Context) error {
 	}
 
 	resp := map[string]any{
-		"status":     map[string]any{"ok": allOK},
+		"status":     map[string]any{"ok": allOK, "degraded": degraded},
 		"uptime_sec": int(time.Since(appStart).Seconds()),
 		"checks": map[string]any{
 			"database": sub{OK: dbOK, Err: dbErr},
 		},
-		"time": time.Now().Format(time.RFC3339),
+		"outbound": breakers,
+		"time":     time.Now().Format(time.RFC3339),
 	}
 
 	return c.JSON(status, resp)
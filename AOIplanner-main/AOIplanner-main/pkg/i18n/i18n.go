@@ -0,0 +1,145 @@
+// Package i18n holds the Thai and English message catalogue for text the
+// server writes itself (rule-generated tasks, fallbacks, feed labels) and
+// carries the requester's locale through contexts.
+//
+// Messages have a key and named {placeholders}. A parameter whose value
+// starts with "@" names another message, rendered in the same locale, so a
+// stored task can mention e.g. a problem label and still be re-rendered in
+// either language.
+package i18n
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Supported locales. Default is used when nothing else is known and is the
+// language task text is stored in.
+const (
+	TH      = "th"
+	EN      = "en"
+	Default = TH
+)
+
+var supported = []string{TH, EN}
+
+// Supported lists the locales in catalogue order.
+func Supported() []string { return append([]string(nil), supported...) }
+
+// Normalize maps a language tag ("en-US", "TH") to a supported locale, or ""
+// if it is not one.
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, l := range supported {
+		if tag == l {
+			return l
+		}
+	}
+	return ""
+}
+
+// FromAcceptLanguage picks the supported locale the header ranks highest, or
+// "" when it names none ("*" does not count).
+func FromAcceptLanguage(h string) string {
+	type cand struct {
+		loc string
+		q   float64
+		pos int
+	}
+	var cs []cand
+	for i, part := range strings.Split(h, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		loc := Normalize(tag)
+		if loc == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > 0 {
+			cs = append(cs, cand{loc, q, i})
+		}
+	}
+	if len(cs) == 0 {
+		return ""
+	}
+	sort.SliceStable(cs, func(i, j int) bool { return cs[i].q > cs[j].q })
+	return cs[0].loc
+}
+
+type ctxKey struct{}
+
+// WithLocale returns ctx carrying loc.
+func WithLocale(ctx context.Context, loc string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, loc)
+}
+
+// FromContext returns the locale in ctx, or Default.
+func FromContext(ctx context.Context) string {
+	if l, ok := ctx.Value(ctxKey{}).(string); ok && l != "" {
+		return l
+	}
+	return Default
+}
+
+var (
+	mu      sync.RWMutex
+	catalog = map[string]map[string]string{}
+)
+
+func init() {
+	for k, v := range messages {
+		catalog[k] = v
+	}
+}
+
+// Register adds (or replaces) a message; packages with their own bilingual
+// data, like the problem catalogue, register it at init.
+func Register(key string, byLocale map[string]string) {
+	mu.Lock()
+	defer mu.Unlock()
+	catalog[key] = byLocale
+}
+
+// T renders the message key in loc, falling back to the default locale and
+// then to the key itself.
+func T(loc, key string, params map[string]string) string {
+	mu.RLock()
+	m, ok := catalog[key]
+	mu.RUnlock()
+	if !ok {
+		return key
+	}
+	s, ok := m[loc]
+	if !ok {
+		s = m[Default]
+	}
+	if len(params) == 0 || !strings.Contains(s, "{") {
+		return s
+	}
+	kv := make([]string, 0, 2*len(params))
+	for k, v := range params {
+		if ref, ok := strings.CutPrefix(v, "@"); ok && Has(ref) {
+			v = T(loc, ref, nil)
+		}
+		kv = append(kv, "{"+k+"}", v)
+	}
+	return strings.NewReplacer(kv...).Replace(s)
+}
+
+// Has reports whether key is in the catalogue.
+func Has(key string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := catalog[key]
+	return ok
+}
@@ -0,0 +1,58 @@
+package i18n
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFromAcceptLanguage(t *testing.T) {
+	for _, tc := range []struct{ header, want string }{
+		{"", ""},
+		{"en", EN},
+		{"en-US,en;q=0.9", EN},
+		{"TH-th", TH},
+		{"fr-FR, en;q=0.8, th;q=0.9", TH},
+		{"en;q=0.5, th;q=0.5", EN}, // ties keep header order
+		{"th;q=0, en;q=0.1", EN},   // q=0 means "not this one"
+		{"th;q=0", ""},
+		{"*", ""},
+		{"fr, de;q=0.9", ""},
+		{"en;q=abc", EN}, // a malformed weight counts as 1
+	} {
+		if got := FromAcceptLanguage(tc.header); got != tc.want {
+			t.Errorf("FromAcceptLanguage(%q) = %q, want %q", tc.header, got, tc.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	Register("test.greet", map[string]string{TH: "สวัสดี {name}", EN: "Hello {name}"})
+	Register("test.thai_only", map[string]string{TH: "ไทย"})
+	Register("test.crop", map[string]string{TH: "อ้อย", EN: "sugarcane"})
+
+	for _, tc := range []struct {
+		loc, key string
+		params   map[string]string
+		want     string
+	}{
+		{EN, "test.greet", map[string]string{"name": "Som"}, "Hello Som"},
+		{TH, "test.greet", map[string]string{"name": "Som"}, "สวัสดี Som"},
+		{EN, "test.thai_only", nil, "ไทย"}, // falls back to the default locale
+		{EN, "test.missing", nil, "test.missing"},
+		{EN, "test.greet", map[string]string{"name": "@test.crop"}, "Hello sugarcane"}, // a reference is rendered in the same locale
+		{EN, "test.greet", map[string]string{"name": "@nobody"}, "Hello @nobody"},
+	} {
+		if got := T(tc.loc, tc.key, tc.params); got != tc.want {
+			t.Errorf("T(%s, %s) = %q, want %q", tc.loc, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestContextLocale(t *testing.T) {
+	if got := FromContext(context.Background()); got != Default {
+		t.Errorf("no locale: %q, want %q", got, Default)
+	}
+	if got := FromContext(WithLocale(context.Background(), EN)); got != EN {
+		t.Errorf("got %q, want en", got)
+	}
+}
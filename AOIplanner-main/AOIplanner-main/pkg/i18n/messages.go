@@ -0,0 +1,92 @@
+package i18n
+
+// messages is the built-in catalogue. Task messages come in pairs,
+// "<key>.title" and "<key>.notes"; keys are stored with tasks, so rename
+// them only together with a data migration.
+var messages = map[string]map[string]string{
+	// language names, as written in the (Thai) prompts
+	"language.th": {TH: "ภาษาไทย", EN: "Thai"},
+	"language.en": {TH: "ภาษาอังกฤษ", EN: "English"},
+
+	// verbatim text from the LLM or the user
+	Verbatim + ".title": {TH: "{title}", EN: "{title}"},
+	Verbatim + ".notes": {TH: "{notes}", EN: "{notes}"},
+
+	// daily rules (climate.ExpandDaily)
+	"task.observe.title":   {TH: "วัดความสูงและความชื้น", EN: "Measure cane height and soil moisture"},
+	"task.observe.notes":   {TH: "บันทึกค่าให้ระบบปรับแผน", EN: "Record the readings so the plan can adjust"},
+	"task.irrigate.title":  {TH: "รดน้ำตามรอบ", EN: "Scheduled irrigation"},
+	"task.irrigate.notes":  {TH: "{mm} mm ต่อ {days} วัน", EN: "{mm} mm per {days} days"},
+	"task.fertilize.title": {TH: "ใส่ปุ๋ย 15-15-15", EN: "Apply 15-15-15 fertilizer"},
+	"task.fertilize.notes": {TH: "ตัวอย่าง: ปรับในภายหลังตามงบประมาณ", EN: "Example rate: adjust later to your budget"},
+
+	// seasonal scouting added to replans
+	"task.scout_season.title":   {TH: "สำรวจโรคตามฤดูกาล", EN: "Seasonal disease scouting"},
+	"task.scout_season.notes":   {TH: "ดูใบจุดวงแหวน/เน่าแดงช่วงชื้น", EN: "Look for ring spot / red rot in wet spells"},
+	"task.scout_problems.title": {TH: "สำรวจโรคตามฤดูกาล", EN: "Seasonal disease scouting"},
+	"task.scout_problems.notes": {TH: "ดูใบขาว/กอตะไคร้/แส้ดำ/ใบจุดวงแหวนตามฤดูกาล", EN: "Check for white leaf, grassy shoot, smut and ring spot"},
+	"task.scout_risks.title":    {TH: "สำรวจโรคตามฤดูกาล", EN: "Seasonal disease scouting"},
+	"task.scout_risks.notes":    {TH: "ตรวจอาการเสี่ยงในช่วงนี้", EN: "Check for the symptoms likely at this time"},
+
+	// default actions of the problem catalogue
+	"action.scout_disease.title":       {TH: "สำรวจอาการโรคอ้อย", EN: "Scout for cane diseases"},
+	"action.scout_disease.notes":       {TH: "สุ่มตรวจ 5 จุด/แปลง พร้อมภาพประกอบ", EN: "Sample 5 spots per field, with photos"},
+	"action.prepare_drainage.title":    {TH: "เตรียมระบายน้ำ/ขุดร่อง", EN: "Prepare drainage / dig furrows"},
+	"action.prepare_drainage.notes":    {TH: "กันน้ำขังเกิน 48 ชม.", EN: "Keep water from standing over 48 h"},
+	"action.extra_irrigation.title":    {TH: "เพิ่มน้ำชดเชยความชื้น", EN: "Extra irrigation to restore moisture"},
+	"action.extra_irrigation.notes":    {TH: "ตามศักยภาพปั๊ม", EN: "As far as the pump allows"},
+	"action.drain_field.title":         {TH: "ระบายน้ำออกจากแปลง", EN: "Drain water from the field"},
+	"action.drain_field.notes":         {TH: "งดให้น้ำจนดินหมาด", EN: "Hold irrigation until the soil is just moist"},
+	"action.scout_root_rot.title":      {TH: "สำรวจรากเน่าหลังน้ำลด", EN: "Check for root rot after the water recedes"},
+	"action.scout_root_rot.notes":      {TH: "ถอนตรวจราก 5 กอ/แปลง", EN: "Pull and check the roots of 5 stools per field"},
+	"action.rogue_white_leaf.title":    {TH: "ขุดกออ้อยที่เป็นโรคใบขาวออกและทำลาย", EN: "Dig out and destroy stools with white leaf"},
+	"action.rogue_white_leaf.notes":    {TH: "ลดแหล่งเชื้อในแปลง", EN: "Removes the source of infection"},
+	"action.remove_smut.title":         {TH: "ตัดแส้ดำใส่ถุงแล้วนำไปทำลาย", EN: "Bag and destroy the smut whips"},
+	"action.remove_smut.notes":         {TH: "ทำก่อนแส้แตกสปอร์", EN: "Before the whips release spores"},
+	"action.scout_borer.title":         {TH: "สำรวจยอดเหี่ยวจากหนอนกอ", EN: "Check for dead hearts from borers"},
+	"action.scout_borer.notes":         {TH: "นับกอที่ยอดแห้ง 5 จุด/แปลง", EN: "Count stools with dry tops at 5 spots per field"},
+	"action.release_parasitoids.title": {TH: "พิจารณาปล่อยแตนเบียนไข่ไตรโคแกรมมา", EN: "Consider releasing Trichogramma egg parasitoids"},
+	"action.release_parasitoids.notes": {TH: "", EN: ""},
+	"action.scout_grub.title":          {TH: "ขุดสำรวจหนอนด้วงในกออ้อย", EN: "Dig stools to check for beetle grubs"},
+	"action.scout_grub.notes":          {TH: "ตรวจโคนกอที่แห้งตาย", EN: "Check the base of dead stools"},
+	"action.nitrogen_topup.title":      {TH: "ใส่ปุ๋ยไนโตรเจนเสริม (46-0-0)", EN: "Nitrogen top-up (46-0-0)"},
+	"action.nitrogen_topup.notes":      {TH: "ใส่เมื่อดินมีความชื้น", EN: "Apply when the soil is moist"},
+	"action.weed_rows.title":           {TH: "กำจัดวัชพืชระหว่างแถว", EN: "Weed between the rows"},
+	"action.weed_rows.notes":           {TH: "ก่อนอ้อยปิดทรงพุ่ม", EN: "Before the canopy closes"},
+	"diagnosis.confirm.title":          {TH: "ตรวจยืนยัน{problem}ในแปลง", EN: "Confirm {problem} in the field"},
+	"diagnosis.confirm.notes":          {TH: "จากภาพถ่ายที่บันทึกไว้", EN: "From the recorded photo"},
+
+	// notes the planner adds when placing tasks (see AddNote)
+	"note.fert_window_passed": {TH: "เลยช่วงใส่ปุ๋ยของฤดูนี้แล้ว", EN: "This season's fertilizer window has passed"},
+	"note.stage_demand":       {TH: "{mm} mm ตามความต้องการน้ำของระยะ", EN: "{mm} mm from the stage's water demand"},
+	"note.mm_area":            {TH: "{mm} mm × {rai} ไร่", EN: "{mm} mm × {rai} rai"},
+	"note.per_rai":            {TH: "{rate} {unit}/ไร่ × {rai} ไร่", EN: "{rate} {unit}/rai × {rai} rai"},
+	"note.diagnosis":          {TH: "วินิจฉัยจากภาพ #{diagnosis}: {problem} {confidence}%", EN: "photo diagnosis #{diagnosis}: {problem} {confidence}%"},
+
+	// photo diagnosis
+	"diagnosis.healthy":     {TH: "ปกติ", EN: "Healthy"},
+	"diagnosis.unknown":     {TH: "ไม่สามารถระบุได้", EN: "Could not be identified"},
+	"diagnosis.not_checked": {TH: "ยังไม่ได้วิเคราะห์ภาพ", EN: "The photo has not been analysed"},
+	"diagnosis.from_note":   {TH: "ยังไม่ได้วิเคราะห์ภาพ: บันทึกระบุว่า{problem}", EN: "The photo has not been analysed; the note mentions {problem}"},
+
+	// plan summary
+	"summary.offline": {TH: "สรุปแผนเบื้องต้น: ดำเนินการตามปฏิทินงานที่ระบบจัดไว้", EN: "Plan summary: follow the task calendar the system has set up"},
+
+	// LLM context packing: a monthly row of summarised tasks
+	"pack.times": {TH: "{n} ครั้ง", EN: "{n} times"},
+
+	// field chat
+	"chat.unavailable": {TH: "ขออภัย ขณะนี้ผู้ช่วยไม่สามารถตอบได้ กรุณาลองใหม่อีกครั้ง", EN: "Sorry, the assistant cannot answer right now. Please try again."},
+	"chat.sources":     {TH: "เอกสารที่เกี่ยวข้อง:", EN: "Related documents:"},
+	"chat.doc":         {TH: "เอกสาร #{id}", EN: "Document #{id}"},
+	"chat.mock":        {TH: "คำตอบเบื้องต้น (mock): {question}", EN: "Preliminary answer (mock): {question}"},
+
+	// calendar feeds
+	"cal.name":          {TH: "ตารางงานไร่อ้อย", EN: "Sugarcane field tasks"},
+	"cal.field":         {TH: "แปลง #{id}", EN: "Field #{id}"},
+	"cal.field_variety": {TH: "แปลง #{id} {variety}", EN: "Field #{id} {variety}"},
+	"cal.type":          {TH: "ประเภท: {type}", EN: "Type: {type}"},
+	"cal.status":        {TH: "สถานะ: {status}", EN: "Status: {status}"},
+	"cal.qty":           {TH: "ปริมาณ: {qty} {unit}", EN: "Amount: {qty} {unit}"},
+	"cal.notes":         {TH: "หมายเหตุ: {notes}", EN: "Notes: {notes}"},
+}
@@ -0,0 +1,95 @@
+package i18n
+
+import (
+	"strconv"
+	"strings"
+
+	"aoi/entities"
+	"aoi/pkg/plan/types"
+)
+
+// Verbatim is the key of tasks whose text came from outside the catalogue
+// (the LLM, the user): the title and notes params are shown as they are, and
+// notes the planner adds (see AddNote) are still rendered per locale.
+const Verbatim = "verbatim"
+
+// notePrefix names the params holding extra note keys: note1, note2, ...
+const notePrefix = "note"
+
+// Task renders the task message key ("<key>.title", "<key>.notes") in loc,
+// with its extra notes appended in order, joined by " · ".
+func Task(loc, key string, params map[string]string) (title, notes string) {
+	title = T(loc, key+".title", params)
+	parts := []string{T(loc, key+".notes", params)}
+	for i := 1; ; i++ {
+		k, ok := params[notePrefix+strconv.Itoa(i)]
+		if !ok {
+			break
+		}
+		parts = append(parts, T(loc, k, params))
+	}
+	var keep []string
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			keep = append(keep, p)
+		}
+	}
+	return title, strings.Join(keep, " · ")
+}
+
+// Op returns a rule-generated op for the task message key, with its text
+// rendered in the default locale (the language tasks are stored in).
+func Op(typ, key string, params map[string]string) types.PlanOp {
+	title, notes := Task(Default, key, params)
+	return types.PlanOp{Type: typ, Title: title, Notes: notes, Key: key, Params: params}
+}
+
+// VerbatimParams are the params of a Verbatim task.
+func VerbatimParams(title, notes string) map[string]string {
+	return map[string]string{"title": title, "notes": notes}
+}
+
+// AddNote appends the note message key, with its own params, to a task's
+// params and returns them (params may be nil).
+func AddNote(params map[string]string, key string, extra map[string]string) map[string]string {
+	out := make(map[string]string, len(params)+len(extra)+1)
+	for k, v := range params {
+		out[k] = v
+	}
+	for k, v := range extra {
+		out[k] = v
+	}
+	n := 1
+	for {
+		if _, ok := out[notePrefix+strconv.Itoa(n)]; !ok {
+			break
+		}
+		n++
+	}
+	out[notePrefix+strconv.Itoa(n)] = key
+	return out
+}
+
+// LocalizeTask re-renders a task's title and notes in loc. Tasks without a
+// known message key keep their stored text.
+func LocalizeTask(t *entities.ScheduleTask, loc string) {
+	if t.MsgKey == "" || !Has(t.MsgKey+".title") {
+		return
+	}
+	t.Title, t.Notes = Task(loc, t.MsgKey, t.MsgParams)
+}
+
+func LocalizeTasks(ts []entities.ScheduleTask, loc string) {
+	for i := range ts {
+		LocalizeTask(&ts[i], loc)
+	}
+}
+
+// LocalizeOps is LocalizeTask for plan ops.
+func LocalizeOps(ops []types.PlanOp, loc string) {
+	for i := range ops {
+		if ops[i].Key != "" && Has(ops[i].Key+".title") {
+			ops[i].Title, ops[i].Notes = Task(loc, ops[i].Key, ops[i].Params)
+		}
+	}
+}
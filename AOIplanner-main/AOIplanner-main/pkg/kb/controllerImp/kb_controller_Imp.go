@@ -2,6 +2,7 @@ package controllerImp
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -62,6 +63,7 @@ func (h *KBCtrl) IngestText(c echo.Context) error {
 
     // NOTE: UpsertDocument คืน 3 ค่า → รับให้ครบ หรือทิ้งด้วย "_"
     if doc, chunks, err := h.s.UpsertDocument( // <-- use h.s (interface), not h.svc
+    c.Request().Context(),
     strings.TrimSpace(req.Title),
     strings.TrimSpace(req.Tags),
     req.Text,
@@ -82,11 +84,12 @@ func (h *KBCtrl) IngestURL(c echo.Context) error {
 	host := strings.ToLower(u.Host)
 	if !h.allow[host] { return c.JSON(http.StatusForbidden, map[string]string{"error":"domain not allowed"}) }
 
-	txt, title, err := fetchMainText(body.URL, h.maxBytes)
+	ctx := c.Request().Context()
+	txt, title, err := fetchMainText(ctx, body.URL, h.maxBytes)
 	if err != nil { return c.JSON(http.StatusBadGateway, map[string]string{"error":err.Error()}) }
 	if body.Title != "" { title = body.Title }
 
-	doc, n, err := h.s.UpsertDocument(title, body.Tags, txt, body.URL)
+	doc, n, err := h.s.UpsertDocument(ctx, title, body.Tags, txt, body.URL)
 	if err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error":err.Error()}) }
 	return c.JSON(http.StatusCreated, map[string]any{"doc": doc, "chunks": n})
 }
@@ -95,7 +98,8 @@ func (h *KBCtrl) Search(c echo.Context) error {
     q := strings.TrimSpace(c.QueryParam("q"))
     if q == "" { return c.JSON(http.StatusBadRequest, map[string]string{"error":"q required"}) }
 
-    chunks, err := h.s.Search(q, 6)
+    ctx := c.Request().Context()
+    chunks, err := h.s.Search(ctx, q, 6)
     if err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()}) }
 
     // collect doc IDs
@@ -107,7 +111,7 @@ func (h *KBCtrl) Search(c echo.Context) error {
             ids = append(ids, ch.DocID)
         }
     }
-    meta, _ := h.s.DocsMeta(ids) // ignore error for now
+    meta, _ := h.s.DocsMeta(ctx, ids) // ignore error for now
 
     // shape response: include doc title + url for each chunk
     type outChunk struct {
@@ -133,9 +137,14 @@ func (h *KBCtrl) Search(c echo.Context) error {
 }
 
 // --- helpers ---
-func fetchMainText(u string, maxBytes int) (string, string, error) {
-	client := &http.Client{ Timeout: 20 * time.Second }
-	resp, err := client.Get(u); if err != nil { return "", "", err }
+// fetchTimeout bounds a page fetch on top of the request context.
+const fetchTimeout = 20 * time.Second
+
+func fetchMainText(ctx context.Context, u string, maxBytes int) (string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil); if err != nil { return "", "", err }
+	resp, err := http.DefaultClient.Do(req); if err != nil { return "", "", err }
 	defer resp.Body.Close()
 	if resp.ContentLength > 0 && resp.ContentLength > int64(maxBytes) { return "", "", fmt.Errorf("page too large") }
 	limited := io.LimitedReader{R: resp.Body, N: int64(maxBytes)}
@@ -2,29 +2,46 @@ package embedder
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
-	"net/http"
+	"errors"
+	"fmt"
 	"strings"
 	"time"
+
+	"aoi/pkg/outbound"
 )
 
-type Client struct{ endpoint, key, model string }
+// defaultTimeout bounds an embedding call when ctx has no deadline.
+const defaultTimeout = 20 * time.Second
+
+type Client struct{ endpoint, key, model string; httpc *outbound.Client }
 
-func New(endpoint, key, model string) *Client { return &Client{endpoint, key, model} }
+// errNoEndpoint: EMB_ENDPOINT is unset. No outbound client is created then,
+// so /health does not list a breaker for an embedder that is never called.
+var errNoEndpoint = errors.New("embedder: no endpoint configured")
+
+func New(endpoint, key, model string) *Client {
+	c := &Client{endpoint: endpoint, key: key, model: model}
+	if endpoint != "" { c.httpc = outbound.New("embedder") }
+	return c
+}
 
-func (c *Client) Embed(texts []string) ([][]float32, error) {
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if c.httpc == nil { return nil, errNoEndpoint }
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultTimeout)
+		defer cancel()
+	}
 	body := map[string]any{"model": c.model, "input": texts}
-	b, _ := json.Marshal(body)
-	req, _ := http.NewRequest("POST", strings.TrimRight(c.endpoint, "/")+"/v1/embeddings", bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+c.key)
-	req.Header.Set("Content-Type", "application/json")
-	httpc := &http.Client{Timeout: 20 * time.Second}
-	resp, err := httpc.Do(req)
+	resp, err := c.httpc.PostJSON(ctx, strings.TrimRight(c.endpoint, "/")+"/v1/embeddings", map[string]string{"Authorization": "Bearer " + c.key}, body)
 	if err != nil { return nil, err }
 	defer resp.Body.Close()
 	var out struct{ Data []struct{ Embedding []float32 `json:"embedding"` } `json:"data"` }
 	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil { return nil, err }
+	if len(out.Data) != len(texts) { return nil, fmt.Errorf("embedder: %d embeddings for %d texts", len(out.Data), len(texts)) }
 	res := make([][]float32, len(out.Data))
 	for i := range out.Data { res[i] = out.Data[i].Embedding }
 	return res, nil
@@ -1,8 +1,13 @@
 package repository
 
-import "aoi/entities"
+import (
+	"context"
+
+	"aoi/entities"
+)
 
 type KBRepository interface {
+	WithContext(ctx context.Context) KBRepository
 	CreateDoc(*entities.KBDocument) error
 	BulkInsertChunks([]entities.KBChunk) error
 	ListDocs() ([]entities.KBDocument, error)
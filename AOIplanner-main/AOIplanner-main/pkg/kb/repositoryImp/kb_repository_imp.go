@@ -1,6 +1,8 @@
 package repositoryImp
 
 import (
+	"context"
+
 	"aoi/entities"
 	"aoi/pkg/kb/repository"
 	"gorm.io/gorm"
@@ -9,6 +11,9 @@ import (
 type repo struct{ db *gorm.DB }
 func New(db *gorm.DB) repository.KBRepository { return &repo{db} }
 
+// WithContext returns a copy whose queries are bound to ctx.
+func (r *repo) WithContext(ctx context.Context) repository.KBRepository { return &repo{r.db.WithContext(ctx)} }
+
 func (r *repo) CreateDoc(d *entities.KBDocument) error          { return r.db.Create(d).Error }
 func (r *repo) BulkInsertChunks(cs []entities.KBChunk) error     { return r.db.Create(&cs).Error }
 func (r *repo) ListDocs() ([]entities.KBDocument, error)         { var ds []entities.KBDocument; return ds, r.db.Order("doc_id DESC").Find(&ds).Error }
@@ -1,9 +1,13 @@
 package service
 
-import "aoi/entities"
+import (
+	"context"
+
+	"aoi/entities"
+)
 
 type KBService interface {
-	UpsertDocument(title, tags, text, sourceURL string) (*entities.KBDocument, int, error)
-	Search(query string, k int) ([]entities.KBChunk, error)
-	DocsMeta(ids []uint) (map[uint]entities.KBDocument, error)
+	UpsertDocument(ctx context.Context, title, tags, text, sourceURL string) (*entities.KBDocument, int, error)
+	Search(ctx context.Context, query string, k int) ([]entities.KBChunk, error)
+	DocsMeta(ctx context.Context, ids []uint) (map[uint]entities.KBDocument, error)
 }
@@ -1,6 +1,7 @@
 package serviceImp
 
 import (
+	"context"
 	"math"
 	"sort"
 	"strings"
@@ -28,9 +29,10 @@ func chunkText(text string, maxRunes int) []string {
 	return parts
 }
 
-func (s *Svc) UpsertDocument(title, tags, text, sourceURL string) (*entities.KBDocument, int, error) {
+func (s *Svc) UpsertDocument(ctx context.Context, title, tags, text, sourceURL string) (*entities.KBDocument, int, error) {
+    r := s.r.WithContext(ctx)
     d := &entities.KBDocument{Title: title, Tags: tags, SourceURL: sourceURL}
-    if err := s.r.CreateDoc(d); err != nil { return nil, 0, err }
+    if err := r.CreateDoc(d); err != nil { return nil, 0, err }
 
     chs := chunkText(text, 1000)
     if len(chs) == 0 { return d, 0, nil }
@@ -38,8 +40,9 @@ func (s *Svc) UpsertDocument(title, tags, text, sourceURL string) (*entities.KBD
     var embs [][]float32
     var err error
     if s.emb != nil {
-        embs, err = s.emb.Embed(chs)
+        embs, err = s.emb.Embed(ctx, chs)
         if err != nil {
+            if ctx.Err() != nil { return nil, 0, ctx.Err() }
             // degrade gracefully: keep chunks with empty embeddings
             embs = nil
         }
@@ -59,7 +62,7 @@ func (s *Svc) UpsertDocument(title, tags, text, sourceURL string) (*entities.KBD
         }
     }
 
-    if err := s.r.BulkInsertChunks(rows); err != nil { return nil, 0, err }
+    if err := r.BulkInsertChunks(rows); err != nil { return nil, 0, err }
     return d, len(rows), nil
 }
 
@@ -72,7 +75,7 @@ func cosine(a, b []float32) float64 {
 	return dot / (math.Sqrt(na) * math.Sqrt(nb))
 }
 
-func (s *Svc) Search(query string, k int) ([]entities.KBChunk, error) {
+func (s *Svc) Search(ctx context.Context, query string, k int) ([]entities.KBChunk, error) {
 	q := strings.TrimSpace(query)
 	if q == "" || k <= 0 {
 		return nil, nil
@@ -81,13 +84,16 @@ func (s *Svc) Search(query string, k int) ([]entities.KBChunk, error) {
 	// 1) Try to embed the query (safe if emb is nil or embedding fails)
 	var qvec []float32
 	if s.emb != nil {
-		if vec, err := s.emb.Embed([]string{q}); err == nil && len(vec) > 0 { // ← use your embedder's actual method name
+		if vec, err := s.emb.Embed(ctx, []string{q}); err == nil && len(vec) > 0 { // ← use your embedder's actual method name
 			qvec = vec[0]
 		}
 	}
 
 	// 2) Fetch candidate chunks from repo
-	chunks, err := s.r.AllChunks()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	chunks, err := s.r.WithContext(ctx).AllChunks()
 	if err != nil {
 		return nil, err
 	}
@@ -145,12 +151,14 @@ func (s *Svc) Search(query string, k int) ([]entities.KBChunk, error) {
 	}
 	out := make([]entities.KBChunk, 0, k)
 	for i := 0; i < k; i++ {
-		out = append(out, scoredList[i].ch)
+		ch := scoredList[i].ch
+		ch.Score = scoredList[i].sc
+		out = append(out, ch)
 	}
 	return out, nil
 }
 
 
-func (s *Svc) DocsMeta(ids []uint) (map[uint]entities.KBDocument, error) {
-	return s.r.DocsByIDs(ids)
+func (s *Svc) DocsMeta(ctx context.Context, ids []uint) (map[uint]entities.KBDocument, error) {
+	return s.r.WithContext(ctx).DocsByIDs(ids)
 }
\ No newline at end of file
@@ -1,40 +1,109 @@
 package controllerImp
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 	"github.com/labstack/echo/v4"
 	"aoi/entities"
+	diagSvcImp "aoi/pkg/diagnosis/serviceImp"
 	repo "aoi/pkg/measure/repository"
 )
 
-type MeasureCtrl struct{ repo repo.MeasureRepository }
+// diagnoser reads measurement photos (see pkg/diagnosis).
+type diagnoser interface {
+	Diagnose(ctx context.Context, m *entities.Measurement, uid string) (*entities.PhotoDiagnosis, error)
+}
+
+type MeasureCtrl struct{
+	repo repo.MeasureRepository
+	diag diagnoser // nil: photos are stored but not diagnosed
+	uploads string // directory for uploaded photos
+}
 
-func New(repo repo.MeasureRepository) *MeasureCtrl { return &MeasureCtrl{repo} }
+func New(repo repo.MeasureRepository, diag diagnoser, uploads string) *MeasureCtrl { return &MeasureCtrl{repo, diag, uploads} }
 
 type measReq struct {
-	Date string `json:"date"`
-	CaneHeightCM *float64 `json:"cane_height_cm"`
-	SoilMoistPct *float64 `json:"soil_moist_pct"`
-	MoistState string `json:"moist_state"`
-	RainfallMM *float64 `json:"rainfall_mm"`
-	PestScale *int `json:"pest_scale"`
-	Note string `json:"note"`
-	PhotoURL string `json:"photo_url"`
+	Date string `json:"date" form:"date"`
+	CaneHeightCM *float64 `json:"cane_height_cm" form:"cane_height_cm"`
+	SoilMoistPct *float64 `json:"soil_moist_pct" form:"soil_moist_pct"`
+	MoistState string `json:"moist_state" form:"moist_state"`
+	RainfallMM *float64 `json:"rainfall_mm" form:"rainfall_mm"`
+	PestScale *int `json:"pest_scale" form:"pest_scale"`
+	Note string `json:"note" form:"note"`
+	PhotoURL string `json:"photo_url" form:"photo_url"`
 }
 
+// Create stores a measurement, sent as JSON or as a multipart form with the
+// leaf/stalk photo in "photo". A photo is diagnosed right away; the
+// measurement is kept even if the diagnosis fails.
 func (h *MeasureCtrl) Create(c echo.Context) error {
+	uid, _ := c.Get("uid").(string)
 	fid, _ := strconv.Atoi(c.Param("id"))
 	var req measReq
 	if err := c.Bind(&req); err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"bad json"}) }
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		if fh, err := c.FormFile("photo"); err == nil {
+			url, err := h.savePhoto(fid, fh)
+			if err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()}) }
+			req.PhotoURL = url
+		}
+	}
 	d := time.Now()
 	if req.Date != "" { dd, err := time.Parse("2006-01-02", req.Date); if err==nil { d = dd } }
 	m := &entities.Measurement{ FieldID: uint(fid), Date: d, CaneHeightCM: req.CaneHeightCM, SoilMoistPct: req.SoilMoistPct, MoistState: req.MoistState, RainfallMM: req.RainfallMM, PestScale: req.PestScale, Note: req.Note, PhotoURL: req.PhotoURL }
 	if err := h.repo.Create(m); err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()}) }
+	if m.PhotoURL != "" && h.diag != nil {
+		d, err := h.diag.Diagnose(c.Request().Context(), m, uid)
+		if err != nil {
+			log.Printf("[measure] photo of measurement #%d not diagnosed: %v", m.MeasureID, err)
+		}
+		m.Diagnosis = d
+	}
 	return c.JSON(http.StatusCreated, m)
 }
 
+// photoExt is the file extension per accepted photo type. Uploads are served
+// as static files, so the extension comes from the sniffed content, never
+// from the client's file name.
+var photoExt = map[string]string{"image/jpeg": ".jpg", "image/png": ".png", "image/webp": ".webp"}
+
+// savePhoto copies an uploaded photo into the upload directory and returns
+// the URL it is served at.
+func (h *MeasureCtrl) savePhoto(fieldID int, fh *multipart.FileHeader) (string, error) {
+	if fh.Size > diagSvcImp.MaxPhotoBytes {
+		return "", fmt.Errorf("photo is larger than %d MB", diagSvcImp.MaxPhotoBytes>>20)
+	}
+	src, err := fh.Open()
+	if err != nil { return "", err }
+	defer src.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(src, head)
+	ext, ok := photoExt[http.DetectContentType(head[:n])]
+	if !ok { return "", fmt.Errorf("photo must be a JPEG, PNG or WebP image") }
+	if _, err := src.Seek(0, io.SeekStart); err != nil { return "", err }
+
+	if err := os.MkdirAll(h.uploads, 0o755); err != nil { return "", err }
+	rnd := make([]byte, 8)
+	_, _ = rand.Read(rnd)
+	name := fmt.Sprintf("f%d-%s%s", fieldID, hex.EncodeToString(rnd), ext)
+	dst, err := os.Create(filepath.Join(h.uploads, name))
+	if err != nil { return "", err }
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil { return "", err }
+	return diagSvcImp.UploadPrefix + name, nil
+}
+
 func (h *MeasureCtrl) List(c echo.Context) error {
 	fid, _ := strconv.Atoi(c.Param("id"))
 	out, err := h.repo.Recent(uint(fid), 60)
@@ -1,8 +1,15 @@
 package repository
 
-import "aoi/entities"
+import (
+	"context"
+
+	"aoi/entities"
+)
 
 type MeasureRepository interface {
+	WithContext(ctx context.Context) MeasureRepository // same repository, queries bound to ctx
 	Create(m *entities.Measurement) error
+	FindByID(measureID uint) (*entities.Measurement, error)
 	Recent(fieldID uint, days int) ([]entities.Measurement, error)
+	ListByField(fieldID uint) ([]entities.Measurement, error)
 }
\ No newline at end of file
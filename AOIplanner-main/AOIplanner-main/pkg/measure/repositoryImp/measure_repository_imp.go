@@ -1,6 +1,7 @@
 package repositoryImp
 
 import (
+	"context"
 	"time"
 	"aoi/entities"
 	"aoi/pkg/measure/repository"
@@ -11,11 +12,25 @@ type measureRepo struct{ db *gorm.DB }
 
 func New(db *gorm.DB) repository.MeasureRepository { return &measureRepo{db} }
 
+func (r *measureRepo) WithContext(ctx context.Context) repository.MeasureRepository { return &measureRepo{r.db.WithContext(ctx)} }
+
 func (r *measureRepo) Create(m *entities.Measurement) error { return r.db.Create(m).Error }
 
+func (r *measureRepo) FindByID(measureID uint) (*entities.Measurement, error) {
+	var m entities.Measurement
+	if err := r.db.First(&m, measureID).Error; err != nil { return nil, err }
+	return &m, nil
+}
+
 func (r *measureRepo) Recent(fieldID uint, days int) ([]entities.Measurement, error) {
 	var out []entities.Measurement
 	cut := time.Now().AddDate(0,0,-days)
 	if err := r.db.Where("field_id = ? AND date >= ?", fieldID, cut).Order("date ASC").Find(&out).Error; err != nil { return nil, err }
 	return out, nil
-}
\ No newline at end of file
+}
+
+func (r *measureRepo) ListByField(fieldID uint) ([]entities.Measurement, error) {
+	var out []entities.Measurement
+	if err := r.db.Where("field_id = ?", fieldID).Order("date ASC").Find(&out).Error; err != nil { return nil, err }
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"aoi/entities"
+)
+
+// claimLease is how long a claimed key may go without a response before it
+// is taken for abandoned (the server died mid-request) and can be claimed again.
+const claimLease = 5 * time.Minute
+
+// Idempotency makes a POST safe to retry: when a user repeats an
+// Idempotency-Key header, the first response is replayed instead of running
+// the handler again. Keys expire after ttl. Requests without the header pass
+// through unchanged.
+func Idempotency(db *gorm.DB, ttl time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key := strings.TrimSpace(c.Request().Header.Get("Idempotency-Key"))
+			if key == "" || db == nil {
+				return next(c)
+			}
+			uid, _ := c.Get("uid").(string)
+			rec := entities.IdempotencyKey{UserID: uid, Key: key, Method: c.Request().Method, Path: c.Request().URL.Path}
+
+			// claim the key; a duplicate means we have seen it before
+			if err := db.Create(&rec).Error; err != nil {
+				if !errors.Is(err, gorm.ErrDuplicatedKey) {
+					return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				}
+				var prev entities.IdempotencyKey
+				if err := db.Where("user_id = ? AND idem_key = ?", uid, key).First(&prev).Error; err != nil {
+					return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				}
+				switch {
+				case time.Since(prev.CreatedAt) > ttl, prev.StatusCode == 0 && time.Since(prev.CreatedAt) > claimLease:
+					// expired or abandoned: forget it and claim again
+					db.Delete(&prev)
+					if err := db.Create(&rec).Error; err != nil {
+						return c.JSON(http.StatusConflict, map[string]string{"error": "request with this Idempotency-Key is in progress"})
+					}
+				case prev.Method != rec.Method || prev.Path != rec.Path:
+					return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "Idempotency-Key was used for a different request"})
+				case prev.StatusCode == 0:
+					return c.JSON(http.StatusConflict, map[string]string{"error": "request with this Idempotency-Key is in progress"})
+				default:
+					c.Response().Header().Set("Idempotent-Replayed", "true")
+					return c.Blob(prev.StatusCode, prev.ContentType, prev.Body)
+				}
+			}
+
+			// a panicking handler gave no answer either: release the key
+			defer func() {
+				if r := recover(); r != nil {
+					db.Delete(&rec)
+					panic(r)
+				}
+			}()
+
+			// run the handler and keep a copy of what it writes
+			w := c.Response().Writer
+			buf := &bytes.Buffer{}
+			c.Response().Writer = &teeWriter{ResponseWriter: w, buf: buf}
+			err := next(c)
+			c.Response().Writer = w
+
+			status := c.Response().Status
+			if err != nil || !c.Response().Committed || status >= http.StatusInternalServerError {
+				// not a final answer: release the key so the client can retry
+				db.Delete(&rec)
+				return err
+			}
+			db.Model(&rec).Updates(map[string]any{
+				"status_code":  status,
+				"content_type": c.Response().Header().Get(echo.HeaderContentType),
+				"body":         buf.Bytes(),
+			})
+			return nil
+		}
+	}
+}
+
+type teeWriter struct {
+	http.ResponseWriter
+	buf *bytes.Buffer
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	return w.ResponseWriter.Write(b)
+}
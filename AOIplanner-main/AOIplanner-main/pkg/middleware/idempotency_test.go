@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+
+	"aoi/database"
+	"aoi/entities"
+)
+
+// idemServer runs handler behind Idempotency for user u1 and counts its runs.
+func idemServer(t *testing.T, ttl time.Duration, handler echo.HandlerFunc) (*echo.Echo, *gorm.DB, *int) {
+	t.Helper()
+	db := database.OpenSQLite(filepath.Join(t.TempDir(), "aoi.db"))
+	runs := 0
+	e := echo.New()
+	setUID := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error { c.Set("uid", "u1"); return next(c) }
+	}
+	h := func(c echo.Context) error { runs++; return handler(c) }
+	e.POST("/fields/:id/plan", h, setUID, Idempotency(db, ttl))
+	e.POST("/fields/:id/replan", h, setUID, Idempotency(db, ttl))
+	return e, db, &runs
+}
+
+func send(e *echo.Echo, path, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, nil)
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	e, _, runs := idemServer(t, time.Hour, func(c echo.Context) error {
+		return c.JSON(http.StatusCreated, map[string]string{"run": "first"})
+	})
+
+	first := send(e, "/fields/1/plan", "k1")
+	again := send(e, "/fields/1/plan", "k1")
+	if *runs != 1 {
+		t.Fatalf("handler ran %d times, want 1", *runs)
+	}
+	if again.Code != http.StatusCreated || again.Body.String() != first.Body.String() || again.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay: %d %q %v", again.Code, again.Body.String(), again.Header())
+	}
+
+	send(e, "/fields/1/plan", "")
+	send(e, "/fields/1/plan", "k2")
+	if *runs != 3 {
+		t.Errorf("requests without the key or with a new one must run: %d runs", *runs)
+	}
+}
+
+func TestIdempotencyConflicts(t *testing.T) {
+	e, db, runs := idemServer(t, time.Hour, func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+
+	send(e, "/fields/1/plan", "k1")
+	if rec := send(e, "/fields/1/replan", "k1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused for another request: %d, want 422", rec.Code)
+	}
+
+	// a claim whose first request has not answered yet
+	db.Create(&entities.IdempotencyKey{UserID: "u1", Key: "busy", Method: http.MethodPost, Path: "/fields/1/plan"})
+	if rec := send(e, "/fields/1/plan", "busy"); rec.Code != http.StatusConflict {
+		t.Errorf("in progress: %d, want 409", rec.Code)
+	}
+	if *runs != 1 {
+		t.Errorf("handler ran %d times, want 1", *runs)
+	}
+}
+
+func TestIdempotencyReleasesFailures(t *testing.T) {
+	fail := true
+	e, _, runs := idemServer(t, time.Hour, func(c echo.Context) error {
+		if fail {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "boom"})
+		}
+		return c.NoContent(http.StatusCreated)
+	})
+
+	if rec := send(e, "/fields/1/plan", "k1"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("first: %d", rec.Code)
+	}
+	fail = false
+	if rec := send(e, "/fields/1/plan", "k1"); rec.Code != http.StatusCreated || *runs != 2 {
+		t.Errorf("a 5xx must not be replayed: %d after %d runs", rec.Code, *runs)
+	}
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+	n := 0
+	e, db, runs := idemServer(t, time.Minute, func(c echo.Context) error {
+		n++
+		return c.String(http.StatusOK, strconv.Itoa(n))
+	})
+
+	send(e, "/fields/1/plan", "k1")
+	db.Model(&entities.IdempotencyKey{}).Where("idem_key = ?", "k1").Update("created_at", time.Now().Add(-2*time.Minute))
+	if rec := send(e, "/fields/1/plan", "k1"); rec.Body.String() != "2" || *runs != 2 {
+		t.Errorf("expired key: got %q after %d runs, want a fresh run", rec.Body.String(), *runs)
+	}
+}
+
+func TestIdempotencyReclaimsAbandonedClaims(t *testing.T) {
+	e, db, runs := idemServer(t, time.Hour, func(c echo.Context) error { return c.NoContent(http.StatusCreated) })
+
+	// a claim whose request died long ago without answering
+	db.Create(&entities.IdempotencyKey{UserID: "u1", Key: "stale", Method: http.MethodPost, Path: "/fields/1/plan", CreatedAt: time.Now().Add(-claimLease - time.Minute)})
+	if rec := send(e, "/fields/1/plan", "stale"); rec.Code != http.StatusCreated || *runs != 1 {
+		t.Errorf("abandoned claim: %d after %d runs, want a fresh run", rec.Code, *runs)
+	}
+}
+
+func TestIdempotencyReleasesPanics(t *testing.T) {
+	panicking := true
+	e, _, runs := idemServer(t, time.Hour, func(c echo.Context) error {
+		if panicking {
+			panic("boom")
+		}
+		return c.NoContent(http.StatusCreated)
+	})
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic must reach the outer recover")
+			}
+		}()
+		send(e, "/fields/1/plan", "k1")
+	}()
+	panicking = false
+	if rec := send(e, "/fields/1/plan", "k1"); rec.Code != http.StatusCreated || *runs != 2 {
+		t.Errorf("retry after a panic: %d after %d runs", rec.Code, *runs)
+	}
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"log"
+
+	"github.com/labstack/echo/v4"
+
+	"aoi/pkg/i18n"
+)
+
+// localePrefs looks up a user's saved locale ("" if none).
+type localePrefs interface {
+	Locale(uid string) (string, error)
+}
+
+// Locale picks the language of the response: the user's saved preference,
+// else a supported language in Accept-Language, else the default (Thai). The
+// locale is stored as "locale" and in the request context, where services and
+// LLM prompts pick it up. Runs after DevLogin.
+func Locale(prefs localePrefs) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var loc string
+			if uid, _ := c.Get("uid").(string); uid != "" && prefs != nil {
+				saved, err := prefs.Locale(uid)
+				if err != nil {
+					log.Printf("[locale] %s: %v", uid, err)
+				}
+				loc = i18n.Normalize(saved)
+			}
+			if loc == "" {
+				loc = i18n.FromAcceptLanguage(c.Request().Header.Get("Accept-Language"))
+			}
+			if loc == "" {
+				loc = i18n.Default
+			}
+			c.Set("locale", loc)
+			c.SetRequest(c.Request().WithContext(i18n.WithLocale(c.Request().Context(), loc)))
+			c.Response().Header().Set("Content-Language", loc)
+			c.Response().Header().Add("Vary", "Accept-Language")
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+
+	"aoi/pkg/i18n"
+)
+
+type savedLocales map[string]string
+
+func (s savedLocales) Locale(uid string) (string, error) { return s[uid], nil }
+
+func TestLocalePrecedence(t *testing.T) {
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, i18n.FromContext(c.Request().Context()))
+	}, func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error { c.Set("uid", c.QueryParam("uid")); return next(c) }
+	}, Locale(savedLocales{"saved-en": "en", "saved-th": "th"}))
+
+	for _, tc := range []struct{ uid, header, want string }{
+		{"saved-en", "th-TH,th;q=0.9", i18n.EN}, // the saved preference wins
+		{"saved-th", "en-US", i18n.TH},
+		{"nothing-saved", "en-US", i18n.EN},
+		{"nothing-saved", "", i18n.Default},
+		{"", "fr", i18n.Default},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/?uid="+tc.uid, nil)
+		req.Header.Set("Accept-Language", tc.header)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		if rec.Body.String() != tc.want || rec.Header().Get("Content-Language") != tc.want {
+			t.Errorf("uid %q, Accept-Language %q: %q, want %q", tc.uid, tc.header, rec.Body.String(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package outbound
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Breaker states, as reported in State.
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+type outcome int
+
+const (
+	outcomeOK   outcome = iota // the target answered
+	outcomeFail                // the target failed or did not answer
+	outcomeNone                // the caller gave up; no verdict
+)
+
+// breaker opens after threshold consecutive failed requests and rejects
+// requests for the cooldown. After that one probe request is let through:
+// success closes the breaker, failure opens it again.
+type breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	open      bool
+	openUntil time.Time
+	probing   bool
+	fails     int
+	opened    int
+	lastErr   string
+}
+
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return fmt.Errorf("%w (retry in %s)", ErrOpen, wait.Round(time.Second))
+	}
+	if b.probing {
+		return fmt.Errorf("%w (probe in flight)", ErrOpen)
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *breaker) done(o outcome, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch o {
+	case outcomeOK:
+		if b.open {
+			log.Printf("[outbound] %s: circuit closed", b.name)
+		}
+		b.open, b.probing, b.fails = false, false, 0
+	case outcomeFail:
+		b.fails++
+		b.lastErr = err.Error()
+		if b.probing || !b.open && b.fails >= b.threshold {
+			if !b.open {
+				b.opened++
+			}
+			log.Printf("[outbound] %s: circuit open for %s after %d failures: %v", b.name, b.cooldown, b.fails, err)
+			b.open, b.probing = true, false
+			b.openUntil = time.Now().Add(b.cooldown)
+		}
+	case outcomeNone:
+		b.probing = false
+	}
+}
+
+func (b *breaker) state() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := State{Name: b.name, State: StateClosed, ConsecutiveFailures: b.fails, LastError: b.lastErr, Opened: b.opened}
+	if b.open {
+		s.State = StateOpen
+		if !time.Now().Before(b.openUntil) {
+			s.State = StateHalfOpen
+		}
+		t := b.openUntil
+		s.OpenUntil = &t
+	}
+	return s
+}
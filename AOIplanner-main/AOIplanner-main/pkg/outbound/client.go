@@ -0,0 +1,365 @@
+// Package outbound is the shared HTTP layer for calls to external services
+// (LLM providers, the embedding endpoint). Non-2xx replies become errors,
+// transient failures are retried with backoff, and every target has its own
+// circuit breaker and concurrency limit, so an outage fails fast to the
+// callers' fallbacks instead of stalling each request until its deadline.
+package outbound
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policy controls retries, breaking and concurrency for one target.
+type Policy struct {
+	Attempts      int           // tries per request, including the first
+	BaseDelay     time.Duration // first backoff, doubled per retry, with jitter
+	MaxDelay      time.Duration // longest wait between tries; a longer Retry-After is not waited for
+	Concurrency   int           // requests in flight at once (0 = unlimited)
+	FailThreshold int           // consecutive failed requests that open the breaker
+	Cooldown      time.Duration // how long an open breaker rejects requests
+}
+
+var (
+	defaultsMu sync.RWMutex
+	defaults   = Policy{
+		Attempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second,
+		Concurrency: 4, FailThreshold: 5, Cooldown: 30 * time.Second,
+	}
+)
+
+// SetDefaults changes the policy of targets created afterwards; zero fields
+// keep the current value.
+func SetDefaults(p Policy) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	if p.Attempts > 0 {
+		defaults.Attempts = p.Attempts
+	}
+	if p.BaseDelay > 0 {
+		defaults.BaseDelay = p.BaseDelay
+	}
+	if p.MaxDelay > 0 {
+		defaults.MaxDelay = p.MaxDelay
+	}
+	if p.Concurrency > 0 {
+		defaults.Concurrency = p.Concurrency
+	}
+	if p.FailThreshold > 0 {
+		defaults.FailThreshold = p.FailThreshold
+	}
+	if p.Cooldown > 0 {
+		defaults.Cooldown = p.Cooldown
+	}
+}
+
+// ErrOpen is returned, wrapped with the target name, while a breaker is open.
+var ErrOpen = errors.New("circuit open")
+
+// StatusError is a non-2xx reply.
+type StatusError struct {
+	Target     string
+	Status     int
+	Body       string
+	RetryAfter time.Duration // from the Retry-After header, 0 if absent
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: HTTP %d: %s", e.Target, e.Status, e.Body)
+}
+
+// Temporary reports whether the same request may succeed later.
+func (e *StatusError) Temporary() bool {
+	switch e.Status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Client sends requests to one target. Clients are shared by name, so every
+// caller of a target goes through the same breaker and limit.
+type Client struct {
+	name     string
+	httpc    *http.Client // no client timeout: deadlines come from the request context
+	pol      Policy
+	sem      chan struct{}
+	br       breaker
+	inFlight atomic.Int32
+}
+
+var (
+	regMu    sync.Mutex
+	registry = map[string]*Client{}
+)
+
+// New returns the client for the named target, creating it with the default
+// policy on first use.
+func New(name string) *Client {
+	regMu.Lock()
+	defer regMu.Unlock()
+	if c, ok := registry[name]; ok {
+		return c
+	}
+	defaultsMu.RLock()
+	pol := defaults
+	defaultsMu.RUnlock()
+	c := newClient(name, pol)
+	registry[name] = c
+	return c
+}
+
+func newClient(name string, pol Policy) *Client {
+	c := &Client{name: name, httpc: &http.Client{}, pol: pol}
+	if pol.Concurrency > 0 {
+		c.sem = make(chan struct{}, pol.Concurrency)
+	}
+	c.br = breaker{name: name, threshold: pol.FailThreshold, cooldown: pol.Cooldown}
+	return c
+}
+
+// PostJSON posts body as JSON with the extra headers.
+func (c *Client) PostJSON(ctx context.Context, url string, header map[string]string, body any) (*http.Response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
+
+// Do sends the request built by newReq, which is called once per attempt so
+// the body can be replayed. Only a 2xx response is returned; closing its body
+// frees the concurrency slot.
+func (c *Client) Do(ctx context.Context, newReq func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	if err := c.br.allow(); err != nil {
+		c.release()
+		return nil, fmt.Errorf("%s: %w", c.name, err)
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		var resp *http.Response
+		resp, err = c.send(ctx, newReq)
+		if err == nil {
+			c.br.done(outcomeOK, nil)
+			resp.Body = &releaseBody{ReadCloser: resp.Body, release: c.release}
+			return resp, nil
+		}
+		wait, ok := c.retryAfter(ctx, attempt, err)
+		if !ok {
+			break
+		}
+		log.Printf("[outbound] %s: attempt %d failed, retrying in %s: %v", c.name, attempt, wait.Round(time.Millisecond), err)
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+		case <-t.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	c.release()
+	c.br.done(classify(ctx, err), err)
+	return nil, err
+}
+
+func (c *Client) send(ctx context.Context, newReq func(context.Context) (*http.Request, error)) (*http.Response, error) {
+	req, err := newReq(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return nil, &StatusError{
+			Target: c.name, Status: resp.StatusCode, Body: strings.TrimSpace(string(body)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return resp, nil
+}
+
+// retryAfter decides whether a failed attempt is worth repeating and how long
+// to wait first. It gives up when the wait would outlast the context.
+func (c *Client) retryAfter(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	if attempt >= c.pol.Attempts || ctx.Err() != nil || !retryable(err) {
+		return 0, false
+	}
+	d := c.pol.BaseDelay << (attempt - 1)
+	if d <= 0 || d > c.pol.MaxDelay {
+		d = c.pol.MaxDelay
+	}
+	d = d/2 + rand.N(d/2+1)
+	var se *StatusError
+	if errors.As(err, &se) && se.RetryAfter > 0 {
+		if se.RetryAfter > c.pol.MaxDelay {
+			return 0, false
+		}
+		d = se.RetryAfter
+	}
+	if dl, ok := ctx.Deadline(); ok && time.Until(dl) < d {
+		return 0, false
+	}
+	return d, true
+}
+
+// retryable: temporary HTTP statuses and network failures. Malformed requests
+// and other local errors would fail the same way again.
+func retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// classify decides what a finished request says about the target's health.
+// A definite refusal (4xx) still shows the target is up; a caller giving up
+// says nothing either way.
+func classify(ctx context.Context, err error) outcome {
+	var se *StatusError
+	switch {
+	case errors.As(err, &se):
+		if se.Temporary() {
+			return outcomeFail
+		}
+		return outcomeOK
+	case errors.Is(ctx.Err(), context.Canceled):
+		return outcomeNone
+	}
+	return outcomeFail
+}
+
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (c *Client) acquire(ctx context.Context) error {
+	if c.sem == nil {
+		c.inFlight.Add(1)
+		return nil
+	}
+	select {
+	case c.sem <- struct{}{}:
+		c.inFlight.Add(1)
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: waiting for a free slot: %w", c.name, ctx.Err())
+	}
+}
+
+func (c *Client) release() {
+	c.inFlight.Add(-1)
+	if c.sem != nil {
+		<-c.sem
+	}
+}
+
+// releaseBody frees the concurrency slot once, when the body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// State is one target's breaker and load, for /health.
+type State struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"` // closed | open | half_open
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	Opened              int        `json:"opened"` // times the breaker has opened since start
+	InFlight            int        `json:"in_flight"`
+	Limit               int        `json:"limit,omitempty"`
+}
+
+// StateOf reports the named target, or false if nothing has used it yet.
+func StateOf(name string) (State, bool) {
+	regMu.Lock()
+	c, ok := registry[name]
+	regMu.Unlock()
+	if !ok {
+		return State{}, false
+	}
+	return c.state(), true
+}
+
+func (c *Client) state() State {
+	s := c.br.state()
+	s.InFlight, s.Limit = int(c.inFlight.Load()), c.pol.Concurrency
+	return s
+}
+
+// States reports every target created so far, by name.
+func States() []State {
+	regMu.Lock()
+	cs := make([]*Client, 0, len(registry))
+	for _, c := range registry {
+		cs = append(cs, c)
+	}
+	regMu.Unlock()
+	sort.Slice(cs, func(i, j int) bool { return cs[i].name < cs[j].name })
+
+	out := make([]State, 0, len(cs))
+	for _, c := range cs {
+		out = append(out, c.state())
+	}
+	return out
+}
@@ -0,0 +1,184 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testPolicy retries quickly and never opens the breaker unless a test asks.
+var testPolicy = Policy{
+	Attempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second,
+	Concurrency: 2, FailThreshold: 100, Cooldown: time.Minute,
+}
+
+// server answers with the given statuses in turn (the last one repeats) and
+// counts the requests.
+func server(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var n atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		i := int(n.Add(1)) - 1
+		if i >= len(statuses) {
+			i = len(statuses) - 1
+		}
+		for k, v := range header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(statuses[i])
+		io.WriteString(w, http.StatusText(statuses[i]))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &n
+}
+
+func post(c *Client, ctx context.Context, url string) error {
+	resp, err := c.PostJSON(ctx, url, nil, map[string]string{"q": "x"})
+	if err == nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+func TestRetryTemporaryStatus(t *testing.T) {
+	srv, n := server(t, nil, 503, 502, 200)
+	c := newClient("t", testPolicy)
+	if err := post(c, context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if n.Load() != 3 {
+		t.Errorf("want 3 attempts, got %d", n.Load())
+	}
+	if st := c.state(); st.State != StateClosed || st.ConsecutiveFailures != 0 || st.InFlight != 0 {
+		t.Errorf("state after success: %+v", st)
+	}
+}
+
+func TestGiveUpAfterAttempts(t *testing.T) {
+	srv, n := server(t, nil, 500)
+	c := newClient("t", testPolicy)
+	err := post(c, context.Background(), srv.URL)
+	var se *StatusError
+	if !errors.As(err, &se) || se.Status != 500 || se.Body != "Internal Server Error" {
+		t.Fatalf("want the last StatusError, got %v", err)
+	}
+	if n.Load() != 3 {
+		t.Errorf("want 3 attempts, got %d", n.Load())
+	}
+	if st := c.state(); st.ConsecutiveFailures != 1 {
+		t.Errorf("one failed request, got %+v", st)
+	}
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	srv, n := server(t, nil, 400)
+	c := newClient("t", testPolicy)
+	if err := post(c, context.Background(), srv.URL); err == nil {
+		t.Fatal("want an error")
+	}
+	if n.Load() != 1 {
+		t.Errorf("want 1 attempt, got %d", n.Load())
+	}
+	if st := c.state(); st.ConsecutiveFailures != 0 {
+		t.Errorf("a 4xx shows the target is up: %+v", st)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	srv, n := server(t, http.Header{"Retry-After": {"1"}}, 429, 200)
+	c := newClient("t", testPolicy)
+	start := time.Now()
+	if err := post(c, context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	if el := time.Since(start); el < time.Second {
+		t.Errorf("retried after %s, want the 1s Retry-After", el)
+	}
+	if n.Load() != 2 {
+		t.Errorf("want 2 attempts, got %d", n.Load())
+	}
+
+	// a Retry-After beyond MaxDelay is not waited for
+	srv, n = server(t, http.Header{"Retry-After": {"60"}}, 429, 200)
+	if err := post(c, context.Background(), srv.URL); err == nil || n.Load() != 1 {
+		t.Errorf("want one attempt and an error, got %d, %v", n.Load(), err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := newClient("t", Policy{Attempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second})
+	tmp := &StatusError{Status: 503}
+	for attempt, full := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		full *= time.Millisecond
+		if full > time.Second {
+			full = time.Second
+		}
+		for i := 0; i < 20; i++ {
+			d, ok := c.retryAfter(context.Background(), attempt+1, tmp)
+			if !ok || d < full/2 || d > full {
+				t.Fatalf("attempt %d: wait %s (ok %v), want %s to %s", attempt+1, d, ok, full/2, full)
+			}
+		}
+	}
+
+	if _, ok := c.retryAfter(context.Background(), 10, tmp); ok {
+		t.Error("retried past Attempts")
+	}
+	if _, ok := c.retryAfter(context.Background(), 1, errors.New("bad request body")); ok {
+		t.Error("retried a local error")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, ok := c.retryAfter(ctx, 3, tmp); ok {
+		t.Error("waits past the context deadline")
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	srv, n := server(t, nil, 503, 503, 200)
+	pol := testPolicy
+	pol.Attempts, pol.FailThreshold, pol.Cooldown = 1, 2, 50*time.Millisecond
+	c := newClient("t", pol)
+
+	for i := 0; i < 2; i++ {
+		if err := post(c, context.Background(), srv.URL); err == nil {
+			t.Fatal("want an error")
+		}
+	}
+	st := c.state()
+	if st.State != StateOpen || st.Opened != 1 || st.OpenUntil == nil {
+		t.Fatalf("after %d failures: %+v", pol.FailThreshold, st)
+	}
+	if err := post(c, context.Background(), srv.URL); !errors.Is(err, ErrOpen) {
+		t.Errorf("open breaker: want ErrOpen, got %v", err)
+	}
+	if n.Load() != 2 {
+		t.Errorf("open breaker let a request through: %d", n.Load())
+	}
+
+	time.Sleep(pol.Cooldown)
+	if st := c.state(); st.State != StateHalfOpen {
+		t.Errorf("after the cooldown: %+v", st)
+	}
+	if err := post(c, context.Background(), srv.URL); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if st := c.state(); st.State != StateClosed || st.ConsecutiveFailures != 0 {
+		t.Errorf("after a good probe: %+v", st)
+	}
+}
+
+func TestStateOf(t *testing.T) {
+	if _, ok := StateOf("test:unused"); ok {
+		t.Error("StateOf created a target")
+	}
+	New("test:used")
+	if st, ok := StateOf("test:used"); !ok || st.Name != "test:used" || st.State != StateClosed {
+		t.Errorf("StateOf = %+v, %v", st, ok)
+	}
+}
@@ -7,4 +7,11 @@ type PlanController interface {
 	Generate(c echo.Context) error
 	Replan(c echo.Context) error
 	List(c echo.Context) error
+	Replans(c echo.Context) error
+	Citations(c echo.Context) error
+	Scenarios(c echo.Context) error
+	Submit(c echo.Context) error
+	Review(c echo.Context) error
+	Reviews(c echo.Context) error
+	PendingReviews(c echo.Context) error
 }
\ No newline at end of file
@@ -1,31 +1,48 @@
 package controllerImp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 
+	"aoi/entities"
+	"aoi/pkg/i18n"
 	"aoi/pkg/plan/serviceImp"
+	"aoi/pkg/problem"
 	fieldrepo "aoi/pkg/field/repository"
 	fieldRepoImp "aoi/pkg/field/repositoryImp"
 	"gorm.io/gorm"
 )
 
 
-type PlanCtrl struct{ svc *serviceImp.PlanSvc; fields fieldrepo.FieldRepository }
+type PlanCtrl struct{ svc *serviceImp.PlanSvc; fields fieldrepo.FieldRepository; reviewers map[string]bool }
 
-func NewPlanCtrl(db *gorm.DB, svc *serviceImp.PlanSvc) *PlanCtrl { return &PlanCtrl{svc: svc, fields: fieldRepoImp.New(db)} }
+// NewPlanCtrl wires the plan handlers; reviewers are the user ids allowed to approve plans.
+func NewPlanCtrl(db *gorm.DB, svc *serviceImp.PlanSvc, reviewers []string) *PlanCtrl {
+	rv := map[string]bool{}
+	for _, uid := range reviewers { rv[uid] = true }
+	return &PlanCtrl{svc: svc, fields: fieldRepoImp.New(db), reviewers: rv}
+}
 
 func (h *PlanCtrl) Generate(c echo.Context) error {
 	uid := c.Get("uid").(string)
 	fid, _ := strconv.Atoi(c.Param("id"))
 	f, err := h.fields.FindByID(uint(fid), uid)
 	if err != nil { return c.JSON(http.StatusNotFound, map[string]string{"error":"field not found"}) }
-	p, tasks, err := h.svc.GenerateFirstPlan(f)
-	if err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()}) }
+	// ?summary=stream returns the plan without waiting for the LLM summary;
+	// the client then POSTs summary_stream to write it
+	deferSummary := c.QueryParam("summary") == "stream"
+	p, tasks, err := h.svc.GenerateFirstPlanWithOptions(c.Request().Context(), f, serviceImp.GenerateOptions{DeferSummary: deferSummary})
+	if err != nil { return planError(c, err) }
+	i18n.LocalizeTasks(tasks, i18n.FromContext(c.Request().Context()))
+	streamURL := ""
+	if deferSummary { streamURL = fmt.Sprintf("/plans/%d/summary/stream", p.PlanID) }
 	if c.QueryParam("format") == "calendar" {
 
 		kbdebug := c.QueryParam("kbdebug") == "1"
@@ -54,10 +71,16 @@ func (h *PlanCtrl) Generate(c echo.Context) error {
 			"calendar": cal,
 		}
 		if kbdebug {
-			resp["kb_refs"] = serviceImp.LastKBRefs()
+			resp["kb_refs"] = p.Citations
+		}
+		if streamURL != "" {
+			resp["summary_stream"] = streamURL
 		}
 		return c.JSON(http.StatusCreated, resp)
 	}
+	if streamURL != "" {
+		return c.JSON(http.StatusCreated, map[string]any{"plan": p, "tasks": tasks, "summary_stream": streamURL})
+	}
 	return c.JSON(http.StatusCreated, map[string]any{"plan": p, "tasks": tasks})
 }
 
@@ -72,19 +95,31 @@ func (h *PlanCtrl) Replan(c echo.Context) error {
     // Bind body FIRST
     var body struct {
         Reason   string   `json:"reason"`
-        Problems []string `json:"problems"`
+        Codes    []string `json:"problem_codes"` // from GET /problems
+        Problems []string `json:"problems"`      // free text (older clients)
     }
     if err := c.Bind(&body); err != nil {
         return c.JSON(http.StatusBadRequest, map[string]string{"error": "bad json"})
     }
+    for _, code := range body.Codes {
+        if _, ok := problem.Lookup(code); !ok {
+            return c.JSON(http.StatusBadRequest, map[string]string{"error": "unknown problem code: " + code})
+        }
+    }
 
     // Call the wrapper that applies problems -> KB -> LLM actions
-    p, tasks, rep, err := h.svc.ReplanWithOptions(f, serviceImp.ReplanOptions{
+    p, tasks, rep, err := h.svc.ReplanWithOptions(c.Request().Context(), f, serviceImp.ReplanOptions{
         Reason:   strings.TrimSpace(body.Reason),
+        Codes:    body.Codes,
         Problems: body.Problems,
     })
     if err != nil {
-        return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+        return planError(c, err)
+    }
+    loc := i18n.FromContext(c.Request().Context())
+    i18n.LocalizeTasks(tasks, loc)
+    if rep != nil {
+        i18n.LocalizeOps(rep.ProposedOps, loc)
     }
 
     if c.QueryParam("format") == "calendar" {
@@ -121,7 +156,7 @@ func (h *PlanCtrl) Replan(c echo.Context) error {
             "replan":   rep, // <- use rep
         }
         if kbdebug {
-            resp["kb_refs"] = serviceImp.LastKBRefs()
+            resp["kb_refs"] = p.Citations
         }
         return c.JSON(http.StatusOK, resp)
     }
@@ -134,8 +169,216 @@ func (h *PlanCtrl) Replan(c echo.Context) error {
     })
 }
 
+// Replans returns the replan timeline (newest first) for a field owned by the caller.
+func (h *PlanCtrl) Replans(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	if _, err := h.fields.FindByID(uint(fid), uid); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "field not found"})
+	}
+	logs, err := h.svc.ReplanHistory(uint(fid))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	loc := i18n.FromContext(c.Request().Context())
+	for i := range logs {
+		i18n.LocalizeOps(logs[i].ProposedOps, loc)
+	}
+	return c.JSON(http.StatusOK, logs)
+}
+
+// Citations returns the KB articles that shaped a plan and its replans.
+func (h *PlanCtrl) Citations(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	pid, _ := strconv.Atoi(c.Param("plan_id"))
+	p, err := h.svc.PlanByID(uint(pid))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "plan not found"})
+	}
+	if _, err := h.fields.FindByID(p.FieldID, uid); err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "plan not found"})
+	}
+	cs, err := h.svc.Citations(p.PlanID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, cs)
+}
+
+// Scenarios simulates what-if variants of a field (planting date, crop type,
+// soil, irrigation source, pump) side by side without saving anything.
+func (h *PlanCtrl) Scenarios(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	f, err := h.fields.FindByID(uint(fid), uid)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "field not found"})
+	}
+	var body struct {
+		Variants []serviceImp.Scenario `json:"variants"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "bad json"})
+	}
+	res, err := h.svc.SimulateScenarios(f, body.Variants)
+	if err != nil {
+		if errors.Is(err, serviceImp.ErrBadScenario) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]any{"field_id": f.FieldID, "scenarios": res})
+}
+
 func (h *PlanCtrl) List(c echo.Context) error {
 	// TODO: wire to service/repo (latest plan + tasks) when ready.
 	// For now, return an empty list to keep the contract intact.
 	return c.JSON(http.StatusOK, json.RawMessage(`[]`))
-}
\ No newline at end of file
+}
+// Submit sends a draft plan of the caller's field to the reviewers.
+func (h *PlanCtrl) Submit(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	p, err := h.planFor(c, uid)
+	if err != nil || p == nil { return err }
+	var body struct{ Comment string `json:"comment"` }
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "bad json"})
+	}
+	p, err = h.svc.SubmitPlan(c.Request().Context(), p.PlanID, uid, strings.TrimSpace(body.Comment))
+	if err != nil { return planError(c, err) }
+	return c.JSON(http.StatusOK, p)
+}
+
+// Review approves a plan under review or sends it back with comments (reviewers only).
+func (h *PlanCtrl) Review(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	if !h.reviewers[uid] {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "not a reviewer"})
+	}
+	pid, _ := strconv.Atoi(c.Param("plan_id"))
+	var body struct {
+		Decision string `json:"decision"` // approve|request_changes
+		Comment  string `json:"comment"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "bad json"})
+	}
+	comment := strings.TrimSpace(body.Comment)
+	switch body.Decision {
+	case "approve":
+	case "request_changes":
+		if comment == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "comment is required when requesting changes"})
+		}
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "decision must be approve or request_changes"})
+	}
+	p, err := h.svc.ReviewPlan(c.Request().Context(), uint(pid), uid, body.Decision == "approve", comment)
+	if err != nil { return planError(c, err) }
+	return c.JSON(http.StatusOK, p)
+}
+
+// Reviews returns a plan with its tasks and review history, for the field
+// owner or a reviewer.
+func (h *PlanCtrl) Reviews(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	p, err := h.planFor(c, uid)
+	if err != nil || p == nil { return err }
+	tasks, err := h.svc.PlanTasks(p.PlanID)
+	if err != nil { return planError(c, err) }
+	i18n.LocalizeTasks(tasks, i18n.FromContext(c.Request().Context()))
+	rs, err := h.svc.PlanReviews(p.PlanID)
+	if err != nil { return planError(c, err) }
+	return c.JSON(http.StatusOK, map[string]any{"plan": p, "tasks": tasks, "reviews": rs})
+}
+
+// PendingReviews is the reviewers' queue of plans under review.
+func (h *PlanCtrl) PendingReviews(c echo.Context) error {
+	if !h.reviewers[c.Get("uid").(string)] {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "not a reviewer"})
+	}
+	ps, err := h.svc.PendingReviews()
+	if err != nil { return planError(c, err) }
+	return c.JSON(http.StatusOK, ps)
+}
+
+// SummaryStream writes the plan summary as Server-Sent Events: "delta"
+// events with text as the model produces it, then one "done" event with the
+// final Markdown (the fallback summary when the model failed, which replaces
+// any text received so far). GET only previews a summary; POST also stores
+// it, which a draft or under-review plan (or one without a summary) allows.
+func (h *PlanCtrl) SummaryStream(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	p, err := h.planFor(c, uid)
+	if err != nil || p == nil {
+		return err
+	}
+	f, err := h.fields.FindByID(p.FieldID, uid) // owners only: this spends LLM calls on their field
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "plan not found"})
+	}
+	save := c.Request().Method == http.MethodPost
+	if save && !serviceImp.SummaryWritable(p) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "an approved plan's summary is not rewritten; replan to change it"})
+	}
+
+	w := c.Response()
+	w.Header().Set(echo.HeaderContentType, "text/event-stream")
+	w.Header().Set(echo.HeaderCacheControl, "no-cache")
+	w.Header().Set(echo.HeaderConnection, "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx: do not buffer the stream
+	w.WriteHeader(http.StatusOK)
+	send := func(event string, v any) {
+		b, _ := json.Marshal(v)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+		w.Flush()
+	}
+
+	text, fallback, err := h.svc.StreamSummary(c.Request().Context(), p, f, save, func(delta string) {
+		send("delta", map[string]string{"text": delta})
+	})
+	if errors.Is(err, context.Canceled) {
+		return nil // client went away
+	}
+	done := map[string]any{"plan_id": p.PlanID, "summary_md": text, "fallback": fallback}
+	if !fallback {
+		done["provider"], done["prompt"] = p.SummaryProvider, p.SummaryPrompt
+	}
+	if err != nil {
+		done["error"] = err.Error()
+	}
+	send("done", done)
+	return nil
+}
+
+// planFor loads :plan_id if uid owns its field or is a reviewer; otherwise it
+// writes a 404 and returns a nil plan.
+func (h *PlanCtrl) planFor(c echo.Context, uid string) (*entities.Plan, error) {
+	pid, _ := strconv.Atoi(c.Param("plan_id"))
+	p, err := h.svc.PlanByID(uint(pid))
+	if err == nil && !h.reviewers[uid] {
+		_, err = h.fields.FindByID(p.FieldID, uid)
+	}
+	if err != nil {
+		return nil, c.JSON(http.StatusNotFound, map[string]string{"error": "plan not found"})
+	}
+	return p, nil
+}
+
+// planError maps plan service errors to HTTP statuses.
+func planError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, serviceImp.ErrPlanState):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, serviceImp.ErrPlanExists), errors.Is(err, serviceImp.ErrPlanConflict):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "plan not found"})
+	case errors.Is(err, context.DeadlineExceeded):
+		return c.JSON(http.StatusGatewayTimeout, map[string]string{"error": "plan build ran out of time"})
+	case errors.Is(err, context.Canceled):
+		// client went away; 5xx so an Idempotency-Key is released for the retry
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "request cancelled"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
@@ -1,9 +1,29 @@
 package repository
 
-import "aoi/entities"
+import (
+	"context"
+
+	"aoi/entities"
+)
 
 type PlanRepository interface {
+	WithContext(ctx context.Context) PlanRepository // same repository, queries bound to ctx
 	Create(p *entities.Plan) error
+	FindByID(planID uint) (*entities.Plan, error)
 	LatestByField(fieldID uint) (*entities.Plan, error)
+	CurrentByField(fieldID uint) (*entities.Plan, error) // latest approved version
 	ListByField(fieldID uint) ([]entities.Plan, error)
-}
\ No newline at end of file
+	ListByStatus(status string) ([]entities.Plan, error)
+	UpdateStatus(p *entities.Plan, from string) (bool, error) // false if the plan was no longer in status from
+	UpdateSummary(p *entities.Plan) error // summary_md, summary_provider, summary_prompt
+	LinkLLMCalls(callIDs []uint, planID uint) error // sets llm_calls.plan_id
+
+	CreateReplanLog(l *entities.ReplanLog) error
+	ListReplanLogs(fieldID uint) ([]entities.ReplanLog, error)
+
+	CreateCitations(cs []entities.PlanCitation) error
+	CitationsByPlan(planID uint) ([]entities.PlanCitation, error)
+
+	CreateReview(r *entities.PlanReview) error
+	ListReviews(planID uint) ([]entities.PlanReview, error)
+}
@@ -1,6 +1,7 @@
 package repositoryImp
 
 import (
+	"context"
 	"aoi/entities"
 	"aoi/pkg/plan/repository"
 	"gorm.io/gorm"
@@ -10,16 +11,79 @@ type planRepo struct{ db *gorm.DB }
 
 func New(db *gorm.DB) repository.PlanRepository { return &planRepo{db} }
 
+func (r *planRepo) WithContext(ctx context.Context) repository.PlanRepository { return &planRepo{r.db.WithContext(ctx)} }
+
 func (r *planRepo) Create(p *entities.Plan) error { return r.db.Create(p).Error }
 
+func (r *planRepo) FindByID(planID uint) (*entities.Plan, error) {
+	var p entities.Plan
+	if err := r.db.First(&p, planID).Error; err != nil { return nil, err }
+	return &p, nil
+}
+
 func (r *planRepo) LatestByField(fieldID uint) (*entities.Plan, error) {
 	var p entities.Plan
 	if err := r.db.Where("field_id = ?", fieldID).Order("version DESC").First(&p).Error; err != nil { return nil, err }
 	return &p, nil
 }
 
+func (r *planRepo) CurrentByField(fieldID uint) (*entities.Plan, error) {
+	var p entities.Plan
+	if err := r.db.Where("field_id = ? AND status = ?", fieldID, entities.PlanStatusApproved).Order("version DESC").First(&p).Error; err != nil { return nil, err }
+	return &p, nil
+}
+
 func (r *planRepo) ListByField(fieldID uint) ([]entities.Plan, error) {
 	var ps []entities.Plan
 	if err := r.db.Where("field_id = ?", fieldID).Order("version ASC").Find(&ps).Error; err != nil { return nil, err }
 	return ps, nil
-}
\ No newline at end of file
+}
+
+func (r *planRepo) ListByStatus(status string) ([]entities.Plan, error) {
+	var ps []entities.Plan
+	if err := r.db.Where("status = ?", status).Order("created_at ASC, plan_id ASC").Find(&ps).Error; err != nil { return nil, err }
+	return ps, nil
+}
+
+// UpdateStatus writes the lifecycle columns (status, approved_by, approved_at)
+// only if the stored status is still from.
+func (r *planRepo) UpdateStatus(p *entities.Plan, from string) (bool, error) {
+	res := r.db.Model(p).Where("status = ?", from).Select("status", "approved_by", "approved_at").Updates(p)
+	return res.RowsAffected == 1, res.Error
+}
+
+func (r *planRepo) UpdateSummary(p *entities.Plan) error {
+	return r.db.Model(p).Select("summary_md", "summary_provider", "summary_prompt").Updates(p).Error
+}
+
+func (r *planRepo) LinkLLMCalls(callIDs []uint, planID uint) error {
+	if len(callIDs) == 0 { return nil }
+	return r.db.Model(&entities.LLMCall{}).Where("id IN ?", callIDs).Update("plan_id", planID).Error
+}
+
+func (r *planRepo) CreateReplanLog(l *entities.ReplanLog) error { return r.db.Create(l).Error }
+
+func (r *planRepo) ListReplanLogs(fieldID uint) ([]entities.ReplanLog, error) {
+	var ls []entities.ReplanLog
+	if err := r.db.Where("field_id = ?", fieldID).Order("created_at DESC, id DESC").Find(&ls).Error; err != nil { return nil, err }
+	return ls, nil
+}
+
+func (r *planRepo) CreateCitations(cs []entities.PlanCitation) error {
+	if len(cs) == 0 { return nil }
+	return r.db.Create(&cs).Error
+}
+
+func (r *planRepo) CitationsByPlan(planID uint) ([]entities.PlanCitation, error) {
+	var cs []entities.PlanCitation
+	if err := r.db.Where("plan_id = ?", planID).Order("id ASC").Find(&cs).Error; err != nil { return nil, err }
+	return cs, nil
+}
+
+func (r *planRepo) CreateReview(rv *entities.PlanReview) error { return r.db.Create(rv).Error }
+
+func (r *planRepo) ListReviews(planID uint) ([]entities.PlanReview, error) {
+	var rs []entities.PlanReview
+	if err := r.db.Where("plan_id = ?", planID).Order("created_at ASC, id ASC").Find(&rs).Error; err != nil { return nil, err }
+	return rs, nil
+}
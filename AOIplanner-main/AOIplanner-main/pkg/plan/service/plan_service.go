@@ -1,10 +1,20 @@
 package service
 
 import (
+	"context"
+
 	"aoi/entities"
 )
 
 type PlanService interface {
-	GenerateFirstPlan(field *entities.Field) (*entities.Plan, []entities.ScheduleTask, error)
-	Replan(field *entities.Field) (*entities.Plan, []entities.ScheduleTask, *entities.ReplanLog, error)
+	GenerateFirstPlan(ctx context.Context, field *entities.Field) (*entities.Plan, []entities.ScheduleTask, error)
+	Replan(ctx context.Context, field *entities.Field) (*entities.Plan, []entities.ScheduleTask, *entities.ReplanLog, error)
+	ReplanHistory(fieldID uint) ([]entities.ReplanLog, error)
+	PlanByID(planID uint) (*entities.Plan, error)
+	Citations(planID uint) ([]entities.PlanCitation, error)
+
+	SubmitPlan(ctx context.Context, planID uint, actor, comment string) (*entities.Plan, error)
+	ReviewPlan(ctx context.Context, planID uint, reviewer string, approve bool, comment string) (*entities.Plan, error)
+	PlanReviews(planID uint) ([]entities.PlanReview, error)
+	PendingReviews() ([]entities.Plan, error)
 }
\ No newline at end of file
@@ -0,0 +1,296 @@
+package serviceImp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/climate"
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+	schedSvcImp "aoi/pkg/schedule/serviceImp"
+)
+
+const (
+	m3PerMMRai     = 1.6 // 1 mm of water over 1 rai (1,600 m²)
+	fertWindowDays = 45  // fertilizer can still be applied this long after a fertilizer stage starts
+	placeHorizon   = 30  // days searched for a free slot
+)
+
+// placer dates proposed ops against the plan they join: its stages, the tasks
+// already on it and recent measurements. Placed tasks count as existing for
+// the ops that follow.
+type placer struct {
+	field  *entities.Field
+	today  time.Time
+	stages []types.StagePlan
+	tasks  []entities.ScheduleTask
+	recent []entities.Measurement
+}
+
+func newPlacer(f *entities.Field, stages []types.StagePlan, existing []entities.ScheduleTask, recent []entities.Measurement) *placer {
+	now := time.Now()
+	tasks := make([]entities.ScheduleTask, 0, len(existing))
+	for _, t := range existing {
+		if t.Status != entities.TaskStatusDeleted {
+			tasks = append(tasks, t)
+		}
+	}
+	return &placer{
+		field: f, stages: stages, tasks: tasks, recent: recent,
+		today: time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// place turns ops into tasks:
+//   - advisory: today
+//   - inspect / pesticide: the first free day from tomorrow (spraying also
+//     skips wet days and days with irrigation)
+//   - fertilizer: inside the current or next fertilizer stage window, keeping
+//     the minimum gap to other applications; with no window left, an advisory
+//     today without the amount
+//   - irrigation: once the water balance since the last irrigation has room
+//     for the amount, after the soil has drained
+//
+// Per-rai quantities are converted to per-field amounts (irrigation in m³).
+func (p *placer) place(ops []types.PlanOp) []entities.ScheduleTask {
+	out := make([]entities.ScheduleTask, 0, len(ops))
+	for _, op := range ops {
+		t := entities.ScheduleTask{
+			FieldID:   p.field.FieldID,
+			Title:     op.Title,
+			Notes:     op.Notes,
+			Status:    "todo",
+			MsgKey:    op.Key,
+			MsgParams: op.Params,
+		}
+		if t.MsgKey == "" {
+			t.MsgKey, t.MsgParams = i18n.Verbatim, i18n.VerbatimParams(op.Title, op.Notes)
+		}
+		switch strings.ToLower(op.Type) {
+		case "irrigation":
+			t.Type = "irrigation"
+			p.irrigationQty(&t, op)
+			t.Date = p.irrigationDay(&t)
+		case "fertilizer":
+			d, ok := p.fertilizerDay()
+			if !ok { // an advisory carries no amount to apply
+				t.Type, t.Qty, t.Unit, t.Date = "advisory", nil, "", p.today
+				addNote(&t, "note.fert_window_passed", nil)
+				break
+			}
+			t.Type, t.Date = "fertilizer", d
+			t.Qty, t.Unit = p.perField(op.Qty, op.Unit, &t)
+		case "pesticide":
+			t.Type = "pesticide"
+			t.Qty, t.Unit = p.perField(op.Qty, op.Unit, &t)
+			t.Date = p.firstFree(p.today.AddDate(0, 0, 1), func(d time.Time) bool {
+				return !p.has(d, "pesticide") && !p.has(d, "irrigation") && !p.wet(d)
+			})
+		case "inspect":
+			t.Type = "inspect"
+			t.Date = p.firstFree(p.today.AddDate(0, 0, 1), func(d time.Time) bool { return !p.has(d, "inspect") })
+		default:
+			t.Type = "advisory"
+			t.Date = p.today
+		}
+		p.tasks = append(p.tasks, t)
+		out = append(out, t)
+	}
+	return out
+}
+
+// fertilizerDay is the first day, from the day after tomorrow, inside a
+// fertilizer stage window that keeps the minimum gap to other applications.
+func (p *placer) fertilizerDay() (time.Time, bool) {
+	from := p.today.AddDate(0, 0, 2)
+	for _, st := range p.stages {
+		if !climate.FertilizerStage(st.Stage) {
+			continue
+		}
+		start, err1 := time.Parse("2006-01-02", st.StartDate)
+		end, err2 := time.Parse("2006-01-02", st.EndDate)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if wEnd := start.AddDate(0, 0, fertWindowDays); wEnd.Before(end) {
+			end = wEnd
+		}
+		for d := maxTime(start, from); d.Before(end); d = d.AddDate(0, 0, 1) {
+			if p.fertGapOK(d) {
+				return d, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func (p *placer) fertGapOK(d time.Time) bool {
+	for _, t := range p.tasks {
+		if t.Type == "fertilizer" && math.Abs(d.Sub(t.Date).Hours()/24) < schedSvcImp.MinFertilizerGapDays {
+			return false
+		}
+	}
+	return true
+}
+
+// irrigationDay walks forward from tomorrow (or after a wet spell) to the
+// first day without irrigation whose water deficit since the last irrigation
+// (stage demand minus measured rain) can take the task's amount.
+func (p *placer) irrigationDay(t *entities.ScheduleTask) time.Time {
+	start := p.today.AddDate(0, 0, 1)
+	for d := p.today.AddDate(0, 0, -1); !d.After(p.today); d = d.AddDate(0, 0, 1) {
+		if p.wet(d) {
+			start = d.AddDate(0, 0, 3) // let a waterlogged field drain
+		}
+	}
+	needMM := 0.0
+	if t.Qty != nil && p.field.AreaRai > 0 {
+		needMM = *t.Qty / (m3PerMMRai * p.field.AreaRai)
+	}
+	fallback := time.Time{}
+	for d := start; d.Before(start.AddDate(0, 0, placeHorizon)); d = d.AddDate(0, 0, 1) {
+		if p.has(d, "irrigation") || p.wet(d) {
+			continue
+		}
+		if fallback.IsZero() {
+			fallback = d
+		}
+		if p.deficitMM(d) >= needMM-1e-6 {
+			return d
+		}
+	}
+	if fallback.IsZero() {
+		return start
+	}
+	return fallback
+}
+
+// deficitMM is the stage water demand since the last irrigation before d,
+// less the rain measured in that time.
+func (p *placer) deficitMM(d time.Time) float64 {
+	last := time.Time{}
+	for _, t := range p.tasks {
+		if t.Type == "irrigation" && t.Date.Before(d) && t.Date.After(last) {
+			last = t.Date
+		}
+	}
+	if last.IsZero() || d.Sub(last).Hours()/24 > placeHorizon {
+		last = d.AddDate(0, 0, -placeHorizon)
+	}
+	deficit := 0.0
+	for x := last; x.Before(d); x = x.AddDate(0, 0, 1) {
+		deficit += p.stageWater(x)
+	}
+	for _, m := range p.recent {
+		if m.RainfallMM != nil && !m.Date.Before(last) && m.Date.Before(d) {
+			deficit -= *m.RainfallMM
+		}
+	}
+	return deficit
+}
+
+func (p *placer) stageWater(d time.Time) float64 {
+	ds := d.Format("2006-01-02")
+	for _, st := range p.stages {
+		if ds >= st.StartDate && ds < st.EndDate {
+			return st.WaterMMDay
+		}
+	}
+	return 0
+}
+
+// irrigationQty converts an irrigation amount to m³ for the whole field;
+// without an amount it uses the current stage's demand over 3 days.
+func (p *placer) irrigationQty(t *entities.ScheduleTask, op types.PlanOp) {
+	unit := strings.ToLower(strings.TrimSpace(op.Unit))
+	switch {
+	case op.Qty == nil:
+		mm := p.stageWater(p.today) * 3
+		if mm <= 0 {
+			t.Unit = "mm"
+			return
+		}
+		q := mm * m3PerMMRai * p.field.AreaRai
+		t.Qty, t.Unit = &q, "m3"
+		addNote(t, "note.stage_demand", map[string]string{"mm": fmt.Sprintf("%.1f", mm)})
+	case unit == "" || unit == "mm":
+		q := *op.Qty * m3PerMMRai * p.field.AreaRai
+		t.Qty, t.Unit = &q, "m3"
+		addNote(t, "note.mm_area", map[string]string{"mm": fmt.Sprintf("%.1f", *op.Qty), "rai": fmt.Sprintf("%.1f", p.field.AreaRai)})
+	default:
+		t.Qty, t.Unit = p.perField(op.Qty, op.Unit, t)
+	}
+}
+
+// perField turns "x/rai" amounts into totals for the field's area and notes
+// the per-rai rate.
+func (p *placer) perField(qty *float64, unit string, t *entities.ScheduleTask) (*float64, string) {
+	u := strings.TrimSpace(unit)
+	base, ok := "", false
+	for _, suf := range []string{"/rai", "/ไร่", " per rai", "ต่อไร่"} {
+		if strings.HasSuffix(strings.ToLower(u), suf) {
+			base, ok = strings.TrimSpace(u[:len(u)-len(suf)]), true
+			break
+		}
+	}
+	if !ok || qty == nil {
+		return qty, u
+	}
+	total := *qty * p.field.AreaRai
+	addNote(t, "note.per_rai", map[string]string{"rate": fmt.Sprintf("%.1f", *qty), "unit": base, "rai": fmt.Sprintf("%.1f", p.field.AreaRai)})
+	return &total, base
+}
+
+// firstFree returns the first day from start (within the horizon) accepted
+// by ok, or start.
+func (p *placer) firstFree(start time.Time, ok func(time.Time) bool) time.Time {
+	for d := start; d.Before(start.AddDate(0, 0, placeHorizon)); d = d.AddDate(0, 0, 1) {
+		if ok(d) {
+			return d
+		}
+	}
+	return start
+}
+
+func (p *placer) has(d time.Time, typ string) bool {
+	for _, t := range p.tasks {
+		if t.Type == typ && schedSvcImp.SameDay(t.Date, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// wet reports a measurement marking the field waterlogged on d.
+func (p *placer) wet(d time.Time) bool {
+	for _, m := range p.recent {
+		if schedSvcImp.SameDay(m.Date, d) && (m.MoistState == "wet" || (m.RainfallMM != nil && *m.RainfallMM >= schedSvcImp.HeavyRainMM)) {
+			return true
+		}
+	}
+	return false
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// addNote appends a planner note (an i18n message) to the task's notes and
+// to its message params, so the note is re-rendered with the task.
+func addNote(t *entities.ScheduleTask, key string, params map[string]string) {
+	t.Notes = joinNotes(t.Notes, i18n.T(i18n.Default, key, params))
+	t.MsgParams = i18n.AddNote(t.MsgParams, key, params)
+}
+
+func joinNotes(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + " · " + b
+}
@@ -0,0 +1,129 @@
+package serviceImp
+
+import (
+	"testing"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/plan/types"
+)
+
+var placeStages = []types.StagePlan{
+	{Stage: "Germination", StartDate: "2026-05-01", EndDate: "2026-06-01", WaterMMDay: 3},
+	{Stage: "Tillering", StartDate: "2026-06-01", EndDate: "2026-09-01", WaterMMDay: 5},  // fertilizer window to 07-16
+	{Stage: "Elongation", StartDate: "2026-09-01", EndDate: "2027-01-01", WaterMMDay: 6}, // fertilizer window to 10-16
+}
+
+func day(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func f64(v float64) *float64 { return &v }
+
+// testPlacer is a placer for a 5-rai field on the given day.
+func testPlacer(today string, existing []entities.ScheduleTask, recent []entities.Measurement) *placer {
+	p := newPlacer(&entities.Field{FieldID: 1, AreaRai: 5}, placeStages, existing, recent)
+	p.today = day(today)
+	return p
+}
+
+func placeOne(p *placer, op types.PlanOp) entities.ScheduleTask {
+	return p.place([]types.PlanOp{op})[0]
+}
+
+func TestPlaceByType(t *testing.T) {
+	existing := []entities.ScheduleTask{
+		{Type: "inspect", Date: day("2026-06-11")},
+		{Type: "inspect", Date: day("2026-06-12"), Status: entities.TaskStatusDeleted}, // tombstones do not block
+		{Type: "irrigation", Date: day("2026-06-13")},
+	}
+	recent := []entities.Measurement{{Date: day("2026-06-14"), MoistState: "wet"}}
+
+	for _, tc := range []struct {
+		name string
+		op   types.PlanOp
+		want string
+	}{
+		{"advisory today", types.PlanOp{Type: "advisory", Title: "a"}, "2026-06-10"},
+		{"unknown type is advisory", types.PlanOp{Type: "weeding", Title: "w"}, "2026-06-10"},
+		{"inspect on first free day", types.PlanOp{Type: "inspect", Title: "i"}, "2026-06-12"},
+		{"pesticide from tomorrow", types.PlanOp{Type: "pesticide", Title: "p"}, "2026-06-11"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := placeOne(testPlacer("2026-06-10", existing, recent), tc.op)
+			if got.Date.Format("2006-01-02") != tc.want {
+				t.Errorf("placed on %s, want %s", got.Date.Format("2006-01-02"), tc.want)
+			}
+		})
+	}
+
+	// 06-11 taken by a placed pesticide, 06-13 irrigation, 06-14 wet
+	p := testPlacer("2026-06-10", existing, recent)
+	ts := p.place([]types.PlanOp{{Type: "pesticide", Title: "p1"}, {Type: "pesticide", Title: "p2"}})
+	if got := ts[1].Date.Format("2006-01-02"); got != "2026-06-12" {
+		t.Errorf("second pesticide on %s, want 2026-06-12 (placed ops count as existing)", got)
+	}
+	ts = p.place([]types.PlanOp{{Type: "pesticide", Title: "p3"}})
+	if got := ts[0].Date.Format("2006-01-02"); got != "2026-06-15" {
+		t.Errorf("third pesticide on %s, want 2026-06-15", got)
+	}
+}
+
+func TestPlaceFertilizer(t *testing.T) {
+	op := types.PlanOp{Type: "fertilizer", Title: "urea", Qty: f64(10), Unit: "kg/rai"}
+
+	// from the day after tomorrow, at least MinFertilizerGapDays after 06-05
+	p := testPlacer("2026-06-10", []entities.ScheduleTask{{Type: "fertilizer", Date: day("2026-06-05")}}, nil)
+	got := placeOne(p, op)
+	if got.Type != "fertilizer" || got.Date.Format("2006-01-02") != "2026-06-19" {
+		t.Errorf("got %s on %s, want fertilizer on 2026-06-19", got.Type, got.Date.Format("2006-01-02"))
+	}
+	if got.Qty == nil || *got.Qty != 50 || got.Unit != "kg" {
+		t.Errorf("10 kg/rai on 5 rai: got %v %s, want 50 kg", got.Qty, got.Unit)
+	}
+
+	// Tillering's window has passed: the next fertilizer stage
+	if got := placeOne(testPlacer("2026-08-20", nil, nil), op); got.Date.Format("2006-01-02") != "2026-09-01" {
+		t.Errorf("after the Tillering window: placed on %s, want 2026-09-01", got.Date.Format("2006-01-02"))
+	}
+
+	// no window left: an advisory today
+	got = placeOne(testPlacer("2026-12-01", nil, nil), op)
+	if got.Type != "advisory" || got.Date.Format("2006-01-02") != "2026-12-01" {
+		t.Errorf("no window: got %s on %s, want advisory on 2026-12-01", got.Type, got.Date.Format("2006-01-02"))
+	}
+	if got.Qty != nil || got.Unit != "" {
+		t.Errorf("advisory keeps an amount: %+v", got)
+	}
+}
+
+func TestPlaceIrrigation(t *testing.T) {
+	last := []entities.ScheduleTask{{Type: "irrigation", Date: day("2026-06-08")}}
+
+	// 20 mm at 5 mm/day since 06-08 is due on 06-12; as m³ for the field
+	got := placeOne(testPlacer("2026-06-10", last, nil), types.PlanOp{Type: "irrigation", Title: "w", Qty: f64(20), Unit: "mm"})
+	if got.Date.Format("2006-01-02") != "2026-06-12" {
+		t.Errorf("placed on %s, want 2026-06-12", got.Date.Format("2006-01-02"))
+	}
+	if got.Qty == nil || *got.Qty != 20*m3PerMMRai*5 || got.Unit != "m3" {
+		t.Errorf("20 mm on 5 rai: got %v %s", got.Qty, got.Unit)
+	}
+
+	// 5 mm of rain on 06-09 delays it a day
+	rain := []entities.Measurement{{Date: day("2026-06-09"), RainfallMM: f64(5)}}
+	got = placeOne(testPlacer("2026-06-10", last, rain), types.PlanOp{Type: "irrigation", Title: "w", Qty: f64(20), Unit: "mm"})
+	if got.Date.Format("2006-01-02") != "2026-06-13" {
+		t.Errorf("after rain: placed on %s, want 2026-06-13", got.Date.Format("2006-01-02"))
+	}
+
+	// a waterlogged field drains for three days first
+	wet := []entities.Measurement{{Date: day("2026-06-10"), MoistState: "wet"}}
+	got = placeOne(testPlacer("2026-06-10", last, wet), types.PlanOp{Type: "irrigation", Title: "w", Qty: f64(5), Unit: "mm"})
+	if got.Date.Format("2006-01-02") != "2026-06-13" {
+		t.Errorf("after a wet day: placed on %s, want 2026-06-13", got.Date.Format("2006-01-02"))
+	}
+}
@@ -0,0 +1,175 @@
+package serviceImp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"aoi/entities"
+	planrepo "aoi/pkg/plan/repository"
+	schedrepo "aoi/pkg/schedule/repository"
+)
+
+// ErrPlanState is returned when a review action does not fit the plan's status.
+var ErrPlanState = errors.New("plan status does not allow this action")
+
+// actorSystem is recorded for transitions made by the planner itself.
+const actorSystem = "system"
+
+// withStatus sets the initial status of a new plan version: draft when the
+// field requires approval, otherwise approved by the system right away.
+func withStatus(f *entities.Field, p *entities.Plan) *entities.Plan {
+	if f.RequireApproval {
+		p.Status = entities.PlanStatusDraft
+		return p
+	}
+	now := time.Now()
+	p.Status, p.ApprovedBy, p.ApprovedAt = entities.PlanStatusApproved, actorSystem, &now
+	return p
+}
+
+// settleNewPlan runs right after a new version is created inside commit. An
+// auto-approved plan supersedes everything older; a draft only supersedes
+// older drafts still waiting for review (they were built on stale data).
+func settleNewPlan(pr planrepo.PlanRepository, p *entities.Plan) error {
+	if p.Status != entities.PlanStatusApproved {
+		return supersedeOlder(pr, p, actorSystem, entities.PlanStatusDraft, entities.PlanStatusUnderReview)
+	}
+	if err := pr.CreateReview(&entities.PlanReview{
+		PlanID: p.PlanID, FieldID: p.FieldID, Action: entities.ReviewActionAutoApprove,
+		ToStatus: entities.PlanStatusApproved, Actor: actorSystem, Comment: "field does not require approval",
+	}); err != nil {
+		return err
+	}
+	return supersedeOlder(pr, p, actorSystem, entities.PlanStatusApproved, entities.PlanStatusDraft, entities.PlanStatusUnderReview)
+}
+
+// supersedeOlder marks the field's older versions that are in one of the
+// given statuses as superseded by p.
+func supersedeOlder(pr planrepo.PlanRepository, p *entities.Plan, actor string, statuses ...string) error {
+	older, err := pr.ListByField(p.FieldID)
+	if err != nil {
+		return err
+	}
+	for i := range older {
+		o := &older[i]
+		if o.Version >= p.Version || !contains(statuses, o.Status) {
+			continue
+		}
+		from := o.Status
+		o.Status = entities.PlanStatusSuperseded
+		if _, err := pr.UpdateStatus(o, from); err != nil {
+			return err
+		}
+		if err := pr.CreateReview(&entities.PlanReview{
+			PlanID: o.PlanID, FieldID: o.FieldID, Action: entities.ReviewActionSupersede,
+			FromStatus: from, ToStatus: entities.PlanStatusSuperseded, Actor: actor,
+			Comment: fmt.Sprintf("superseded by v%d", p.Version),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SubmitPlan sends a draft to the reviewers (draft → under_review).
+func (s *PlanSvc) SubmitPlan(ctx context.Context, planID uint, actor, comment string) (*entities.Plan, error) {
+	return s.transition(ctx, planID, entities.ReviewActionSubmit, actor, comment, entities.PlanStatusDraft, entities.PlanStatusUnderReview)
+}
+
+// ReviewPlan approves a plan under review (it becomes the field's current plan
+// and older versions are superseded) or sends it back to draft with comments.
+func (s *PlanSvc) ReviewPlan(ctx context.Context, planID uint, reviewer string, approve bool, comment string) (*entities.Plan, error) {
+	if approve {
+		return s.transition(ctx, planID, entities.ReviewActionApprove, reviewer, comment, entities.PlanStatusUnderReview, entities.PlanStatusApproved)
+	}
+	return s.transition(ctx, planID, entities.ReviewActionRequestChanges, reviewer, comment, entities.PlanStatusUnderReview, entities.PlanStatusDraft)
+}
+
+// PlanReviews returns the status history of a plan, oldest first.
+func (s *PlanSvc) PlanReviews(planID uint) ([]entities.PlanReview, error) {
+	return s.repoPlan.ListReviews(planID)
+}
+
+// PendingReviews lists plans waiting for a reviewer, oldest first.
+func (s *PlanSvc) PendingReviews() ([]entities.Plan, error) {
+	return s.repoPlan.ListByStatus(entities.PlanStatusUnderReview)
+}
+
+// PlanTasks returns all tasks of a plan, whatever its status.
+func (s *PlanSvc) PlanTasks(planID uint) ([]entities.ScheduleTask, error) {
+	return s.repoSched.ListByPlan(planID)
+}
+
+func (s *PlanSvc) transition(ctx context.Context, planID uint, action, actor, comment, from, to string) (*entities.Plan, error) {
+	var out *entities.Plan
+	err := s.inTx(ctx, func(pr planrepo.PlanRepository, _ schedrepo.ScheduleRepository) error {
+		p, err := pr.FindByID(planID)
+		if err != nil {
+			return err
+		}
+		if p.Status != from {
+			return ErrPlanState
+		}
+		p.Status = to
+		if to == entities.PlanStatusApproved {
+			now := time.Now()
+			p.ApprovedBy, p.ApprovedAt = actor, &now
+		}
+		ok, err := pr.UpdateStatus(p, from)
+		if err != nil {
+			return err
+		}
+		if !ok { // another reviewer acted first
+			return ErrPlanState
+		}
+		if err := pr.CreateReview(&entities.PlanReview{
+			PlanID: p.PlanID, FieldID: p.FieldID, Action: action,
+			FromStatus: from, ToStatus: to, Actor: actor, Comment: comment,
+		}); err != nil {
+			return err
+		}
+		if to == entities.PlanStatusApproved {
+			if err := supersedeOlder(pr, p, actor, entities.PlanStatusApproved, entities.PlanStatusDraft, entities.PlanStatusUnderReview); err != nil {
+				return err
+			}
+		}
+		out = p
+		return nil
+	})
+	return out, err
+}
+
+// holdForReview turns a kept (approved) plan plus newly proposed tasks into a
+// draft version — a copy of the current schedule with the extra tasks — so the
+// proposals wait for review instead of reaching the farmer directly.
+func (s *PlanSvc) holdForReview(ctx context.Context, f *entities.Field, d *planDraft) error {
+	base := d.base
+	tasks, err := s.repoSched.WithContext(ctx).ListByPlan(base.PlanID)
+	if err != nil {
+		return err
+	}
+	copies := make([]entities.ScheduleTask, 0, len(tasks))
+	for _, t := range tasks {
+		if t.Manual { // carried over by commit, with the tombstones
+			continue
+		}
+		t.TaskID, t.PlanID = 0, 0
+		t.CreatedAt, t.UpdatedAt = time.Time{}, time.Time{}
+		copies = append(copies, t)
+	}
+	d.plan = withStatus(f, &entities.Plan{FieldID: base.FieldID, Version: base.Version + 1, SummaryMD: base.SummaryMD, SummaryProvider: base.SummaryProvider, SummaryPrompt: base.SummaryPrompt, StagesJSON: base.StagesJSON})
+	d.tasks = copies
+	d.log.DeltaMD += fmt.Sprintf("; proposed tasks held for review in plan v%d", d.plan.Version)
+	return nil
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
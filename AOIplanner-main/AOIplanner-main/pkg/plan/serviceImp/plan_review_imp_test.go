@@ -0,0 +1,118 @@
+package serviceImp
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"aoi/entities"
+)
+
+func TestApprovalStateMachine(t *testing.T) {
+	s, _ := commitSvc(t)
+	ctx := context.Background()
+	f := &entities.Field{FieldID: 1, RequireApproval: true}
+
+	v1 := &planDraft{plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 1})}
+	if err := s.commit(ctx, v1); err != nil {
+		t.Fatal(err)
+	}
+	id := v1.plan.PlanID
+	if v1.plan.Status != entities.PlanStatusDraft {
+		t.Fatalf("new plan of a field that requires approval: %s", v1.plan.Status)
+	}
+
+	// a draft cannot be reviewed
+	if _, err := s.ReviewPlan(ctx, id, "rev", true, ""); !errors.Is(err, ErrPlanState) {
+		t.Errorf("approve a draft: want ErrPlanState, got %v", err)
+	}
+	mustStatus := func(p *entities.Plan, err error, want string) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Status != want {
+			t.Fatalf("status %s, want %s", p.Status, want)
+		}
+	}
+
+	p, err := s.SubmitPlan(ctx, id, "farmer", "")
+	mustStatus(p, err, entities.PlanStatusUnderReview)
+	if _, err := s.SubmitPlan(ctx, id, "farmer", ""); !errors.Is(err, ErrPlanState) {
+		t.Errorf("submit twice: want ErrPlanState, got %v", err)
+	}
+	p, err = s.ReviewPlan(ctx, id, "rev", false, "more water")
+	mustStatus(p, err, entities.PlanStatusDraft)
+	p, err = s.SubmitPlan(ctx, id, "farmer", "")
+	mustStatus(p, err, entities.PlanStatusUnderReview)
+	p, err = s.ReviewPlan(ctx, id, "rev", true, "ok")
+	mustStatus(p, err, entities.PlanStatusApproved)
+	if p.ApprovedBy != "rev" || p.ApprovedAt == nil {
+		t.Errorf("approval not recorded: %+v", p)
+	}
+	if _, err := s.ReviewPlan(ctx, id, "rev2", true, ""); !errors.Is(err, ErrPlanState) {
+		t.Errorf("approve twice: want ErrPlanState, got %v", err)
+	}
+
+	reviews, err := s.PlanReviews(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, r := range reviews {
+		actions = append(actions, r.Action)
+	}
+	want := []string{entities.ReviewActionSubmit, entities.ReviewActionRequestChanges, entities.ReviewActionSubmit, entities.ReviewActionApprove}
+	if len(actions) != len(want) {
+		t.Fatalf("history %v, want %v", actions, want)
+	}
+	for i := range want {
+		if actions[i] != want[i] {
+			t.Fatalf("history %v, want %v", actions, want)
+		}
+	}
+
+	// approving v2 supersedes the approved v1
+	v2 := &planDraft{base: v1.plan, plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 2})}
+	if err := s.commit(ctx, v2); err != nil {
+		t.Fatal(err)
+	}
+	if cur, err := s.repoPlan.CurrentByField(1); err != nil || cur.PlanID != id {
+		t.Fatalf("a draft v2 must not replace the approved v1: %+v, %v", cur, err)
+	}
+	if _, err := s.SubmitPlan(ctx, v2.plan.PlanID, "farmer", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ReviewPlan(ctx, v2.plan.PlanID, "rev", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	old, _ := s.PlanByID(id)
+	if old.Status != entities.PlanStatusSuperseded {
+		t.Errorf("v1 after v2 was approved: %s", old.Status)
+	}
+}
+
+func TestAutoApprove(t *testing.T) {
+	s, _ := commitSvc(t)
+	ctx := context.Background()
+	f := &entities.Field{FieldID: 1}
+
+	v1 := &planDraft{plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 1})}
+	if err := s.commit(ctx, v1); err != nil {
+		t.Fatal(err)
+	}
+	v2 := &planDraft{base: v1.plan, plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 2})}
+	if err := s.commit(ctx, v2); err != nil {
+		t.Fatal(err)
+	}
+	if v2.plan.Status != entities.PlanStatusApproved || v2.plan.ApprovedBy != actorSystem {
+		t.Errorf("v2: %+v", v2.plan)
+	}
+	old, _ := s.PlanByID(v1.plan.PlanID)
+	if old.Status != entities.PlanStatusSuperseded {
+		t.Errorf("v1: %s, want superseded", old.Status)
+	}
+	if _, err := s.SubmitPlan(ctx, v2.plan.PlanID, "farmer", ""); !errors.Is(err, ErrPlanState) {
+		t.Errorf("submit an approved plan: want ErrPlanState, got %v", err)
+	}
+}
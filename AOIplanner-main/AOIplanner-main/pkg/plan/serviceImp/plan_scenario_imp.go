@@ -0,0 +1,149 @@
+package serviceImp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/plan/types"
+)
+
+// ErrBadScenario wraps validation errors of what-if overrides.
+var ErrBadScenario = errors.New("invalid scenario")
+
+// Rough cost placeholders (THB) for comparing scenarios, in the same spirit as
+// the 15-15-15 placeholder in ExpandDaily; not meant as a budget.
+const (
+	fertilizerTHBPerKg = 18.0
+	maxScenarios       = 6
+)
+
+var waterTHBPerM3 = map[string]float64{
+	"well":    3.5, // pumping energy from groundwater
+	"surface": 1.5, // canal/pond lift
+	"none":    0,   // rain-fed
+}
+
+// Scenario is a named set of overrides submitted for simulation.
+type Scenario struct {
+	Name string `json:"name"`
+	types.ScenarioOverrides
+}
+
+// SimulateScenarios runs BuildStages/ExpandDaily for the field as-is
+// ("baseline") and for every variant, without writing anything.
+func (s *PlanSvc) SimulateScenarios(field *entities.Field, variants []Scenario) ([]types.ScenarioResult, error) {
+	if len(variants) > maxScenarios {
+		return nil, fmt.Errorf("%w: at most %d variants", ErrBadScenario, maxScenarios)
+	}
+	out := make([]types.ScenarioResult, 0, len(variants)+1)
+	out = append(out, s.simulate("baseline", types.ScenarioOverrides{}, *field))
+	for i, v := range variants {
+		f, err := applyOverrides(*field, v.ScenarioOverrides)
+		if err != nil {
+			return nil, err
+		}
+		name := v.Name
+		if name == "" {
+			name = fmt.Sprintf("variant_%d", i+1)
+		}
+		out = append(out, s.simulate(name, v.ScenarioOverrides, f))
+	}
+	return out, nil
+}
+
+func applyOverrides(f entities.Field, o types.ScenarioOverrides) (entities.Field, error) {
+	if o.PlantingDate != "" {
+		d, err := time.Parse("2006-01-02", o.PlantingDate)
+		if err != nil {
+			return f, fmt.Errorf("%w: planting_date must be YYYY-MM-DD", ErrBadScenario)
+		}
+		f.PlantingDate = d
+	}
+	check := func(name, v string, allowed ...string) error {
+		if v == "" {
+			return nil
+		}
+		for _, a := range allowed {
+			if v == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: %s must be one of %v", ErrBadScenario, name, allowed)
+	}
+	if err := check("crop_type", o.CropType, "new_plant", "ratoon"); err != nil {
+		return f, err
+	}
+	if err := check("soil_texture", o.SoilTexture, "sand", "loam", "clay"); err != nil {
+		return f, err
+	}
+	if err := check("irrigation_src", o.IrrigationSrc, "well", "surface", "none"); err != nil {
+		return f, err
+	}
+	if o.CropType != "" {
+		f.CropType = o.CropType
+	}
+	if o.SoilTexture != "" {
+		f.SoilTexture = o.SoilTexture
+	}
+	if o.IrrigationSrc != "" {
+		f.IrrigationSrc = o.IrrigationSrc
+	}
+	if o.PumpM3H != nil {
+		if *o.PumpM3H <= 0 {
+			return f, fmt.Errorf("%w: pump_m3h must be > 0", ErrBadScenario)
+		}
+		f.PumpM3H = o.PumpM3H
+	}
+	return f, nil
+}
+
+func (s *PlanSvc) simulate(name string, o types.ScenarioOverrides, f entities.Field) types.ScenarioResult {
+	stages := s.rules.BuildStages(&f)
+	ops := s.rules.ExpandDaily(&f, stages)
+
+	res := types.ScenarioResult{
+		Name:         name,
+		Overrides:    o,
+		PlantingDate: f.PlantingDate.Format("2006-01-02"),
+		TasksByMonth: map[string]map[string]int{},
+		Stages:       stages,
+	}
+	if len(stages) > 0 {
+		res.HarvestDate = stages[len(stages)-1].EndDate
+		if hd, err := time.Parse("2006-01-02", res.HarvestDate); err == nil {
+			res.SeasonDays = int(hd.Sub(f.PlantingDate).Hours() / 24)
+		}
+	}
+	for _, op := range ops {
+		if len(op.Date) >= 7 {
+			m := op.Date[:7]
+			if res.TasksByMonth[m] == nil {
+				res.TasksByMonth[m] = map[string]int{}
+			}
+			res.TasksByMonth[m][op.Type]++
+			res.TasksByMonth[m]["total"]++
+		}
+		if op.Qty == nil {
+			continue
+		}
+		switch {
+		case op.Type == "irrigation" && op.Unit == "m3":
+			res.WaterM3 += *op.Qty
+		case op.Type == "fertilizer" && op.Unit == "kg":
+			res.FertilizerKg += *op.Qty
+		}
+	}
+
+	src := f.IrrigationSrc
+	if _, ok := waterTHBPerM3[src]; !ok {
+		src = "well"
+	}
+	if f.PumpM3H != nil && *f.PumpM3H > 0 && src != "none" {
+		h := res.WaterM3 / *f.PumpM3H
+		res.PumpHours = &h
+	}
+	res.CostTHB = res.WaterM3*waterTHBPerM3[src] + res.FertilizerKg*fertilizerTHBPerKg
+	return res
+}
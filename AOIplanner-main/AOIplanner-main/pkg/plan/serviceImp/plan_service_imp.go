@@ -1,176 +1,425 @@
 package serviceImp
 
 import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"strconv"
 	"time"
 
+	"gorm.io/gorm"
+
 	"aoi/entities"
 	"aoi/pkg/ai"
+	"aoi/pkg/i18n"
 	"aoi/pkg/measure/repository"
 	planrepo "aoi/pkg/plan/repository"
+	planRepoImp "aoi/pkg/plan/repositoryImp"
 	schedrepo "aoi/pkg/schedule/repository"
+	schedRepoImp "aoi/pkg/schedule/repositoryImp"
+	schedSvcImp "aoi/pkg/schedule/serviceImp"
 	"aoi/pkg/climate"
 	"aoi/pkg/plan/types"
+	"aoi/pkg/problem"
 	"strings"
 )
 
+var (
+	// ErrPlanExists is returned by GenerateFirstPlan when the field already has a plan.
+	ErrPlanExists = errors.New("field already has a plan")
+	// ErrPlanConflict is returned when another request created a plan version first.
+	ErrPlanConflict = errors.New("plan was changed by another request")
+)
+
 type ReplanOptions struct {
 	Reason   string
-	Problems []string
+	Codes    []string // problem catalogue codes (see pkg/problem)
+	Problems []string // free-text problems from older clients
+}
+// GenerateOptions tune GenerateFirstPlanWithOptions.
+type GenerateOptions struct {
+	// DeferSummary skips the LLM summary; the client streams it afterwards
+	// from /plans/:plan_id/summary/stream, which also stores it.
+	DeferSummary bool
 }
+
 type kbSearcher interface {
-    Search(query string, k int) ([]entities.KBChunk, error)
-    DocsMeta(ids []uint) (map[uint]entities.KBDocument, error)  // ← add
+    Search(ctx context.Context, query string, k int) ([]entities.KBChunk, error)
+    DocsMeta(ctx context.Context, ids []uint) (map[uint]entities.KBDocument, error)  // ← add
+}
+
+// Budgets are the deadlines for building a plan. Total caps a whole
+// generate/replan call; the others cap one outbound step each, counted from
+// the start of that step. A step that runs out of budget falls back to
+// deterministic output and is listed in Plan.Partial.
+type Budgets struct {
+	Total      time.Duration
+	KBSearch   time.Duration
+	Summary    time.Duration
+	ProposeOps time.Duration
 }
+
+// DefaultBudgets fit inside a mobile client's patience for one request.
+var DefaultBudgets = Budgets{Total: 60 * time.Second, KBSearch: 5 * time.Second, Summary: 20 * time.Second, ProposeOps: 20 * time.Second}
+
+// Steps reported in Plan.Partial.
+const (
+	StepKB         = "kb"
+	StepSummary    = "summary"
+	StepProposeOps = "propose_ops"
+)
+
 type PlanSvc struct{
+	db    *gorm.DB
 	rules climate.RulesEngine
 	llm   ai.Client
 	repoPlan   planrepo.PlanRepository
 	repoSched  schedrepo.ScheduleRepository
 	repoMeas   repository.MeasureRepository
 	kb        kbSearcher
+	budgets   Budgets
+	diagnoses diagnosedProblems // optional: photo findings added to replans
 }
 
-var lastKBRefs []map[string]string
+// diagnosedProblems supplies problem codes recently found in field photos.
+type diagnosedProblems interface {
+	RecentCodes(ctx context.Context, fieldID uint) ([]string, error)
+}
 
-func setLastKBRefs(refs []map[string]string) { lastKBRefs = refs }
-func LastKBRefs() []map[string]string { return lastKBRefs }
+// planDraft is a plan version (or a kept plan plus replan log) that has been
+// computed but not yet written; commit persists it in one transaction.
+type planDraft struct {
+	base      *entities.Plan // latest plan when the draft was computed; nil for a first plan
+	plan      *entities.Plan // new plan, or base when it is kept
+	tasks     []entities.ScheduleTask
+	citations []entities.PlanCitation
+	log       *entities.ReplanLog
 
-func NewPlanService(r climate.RulesEngine, llm ai.Client, pr planrepo.PlanRepository, sr schedrepo.ScheduleRepository, mr repository.MeasureRepository, kb kbSearcher) *PlanSvc {
-	return &PlanSvc{rules:r, llm:llm, repoPlan:pr, repoSched:sr, repoMeas:mr, kb:kb}
+	// extra tasks and citations that belong to the replan log (problems → KB → ops)
+	extraTasks   []entities.ScheduleTask
+	logCitations []entities.PlanCitation
+
+	partial []string // steps that fell back (see Budgets)
+
+	llmCalls []uint // audit rows of the LLM calls made for this draft, linked to the plan on commit
 }
 
-func (s *PlanSvc) GenerateFirstPlan(field *entities.Field) (*entities.Plan, []entities.ScheduleTask, error) {
+func NewPlanService(db *gorm.DB, r climate.RulesEngine, llm ai.Client, pr planrepo.PlanRepository, sr schedrepo.ScheduleRepository, mr repository.MeasureRepository, kb kbSearcher) *PlanSvc {
+	return &PlanSvc{db:db, rules:r, llm:llm, repoPlan:pr, repoSched:sr, repoMeas:mr, kb:kb, budgets:DefaultBudgets}
+}
+
+// WithBudgets replaces the default deadlines; zero fields keep their default.
+func (s *PlanSvc) WithBudgets(b Budgets) *PlanSvc {
+	if b.Total > 0 { s.budgets.Total = b.Total }
+	if b.KBSearch > 0 { s.budgets.KBSearch = b.KBSearch }
+	if b.Summary > 0 { s.budgets.Summary = b.Summary }
+	if b.ProposeOps > 0 { s.budgets.ProposeOps = b.ProposeOps }
+	return s
+}
+
+// WithDiagnoses makes replans include the problems confidently diagnosed
+// from the field's recent photos.
+func (s *PlanSvc) WithDiagnoses(d diagnosedProblems) *PlanSvc {
+	s.diagnoses = d
+	return s
+}
+
+func (s *PlanSvc) GenerateFirstPlan(ctx context.Context, field *entities.Field) (*entities.Plan, []entities.ScheduleTask, error) {
+	return s.GenerateFirstPlanWithOptions(ctx, field, GenerateOptions{})
+}
+
+func (s *PlanSvc) GenerateFirstPlanWithOptions(ctx context.Context, field *entities.Field, opts GenerateOptions) (*entities.Plan, []entities.ScheduleTask, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.budgets.Total)
+	defer cancel()
+	if _, err := s.repoPlan.WithContext(ctx).LatestByField(field.FieldID); err == nil {
+		return nil, nil, ErrPlanExists
+	}
 	stages := s.rules.BuildStages(field)
 	ops := s.rules.ExpandDaily(field, stages)
 
-	var kbCtx string
-
-	if s.kb != nil {
-    query := field.Variety + " sugarcane " +
-        field.SoilTexture + " " + field.Province + " " + field.District +
-        " irrigation fertilizer pest Thailand"
-    snips, _ := s.kb.Search(query, 6)
-	var kbRefs []map[string]string
-
-    // build kbCtx
-    for _, ch := range snips {
-        if len(kbCtx) > 6000 { break }
-        kbCtx += "\n---\n" + ch.Text
-    }
-
-    // collect unique docs → refs
-    seen := map[uint]struct{}{}
-    ids := make([]uint, 0, len(snips))
-    for _, ch := range snips {
-        if _, ok := seen[ch.DocID]; !ok {
-            seen[ch.DocID] = struct{}{}
-            ids = append(ids, ch.DocID)
-        }
-    }
-	if len(ids) > 0 {
-		if meta, err := s.kb.DocsMeta(ids); err == nil {
-			for _, id := range ids {
-				if d, ok := meta[id]; ok {
-					kbRefs = append(kbRefs, map[string]string{"title": d.Title, "source_url": d.SourceURL})
-				}
-			}
-		}
+	d := &planDraft{}
+	kbCtx, snips := s.fieldKB(ctx, d, field)
+	summary, src := "", ai.CallInfo{}
+	if !opts.DeferSummary {
+		summary, src = s.summarize(ctx, d, field, stages, ops, kbCtx)
 	}
-	setLastKBRefs(kbRefs)
-}
+	if err := ctx.Err(); err != nil { return nil, nil, err }
 
-	summary := s.llm.SummarizePlan(field, stages, ops, kbCtx)
 	stagesJSON, _ := json.Marshal(stages)
-	p := &entities.Plan{FieldID: field.FieldID, Version: 1, SummaryMD: summary, StagesJSON: string(stagesJSON)}
-	if err := s.repoPlan.Create(p); err != nil { return nil, nil, err }
-	tasks := s.rules.ToSchedule(field, p.PlanID, ops)
-	if err := s.repoSched.BulkInsert(tasks); err != nil { return nil, nil, err }
-	return p, tasks, nil
+	d.plan = withStatus(field, &entities.Plan{FieldID: field.FieldID, Version: 1, SummaryMD: summary, SummaryProvider: src.Provider, SummaryPrompt: src.Prompt, StagesJSON: string(stagesJSON)})
+	d.tasks = s.rules.ToSchedule(field, 0, ops)
+	stampUIDs(field.FieldID, stages, d.tasks)
+	d.citations = s.citationsFor(ctx, snips)
+	if err := s.commit(ctx, d); err != nil {
+		if errors.Is(err, ErrPlanConflict) { return nil, nil, ErrPlanExists }
+		return nil, nil, err
+	}
+	d.plan.Citations = d.citations
+	d.plan.Partial = d.partial
+	return d.plan, d.tasks, nil
 }
 
-func (s *PlanSvc) Replan(field *entities.Field) (*entities.Plan, []entities.ScheduleTask, *entities.ReplanLog, error) {
-	// load latest plan
-	old, err := s.repoPlan.LatestByField(field.FieldID)
+// Replan evaluates drift and, if needed, builds the next plan version. Every
+// attempt is persisted to replan_logs, including "no drift" outcomes.
+func (s *PlanSvc) Replan(ctx context.Context, field *entities.Field) (*entities.Plan, []entities.ScheduleTask, *entities.ReplanLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.budgets.Total)
+	defer cancel()
+	d, err := s.replan(ctx, field)
 	if err != nil { return nil, nil, nil, err }
+	if err := s.commit(ctx, d); err != nil { return nil, nil, nil, err }
+	if d.plan != d.base { d.plan.Citations = d.citations }
+	d.plan.Partial = d.partial
+	return d.plan, d.tasks, d.log, nil
+}
+
+// fieldKB retrieves KB context for a field's plan within the KB budget; on
+// timeout or error the plan is built without it.
+func (s *PlanSvc) fieldKB(ctx context.Context, d *planDraft, field *entities.Field) (string, []entities.KBChunk) {
+	if s.kb == nil { return "", nil }
+	query := field.Variety + " sugarcane " +
+		field.SoilTexture + " " + field.Province + " " + field.District +
+		" irrigation fertilizer pest Thailand"
+	kctx, cancel := context.WithTimeout(ctx, s.budgets.KBSearch)
+	defer cancel()
+	snips, err := s.kb.Search(kctx, query, 6)
+	if err != nil {
+		d.fellBack(StepKB)
+		return "", nil
+	}
+	meta, _ := s.kb.DocsMeta(kctx, uniqueDocIDs(snips)) // titles only; passages go in without them on error
+	var kbCtx string // best first; the prompt keeps what fits its token budget
+	for _, ch := range snips {
+		kbCtx += ai.KBPassage(meta[ch.DocID].Title, ch.Text)
+	}
+	return kbCtx, snips
+}
+
+// summarize asks the LLM for the plan summary within the summary budget. The
+// client returns its deterministic summary alongside any error, so a slow or
+// cancelled call still yields a usable plan. The provider and prompt version
+// that produced it are returned with it (empty for the fallback).
+func (s *PlanSvc) summarize(ctx context.Context, d *planDraft, field *entities.Field, stages []types.StagePlan, ops []types.PlanOp, kbCtx string) (string, ai.CallInfo) {
+	sctx, cancel := context.WithTimeout(ctx, s.budgets.Summary)
+	defer cancel()
+	sctx, ci := ai.WithCallInfo(sctx)
+	summary, err := s.llm.SummarizePlan(sctx, field, stages, ops, kbCtx)
+	d.noteCall(ci)
+	if err != nil {
+		d.fellBack(StepSummary)
+		return summary, ai.CallInfo{}
+	}
+	return summary, *ci
+}
+
+func (d *planDraft) noteCall(ci *ai.CallInfo) {
+	if ci.CallID != 0 { d.llmCalls = append(d.llmCalls, ci.CallID) }
+}
+
+func (d *planDraft) fellBack(step string) {
+	if !contains(d.partial, step) { d.partial = append(d.partial, step) }
+}
+
+// PlanByID loads a single plan without its tasks.
+func (s *PlanSvc) PlanByID(planID uint) (*entities.Plan, error) {
+	return s.repoPlan.FindByID(planID)
+}
+
+// Citations returns the KB chunks recorded for a plan and its replans.
+func (s *PlanSvc) Citations(planID uint) ([]entities.PlanCitation, error) {
+	return s.repoPlan.CitationsByPlan(planID)
+}
+
+// ReplanHistory returns the replan timeline of a field, newest first.
+func (s *PlanSvc) ReplanHistory(fieldID uint) ([]entities.ReplanLog, error) {
+	return s.repoPlan.ListReplanLogs(fieldID)
+}
+
+// DriftCheck is the result of evaluating a field against its latest plan.
+type DriftCheck struct {
+	Plan    *entities.Plan
+	Stages  []types.StagePlan
+	Need    bool
+	Reason  string
+	Metrics types.DriftMetrics
+}
+
+// CheckDrift runs the drift rules on the latest plan and the last 14 days of
+// measurements without writing anything.
+func (s *PlanSvc) CheckDrift(ctx context.Context, field *entities.Field) (*DriftCheck, error) {
+	// load latest plan
+	old, err := s.repoPlan.WithContext(ctx).LatestByField(field.FieldID)
+	if err != nil { return nil, err }
 	// recent measurements
-	recent, _ := s.repoMeas.Recent(field.FieldID, 14)
+	recent, _ := s.repoMeas.WithContext(ctx).Recent(field.FieldID, 14)
 	// parse old stages
 	var oldStages []types.StagePlan
 	_ = json.Unmarshal([]byte(old.StagesJSON), &oldStages)
 	// evaluate drift
-	need, reason := s.rules.EvaluateDrift(field, recent, oldStages)
-	if !need {
-		return old, nil, nil, nil
+	need, reason, metrics := s.rules.EvaluateDrift(field, recent, oldStages)
+	return &DriftCheck{Plan: old, Stages: oldStages, Need: need, Reason: reason, Metrics: metrics}, nil
+}
+
+// replan is the drift → new plan flow; nothing is written until commit.
+func (s *PlanSvc) replan(ctx context.Context, field *entities.Field) (*planDraft, error) {
+	chk, err := s.CheckDrift(ctx, field)
+	if err != nil { return nil, err }
+	old, reason, metrics := chk.Plan, chk.Reason, chk.Metrics
+	if !chk.Need {
+		return &planDraft{base: old, plan: old, log: &entities.ReplanLog{
+			FieldID:    field.FieldID,
+			PlanID:     old.PlanID,
+			PrevPlanID: old.PlanID,
+			Outcome:    entities.ReplanOutcomeNoDrift,
+			Reason:     "no drift",
+			DeltaMD:    fmt.Sprintf("checked at %s: no drift, kept plan v%d", time.Now().Format(time.RFC3339), old.Version),
+			Drift:      metrics,
+		}}, nil
 	}
 	// Build new stages (simple: shift forward 3 days)
 	field.PlantingDate = field.PlantingDate.AddDate(0,0,-3) // nudge earlier to increase expected height
 	newStages := s.rules.BuildStages(field)
 	ops := s.rules.ExpandDaily(field, newStages)
 
-	var kbCtx string
-	if s.kb != nil {
-		// build a focused query from the field
-		query := field.Variety + " sugarcane " +
-			field.SoilTexture + " " + field.Province + " " + field.District +
-			" irrigation fertilizer pest Thailand"
-		snips, _ := s.kb.Search(query, 6) // ignore errors for robustness
-		for _, ch := range snips {
-			if len(kbCtx) > 6000 { break }
-			kbCtx += "\n---\n" + ch.Text
-		}
-	}
+	d := &planDraft{base: old}
+	kbCtx, snips := s.fieldKB(ctx, d, field)
+	summary, src := s.summarize(ctx, d, field, newStages, ops, kbCtx)
+	if err := ctx.Err(); err != nil { return nil, err }
 
-	summary := s.llm.SummarizePlan(field, newStages, ops, kbCtx)
 	stagesJSON, _ := json.Marshal(newStages)
-	p := &entities.Plan{FieldID: field.FieldID, Version: old.Version+1, SummaryMD: summary, StagesJSON: string(stagesJSON)}
-	if err := s.repoPlan.Create(p); err != nil { return nil, nil, nil, err }
-	tasks := s.rules.ToSchedule(field, p.PlanID, ops)
-	if err := s.repoSched.BulkInsert(tasks); err != nil { return nil, nil, nil, err }
-	log := &entities.ReplanLog{
-    FieldID: field.FieldID,
-    PlanID:  p.PlanID, // store the new plan id here
-    Reason:  reason,
-    DeltaMD: fmt.Sprintf("replanned at %s due to %s", time.Now().Format(time.RFC3339), reason),
+	d.plan = withStatus(field, &entities.Plan{FieldID: field.FieldID, Version: old.Version+1, SummaryMD: summary, SummaryProvider: src.Provider, SummaryPrompt: src.Prompt, StagesJSON: string(stagesJSON)})
+	d.tasks = s.rules.ToSchedule(field, 0, ops)
+	stampUIDs(field.FieldID, newStages, d.tasks)
+	d.citations = s.citationsFor(ctx, snips)
+	d.log = &entities.ReplanLog{
+		FieldID:    field.FieldID,
+		PrevPlanID: old.PlanID,
+		Outcome:    entities.ReplanOutcomeReplanned,
+		Reason:     reason,
+		DeltaMD:    fmt.Sprintf("replanned at %s due to %s", time.Now().Format(time.RFC3339), reason),
+		Drift:      metrics,
 	}
-	return p, tasks, log, nil
+	return d, nil
+}
+
+// commit writes a draft atomically: the new plan, its tasks (plus the manual
+// edits carried over from the base) and citations, the replan log and anything
+// attached to it. It fails with ErrPlanConflict if the
+// field's latest plan is no longer d.base (a concurrent generate/replan won).
+// Nothing is written once ctx is done.
+func (s *PlanSvc) commit(ctx context.Context, d *planDraft) error {
+	if err := ctx.Err(); err != nil { return err }
+	return s.inTx(ctx, func(pr planrepo.PlanRepository, sr schedrepo.ScheduleRepository) error {
+		latest, err := pr.LatestByField(d.plan.FieldID)
+		switch {
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		case d.base == nil && err == nil:
+			return ErrPlanConflict
+		case d.base != nil && (err != nil || latest.PlanID != d.base.PlanID):
+			return ErrPlanConflict
+		}
+
+		if d.plan != d.base {
+			if err := pr.Create(d.plan); err != nil {
+				if errors.Is(err, gorm.ErrDuplicatedKey) { return ErrPlanConflict }
+				return err
+			}
+			if err := settleNewPlan(pr, d.plan); err != nil { return err }
+			if d.base != nil {
+				if d.tasks, err = carryManualTasks(sr, d.base.PlanID, d.tasks); err != nil { return err }
+			}
+			for i := range d.tasks { d.tasks[i].PlanID = d.plan.PlanID }
+			if len(d.tasks) > 0 {
+				if err := sr.BulkInsert(d.tasks); err != nil { return err }
+			}
+			for i := range d.citations { d.citations[i].PlanID = d.plan.PlanID }
+			if err := pr.CreateCitations(d.citations); err != nil { return err }
+		}
+		if err := pr.LinkLLMCalls(d.llmCalls, d.plan.PlanID); err != nil { return err }
+		if d.log == nil { return nil }
+
+		d.log.PlanID = d.plan.PlanID
+		if err := pr.CreateReplanLog(d.log); err != nil { return err }
+		for i := range d.extraTasks { d.extraTasks[i].PlanID = d.plan.PlanID }
+		if len(d.extraTasks) > 0 {
+			if err := sr.BulkInsert(d.extraTasks); err != nil { return err }
+		}
+		for i := range d.logCitations {
+			d.logCitations[i].PlanID = d.plan.PlanID
+			d.logCitations[i].ReplanLogID = &d.log.ID
+		}
+		return pr.CreateCitations(d.logCitations)
+	})
+}
+
+// inTx runs fn with repositories bound to a single transaction.
+func (s *PlanSvc) inTx(ctx context.Context, fn func(planrepo.PlanRepository, schedrepo.ScheduleRepository) error) error {
+	if s.db == nil { return fn(s.repoPlan.WithContext(ctx), s.repoSched.WithContext(ctx)) }
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(planRepoImp.New(tx), schedRepoImp.New(tx))
+	})
 }
 
 // ReplanWithOptions keeps your original flow but augments with problems → KB → LLM actions.
-func (s *PlanSvc) ReplanWithOptions(f *entities.Field, opts ReplanOptions) (*entities.Plan, []entities.ScheduleTask, *entities.ReplanLog, error) {
+func (s *PlanSvc) ReplanWithOptions(ctx context.Context, f *entities.Field, opts ReplanOptions) (*entities.Plan, []entities.ScheduleTask, *entities.ReplanLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.budgets.Total)
+	defer cancel()
 	// 1) Run your current replan to get baseline plan + tasks + replan log
-	p, tasks, rep, err := s.Replan(f) // <-- call your existing method
+	d, err := s.replan(ctx, f) // everything is persisted at the end, in one transaction
 	if err != nil {
 		return nil, nil, nil, err
 	}
+	rep := d.log
 
-	// 2) Build KB terms from problems + stage/season (light heuristic)
+	// 2) Resolve problem codes / free text against the catalogue and build KB terms,
+	// with what recent photos showed
+	codes := opts.Codes
+	if s.diagnoses != nil {
+		found, err := s.diagnoses.RecentCodes(ctx, f.FieldID)
+		if err != nil {
+			log.Printf("[plan] diagnosed problems for field #%d: %v", f.FieldID, err)
+		}
+		codes = append(append([]string(nil), codes...), found...)
+	}
+	probs, freeText := problem.Resolve(codes, opts.Problems)
+	labels := make([]string, 0, len(probs)+len(freeText))
+	codes = make([]string, 0, len(probs))
 	terms := []string{}
-	if len(opts.Problems) > 0 {
-		terms = append(terms, strings.Join(opts.Problems, " "))
+	for _, pr := range probs {
+		labels = append(labels, pr.LabelTH)
+		codes = append(codes, pr.Code)
+		terms = append(terms, pr.KBQuery)
+	}
+	labels = append(labels, freeText...)
+	if len(freeText) > 0 {
+		terms = append(terms, strings.Join(freeText, " "))
 	}
-	// if you have helpers to get current stage/season, add them here
 
 	// 3) Search KB and collect context (prefer mitrpholmodernfarm.com, then fallback)
 	kbCtx := ""
 	var kbRefs []entities.ArticleRef
+	var chunks []entities.KBChunk
 	if len(terms) > 0 && s.kb != nil {
-		chunks, _ := s.kb.Search(strings.Join(terms, " "), 12)
+		kctx, kcancel := context.WithTimeout(ctx, s.budgets.KBSearch)
+		chunks, err = s.kb.Search(kctx, strings.Join(terms, " "), 12)
+		kcancel()
+		if err != nil {
+			d.fellBack(StepKB)
+		}
 		if len(chunks) > 0 {
 			ids := uniqueDocIDs(chunks)
-			meta, _ := s.kb.DocsMeta(ids)
+			meta, _ := s.kb.DocsMeta(ctx, ids)
 
 			var mitr, other []entities.ArticleRef
 			var sb strings.Builder
 			for _, ch := range chunks {
 				m := meta[ch.DocID]
-				if t := strings.TrimSpace(m.Title); t != "" {
-					sb.WriteString(t)
-					sb.WriteString("\n")
-				}
-				sb.WriteString(ch.Text)
-				sb.WriteString("\n---\n")
+				sb.WriteString(ai.KBPassage(m.Title, ch.Text))
 
 				ref := entities.ArticleRef{Title: m.Title, URL: m.SourceURL}
 				if strings.Contains(strings.ToLower(m.SourceURL), "mitrpholmodernfarm.com") {
@@ -187,134 +436,99 @@ func (s *PlanSvc) ReplanWithOptions(f *entities.Field, opts ReplanOptions) (*ent
 
 	// 4) Ask LLM for structured extra ops (fallback to simple heuristics if LLM not configured)
 	var extraOps []types.PlanOp
+	opsSource, opsFrom := "llm", ai.CallInfo{}
 	if s.llm != nil {
-		if ops, err := s.llm.ProposeOps(f, /* stages */ nil, /* ops */ nil, opts.Problems, kbCtx); err == nil {
-			extraOps = ops
+		pctx, pcancel := context.WithTimeout(ctx, s.budgets.ProposeOps)
+		pctx, ci := ai.WithCallInfo(pctx)
+		ops, err := s.llm.ProposeOps(pctx, f, /* stages */ nil, /* ops */ nil, labels, kbCtx)
+		pcancel()
+		d.noteCall(ci)
+		if err == nil {
+			extraOps, opsFrom = ops, *ci
+		} else {
+			d.fellBack(StepProposeOps)
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
 	if len(extraOps) == 0 {
-		extraOps = s.deriveSuggestedOpsFallback(f, /* stages */ nil, opts.Problems, kbCtx)
+		extraOps = problem.Actions(probs)
+		opsSource, opsFrom = "fallback", ai.CallInfo{}
 	}
 
-	// 5) Materialize extra ops to tasks (allow new kinds: "inspect", "advisory")
-	extraTasks := s.materializeOpsToTasks(f, p.PlanID, extraOps)
+	// 5) Materialize extra ops to tasks, placed by type against the plan they join
+	pl := s.placerFor(ctx, f, d)
+	extraTasks := pl.place(extraOps)
 
 	// Ensure at least one inspect when problems mention diseases/season risk
-	if s.needsDiseaseScout(f, /* stages */ nil, opts.Problems) {
-		extraTasks = append(extraTasks, entities.ScheduleTask{
-			FieldID: f.FieldID,
-			PlanID:  p.PlanID,
-			Date:    time.Now().AddDate(0, 0, 3),
-			Type:    "inspect",
-			Title:   "สำรวจโรคตามฤดูกาล",
-			Notes:   "ดูใบขาว/กอตะไคร้/แส้ดำ/ใบจุดวงแหวนตามฤดูกาล",
-			Status:  "todo",
-		})
+	if problem.NeedsScout(probs) {
+		extraTasks = append(extraTasks, pl.place([]types.PlanOp{i18n.Op("inspect", "task.scout_problems", nil)})...)
 	}
-
-	// 6) Append tasks to baseline & persist with your existing save path
-	tasks = append(tasks, extraTasks...)
-	if len(extraTasks) > 0 {
-		if err := s.repoSched.BulkInsert(extraTasks); err != nil {
+	d.extraTasks = extraTasks
+	// with approval required, proposals on the current plan go into a new draft
+	if f.RequireApproval && d.plan == d.base && d.base.Status == entities.PlanStatusApproved && len(extraTasks) > 0 {
+		if err := s.holdForReview(ctx, f, d); err != nil {
 			return nil, nil, nil, err
 		}
 	}
 
-	// 7) Attach problems & suggested articles to the replan log (articles are transient)
-	if rep != nil {
-		rep.Problems = opts.Problems
-		// prefer mitr articles first (already ordered)
-		max := 5
-		if len(kbRefs) < max {
-			max = len(kbRefs)
-		}
-		rep.SuggestedArticles = kbRefs[:max]
+	// 6) Attach problems, suggested articles and proposed ops to the replan log
+	rep.UserReason = opts.Reason
+	rep.Problems = labels
+	rep.ProblemCodes = codes
+	// prefer mitr articles first (already ordered)
+	max := 5
+	if len(kbRefs) < max {
+		max = len(kbRefs)
 	}
+	rep.SuggestedArticles = kbRefs[:max]
+	rep.ProposedOps = extraOps
+	rep.OpsSource = opsSource
+	rep.OpsProvider, rep.OpsPrompt = opsFrom.Provider, opsFrom.Prompt
+	d.logCitations = s.citationsFor(ctx, chunks)
 
-	return p, tasks, rep, nil
-}
-
-// deriveSuggestedOpsFallback provides deterministic suggestions if the LLM is unavailable.
-func (s *PlanSvc) deriveSuggestedOpsFallback(f *entities.Field, stages []types.StagePlan, problems []string, kbCtx string) []types.PlanOp {
-	joined := strings.Join(problems, " ")
-	out := make([]types.PlanOp, 0, 6)
-
-	if strings.Contains(joined, "พายุ") {
-		out = append(out, types.PlanOp{
-			Type:  "advisory",
-			Title: "เตรียมระบายน้ำ/ขุดร่อง",
-			Notes: "กันน้ำขังเกิน 48 ชม.",
-		})
-	}
-	if strings.Contains(joined, "แห้ง") {
-		q := 20.0
-		out = append(out, types.PlanOp{
-			Type:  "irrigation",
-			Title: "เพิ่มน้ำชดเชยความชื้น",
-			Qty:   &q,
-			Unit:  "mm",
-			Notes: "ตามศักยภาพปั๊ม",
-		})
-	}
-	if strings.Contains(joined, "ใบขาว") || strings.Contains(joined, "กอตะไคร้") || strings.Contains(joined, "แส้ดำ") {
-		out = append(out, types.PlanOp{
-			Type:  "inspect",
-			Title: "สำรวจอาการโรคอ้อย",
-			Notes: "สุ่มตรวจ 5 จุด/แปลง พร้อมภาพประกอบ",
-		})
+	// 7) Persist plan, tasks, log and citations together
+	if err := s.commit(ctx, d); err != nil {
+		return nil, nil, nil, err
 	}
-	// always add seasonal scouting
-	out = append(out, types.PlanOp{
-		Type:  "inspect",
-		Title: "สำรวจโรคตามฤดูกาล",
-		Notes: "ดูใบจุดวงแหวน/เน่าแดงช่วงชื้น",
-	})
-	return out
+	p := d.plan
+	p.Citations, _ = s.repoPlan.WithContext(ctx).CitationsByPlan(p.PlanID)
+	p.Partial = d.partial
+
+	return p, append(d.tasks, d.extraTasks...), rep, nil
 }
 
-// materializeOpsToTasks maps suggested ops into schedule tasks for the given planID.
-func (s *PlanSvc) materializeOpsToTasks(field *entities.Field, planID uint, ops []types.PlanOp) []entities.ScheduleTask {
-	base := time.Now().Add(48 * time.Hour)
-	tasks := make([]entities.ScheduleTask, 0, len(ops))
-	for i, op := range ops {
-		t := entities.ScheduleTask{
-			FieldID: field.FieldID,
-			PlanID:  planID,
-			Date:    base.AddDate(0, 0, i),
-			Title:   op.Title,
-			Notes:   op.Notes,
-			Status:  "todo",
-		}
-		switch strings.ToLower(op.Type) {
-		case "irrigation":
-			t.Type = "irrigation"
-			t.Qty = op.Qty
-			if op.Unit != "" { t.Unit = op.Unit } else { t.Unit = "mm" }
-		case "fertilizer":
-			t.Type = "fertilizer"
-			t.Qty = op.Qty
-			t.Unit = op.Unit
-		case "pesticide":
-			t.Type = "pesticide"
-		case "inspect":
-			t.Type = "inspect"
-		default:
-			t.Type = "advisory"
-		}
-		tasks = append(tasks, t)
+// placerFor sets up placement of proposed ops on the plan the draft ends up
+// with: the new version's stages and tasks, or the kept plan's.
+func (s *PlanSvc) placerFor(ctx context.Context, f *entities.Field, d *planDraft) *placer {
+	var stages []types.StagePlan
+	_ = json.Unmarshal([]byte(d.plan.StagesJSON), &stages)
+	existing := d.tasks
+	if d.plan == d.base {
+		existing, _ = s.repoSched.WithContext(ctx).ListByPlan(d.base.PlanID)
 	}
-	return tasks
+	recent, _ := s.repoMeas.WithContext(ctx).Recent(f.FieldID, 14)
+	return newPlacer(f, stages, existing, recent)
 }
 
-// needsDiseaseScout enforces at least one inspection when problems imply disease/season risk.
-func (s *PlanSvc) needsDiseaseScout(f *entities.Field, stages []types.StagePlan, problems []string) bool {
-    joined := strings.Join(problems, " ")
-    if strings.Contains(joined, "ใบขาว") || strings.Contains(joined, "กอตะไคร้") ||
-       strings.Contains(joined, "แส้ดำ") || strings.Contains(joined, "จุดวงแหวน") {
-        return true
-    }
-    // you can extend this by season/stage if needed
-    return false
+// citationsFor turns retrieved chunks into citation rows; plan and replan-log
+// IDs are filled in by commit.
+func (s *PlanSvc) citationsFor(ctx context.Context, chunks []entities.KBChunk) []entities.PlanCitation {
+	if len(chunks) == 0 || s.kb == nil { return nil }
+	meta, _ := s.kb.DocsMeta(ctx, uniqueDocIDs(chunks))
+	out := make([]entities.PlanCitation, 0, len(chunks))
+	for _, ch := range chunks {
+		d := meta[ch.DocID]
+		out = append(out, entities.PlanCitation{
+			DocID:   ch.DocID,
+			ChunkID: ch.ChunkID,
+			Title:   d.Title,
+			URL:     d.SourceURL,
+			Score:   ch.Score,
+		})
+	}
+	return out
 }
 
 func uniqueDocIDs(chs []entities.KBChunk) []uint {
@@ -327,4 +541,65 @@ func uniqueDocIDs(chs []entities.KBChunk) []uint {
 		}
 	}
 	return ids
-}
\ No newline at end of file
+}
+
+// carryManualTasks copies the user's edits (incl. deletion tombstones) from
+// the base plan into a new version. Generated tasks that collide with an edit,
+// before or after it moved, are dropped: same type on the same day, or for
+// fertilizer within the minimum application gap.
+func carryManualTasks(sr schedrepo.ScheduleRepository, basePlanID uint, tasks []entities.ScheduleTask) ([]entities.ScheduleTask, error) {
+	manual, err := sr.ListManual(basePlanID)
+	if err != nil || len(manual) == 0 { return tasks, err }
+	collides := func(t entities.ScheduleTask) bool {
+		window := 0.0
+		if t.Type == "fertilizer" { window = schedSvcImp.MinFertilizerGapDays - 1 }
+		near := func(d time.Time) bool { return math.Abs(t.Date.Sub(d).Hours()/24) <= window }
+		for _, m := range manual {
+			if m.Type == t.Type && (near(m.Date) || (m.OrigDate != nil && near(*m.OrigDate))) { return true }
+		}
+		return false
+	}
+	out := make([]entities.ScheduleTask, 0, len(tasks)+len(manual))
+	for _, t := range tasks {
+		if !t.Manual && collides(t) { continue }
+		out = append(out, t)
+	}
+	for _, m := range manual {
+		m.TaskID, m.PlanID = 0, 0
+		m.CreatedAt, m.UpdatedAt = time.Time{}, time.Time{}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// stampUIDs gives generated tasks a UID from their place in the crop cycle:
+// type, message, stage and day within the stage. A drift replan moves the
+// stages, not the tasks' place in them, so the regenerated tasks keep their
+// UIDs and subscribed calendars update the events instead of adding new ones.
+func stampUIDs(fieldID uint, stages []types.StagePlan, tasks []entities.ScheduleTask) {
+	seen := map[string]int{}
+	for i := range tasks {
+		t := &tasks[i]
+		stage, offset := stageOffset(stages, t.Date)
+		what := t.MsgKey
+		if what == "" { what = t.Title }
+		key := fmt.Sprintf("%d|%s|%s|%s|%d", fieldID, t.Type, what, stage, offset)
+		if seen[key]++; seen[key] > 1 { key += "|" + strconv.Itoa(seen[key]) }
+		h := sha1.Sum([]byte(key))
+		t.UID = "p-" + hex.EncodeToString(h[:8])
+	}
+}
+
+// stageOffset is the stage d falls in and the days since its start; outside
+// every stage it is "" and the days since the first stage starts.
+func stageOffset(stages []types.StagePlan, d time.Time) (string, int) {
+	days := func(from string) int {
+		sd, _ := time.Parse("2006-01-02", from)
+		return int(math.Round(d.Sub(sd).Hours() / 24))
+	}
+	for _, st := range stages {
+		if n := days(st.StartDate); n >= 0 && st.EndDate > d.Format("2006-01-02") { return st.Stage, n }
+	}
+	if len(stages) == 0 { return "", 0 }
+	return "", days(stages[0].StartDate)
+}
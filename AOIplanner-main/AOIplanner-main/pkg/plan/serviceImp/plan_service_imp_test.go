@@ -0,0 +1,165 @@
+package serviceImp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"aoi/database"
+	"aoi/entities"
+	"aoi/pkg/ai"
+	"aoi/pkg/climate"
+	measRepoImp "aoi/pkg/measure/repositoryImp"
+	planRepoImp "aoi/pkg/plan/repositoryImp"
+	schedRepoImp "aoi/pkg/schedule/repositoryImp"
+)
+
+// commitSvc is a PlanSvc with just the storage commit needs.
+func commitSvc(t *testing.T) (*PlanSvc, *gorm.DB) {
+	t.Helper()
+	db := database.OpenSQLite(filepath.Join(t.TempDir(), "aoi.db"))
+	return &PlanSvc{db: db, repoPlan: planRepoImp.New(db), repoSched: schedRepoImp.New(db), budgets: DefaultBudgets}, db
+}
+
+func draftTasks(n int) []entities.ScheduleTask {
+	ts := make([]entities.ScheduleTask, n)
+	for i := range ts {
+		ts[i] = entities.ScheduleTask{FieldID: 1, Type: "observe", Title: "t", Status: "todo", Date: time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, i)}
+	}
+	return ts
+}
+
+func countRows(t *testing.T, db *gorm.DB, model any) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Model(model).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCommitVersions(t *testing.T) {
+	s, db := commitSvc(t)
+	ctx := context.Background()
+	f := &entities.Field{FieldID: 1}
+
+	v1 := &planDraft{plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 1}), tasks: draftTasks(3)}
+	if err := s.commit(ctx, v1); err != nil {
+		t.Fatal(err)
+	}
+	if v1.plan.PlanID == 0 || v1.tasks[2].PlanID != v1.plan.PlanID {
+		t.Fatalf("tasks not attached to the new plan: %+v", v1.tasks[2])
+	}
+
+	// a second first plan loses
+	dup := &planDraft{plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 1}), tasks: draftTasks(1)}
+	if err := s.commit(ctx, dup); !errors.Is(err, ErrPlanConflict) {
+		t.Errorf("second first plan: want ErrPlanConflict, got %v", err)
+	}
+
+	// two replans computed from v1: the first wins, the second is stale
+	a := &planDraft{base: v1.plan, plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 2}), tasks: draftTasks(2),
+		log: &entities.ReplanLog{FieldID: 1, PrevPlanID: v1.plan.PlanID, Outcome: entities.ReplanOutcomeReplanned}}
+	b := &planDraft{base: v1.plan, plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 2}), tasks: draftTasks(2),
+		log: &entities.ReplanLog{FieldID: 1, PrevPlanID: v1.plan.PlanID, Outcome: entities.ReplanOutcomeReplanned}}
+	if err := s.commit(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.commit(ctx, b); !errors.Is(err, ErrPlanConflict) {
+		t.Errorf("stale replan: want ErrPlanConflict, got %v", err)
+	}
+	if a.log.PlanID != a.plan.PlanID {
+		t.Errorf("replan log points at plan %d, want %d", a.log.PlanID, a.plan.PlanID)
+	}
+
+	// the losers wrote nothing
+	if n := countRows(t, db, &entities.Plan{}); n != 2 {
+		t.Errorf("%d plans, want 2", n)
+	}
+	if n := countRows(t, db, &entities.ScheduleTask{}); n != 5 {
+		t.Errorf("%d tasks, want 5", n)
+	}
+	if n := countRows(t, db, &entities.ReplanLog{}); n != 1 {
+		t.Errorf("%d replan logs, want 1", n)
+	}
+}
+
+func TestCommitDuplicateVersion(t *testing.T) {
+	s, _ := commitSvc(t)
+	ctx := context.Background()
+	f := &entities.Field{FieldID: 1}
+	v1 := &planDraft{plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 1})}
+	if err := s.commit(ctx, v1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unique (field, version) index catches a version taken outside commit's check
+	d := &planDraft{base: v1.plan, plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 1})}
+	if err := s.commit(ctx, d); !errors.Is(err, ErrPlanConflict) {
+		t.Errorf("duplicate version: want ErrPlanConflict, got %v", err)
+	}
+}
+
+func TestGenerateFirstPlanExists(t *testing.T) {
+	s, _ := commitSvc(t)
+	f := &entities.Field{FieldID: 1}
+	if err := s.commit(context.Background(), &planDraft{plan: withStatus(f, &entities.Plan{FieldID: 1, Version: 1})}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.GenerateFirstPlan(context.Background(), f); !errors.Is(err, ErrPlanExists) {
+		t.Errorf("want ErrPlanExists, got %v", err)
+	}
+}
+
+func TestReplanKeepsTaskUIDs(t *testing.T) {
+	dir := t.TempDir()
+	stagesCSV := filepath.Join(dir, "StageConfig.csv")
+	if err := os.WriteFile(stagesCSV, []byte("Stage,Days,WaterNeed_mm_per_day\nGermination,30,3\nTillering,60,4\nElongation,150,6\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := climate.LoadFromFiles(stagesCSV, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := database.OpenSQLite(filepath.Join(dir, "aoi.db"))
+	s := NewPlanService(db, rules, ai.NewMock(), planRepoImp.New(db), schedRepoImp.New(db), measRepoImp.New(db), nil)
+	ctx := context.Background()
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	f := &entities.Field{FieldID: 1, AreaRai: 5, SoilTexture: "loam", PlantingDate: today.AddDate(0, 0, -100)}
+	p1, tasks1, err := s.GenerateFirstPlan(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	short := 10.0 // far below the expected height: drift
+	db.Create(&entities.Measurement{FieldID: 1, Date: today, CaneHeightCM: &short})
+	p2, tasks2, _, err := s.Replan(ctx, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p2.PlanID == p1.PlanID || tasks2[0].Date.Equal(tasks1[0].Date) {
+		t.Fatalf("want a new plan with shifted dates: v%d, %s vs %s", p2.Version, tasks2[0].Date, tasks1[0].Date)
+	}
+
+	uids := map[string]bool{}
+	for _, tk := range tasks1 {
+		if tk.UID == "" || uids[tk.UID] {
+			t.Fatalf("v1 task %+v: UID empty or repeated", tk)
+		}
+		uids[tk.UID] = true
+	}
+	if len(tasks2) != len(tasks1) {
+		t.Fatalf("%d tasks after replan, want %d", len(tasks2), len(tasks1))
+	}
+	for _, tk := range tasks2 {
+		if !uids[tk.UID] {
+			t.Errorf("replanned %s on %s got a new UID %q", tk.Type, tk.Date.Format("2006-01-02"), tk.UID)
+		}
+		delete(uids, tk.UID)
+	}
+}
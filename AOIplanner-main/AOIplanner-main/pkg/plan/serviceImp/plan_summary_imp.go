@@ -0,0 +1,80 @@
+package serviceImp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"aoi/entities"
+	"aoi/pkg/ai"
+	"aoi/pkg/plan/types"
+)
+
+// SummaryWritable reports whether a plan's stored summary may be rewritten:
+// while it is a draft or under review, or if it has none yet. An approved
+// summary is reviewed content and only changes with a new plan version.
+func SummaryWritable(p *entities.Plan) bool {
+	switch p.Status {
+	case entities.PlanStatusDraft, entities.PlanStatusUnderReview:
+		return true
+	}
+	return p.SummaryMD == ""
+}
+
+// StreamSummary writes a plan's summary with the LLM, passing text to
+// onDelta as it arrives. The plan's current tasks (manual edits included) are
+// what gets summarised. With save, the result is stored in Plan.SummaryMD
+// (provider and prompt version in SummaryProvider/SummaryPrompt); that needs
+// SummaryWritable, else ErrPlanState is returned before the model is called.
+// Without save, p is only updated in memory.
+//
+// When the model fails, the deterministic fallback summary is returned with
+// fallback=true; it is only stored if the plan had no summary yet, so a good
+// earlier summary is not overwritten. If ctx ends (the client left), nothing
+// is stored and ctx's error is returned.
+func (s *PlanSvc) StreamSummary(ctx context.Context, p *entities.Plan, f *entities.Field, save bool, onDelta func(string)) (string, bool, error) {
+	if save && !SummaryWritable(p) {
+		return "", false, fmt.Errorf("%w: the summary of a %s plan is not rewritten", ErrPlanState, p.Status)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.budgets.Total)
+	defer cancel()
+	var stages []types.StagePlan
+	_ = json.Unmarshal([]byte(p.StagesJSON), &stages)
+	tasks, err := s.repoSched.WithContext(ctx).ListByPlan(p.PlanID)
+	if err != nil {
+		return "", false, err
+	}
+	ops := make([]types.PlanOp, 0, len(tasks))
+	for _, t := range tasks {
+		ops = append(ops, types.PlanOp{Date: t.Date.Format("2006-01-02"), Type: t.Type, Title: t.Title, Qty: t.Qty, Unit: t.Unit, Notes: t.Notes, Key: t.MsgKey, Params: t.MsgParams})
+	}
+	kbCtx, _ := s.fieldKB(ctx, &planDraft{}, f)
+
+	sctx, ci := ai.WithCallInfo(ctx)
+	ci.PlanID = &p.PlanID
+	text, err := s.llm.StreamSummary(sctx, f, stages, ops, kbCtx, onDelta)
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		return "", false, ctx.Err()
+	}
+	fallback := err != nil
+	if fallback {
+		log.Printf("[plan] summary stream for plan #%d fell back: %v", p.PlanID, err)
+	}
+	if fallback && p.SummaryMD != "" {
+		return text, true, nil
+	}
+	upd := *p
+	upd.SummaryMD, upd.SummaryProvider, upd.SummaryPrompt = text, ci.Provider, ci.Prompt
+	if fallback {
+		upd.SummaryProvider, upd.SummaryPrompt = "", ""
+	}
+	if save {
+		if err := s.repoPlan.WithContext(context.WithoutCancel(ctx)).UpdateSummary(&upd); err != nil {
+			return text, fallback, err
+		}
+	}
+	*p = upd
+	return text, fallback, nil
+}
@@ -1,19 +1,59 @@
 package types
 
 type StagePlan struct {
-	Stage      string  `json:"stage"`
-	StartDate  string  `json:"start_date"`
-	EndDate    string  `json:"end_date"`
-	WaterMMDay float64 `json:"water_mm_day"`
-	Notes      string  `json:"notes"`
+	Stage      string   `json:"stage"`
+	StartDate  string   `json:"start_date"`
+	EndDate    string   `json:"end_date"`
+	WaterMMDay float64  `json:"water_mm_day"`
+	Notes      string   `json:"notes"`
 	Ops        []PlanOp `json:"ops"`
 }
 
 type PlanOp struct {
 	Date  string   `json:"date"`
-	Type  string   `json:"type"`   // irrigation|fertilizer|pest|observe
+	Type  string   `json:"type"` // irrigation|fertilizer|pest|observe
 	Title string   `json:"title"`
 	Qty   *float64 `json:"qty,omitempty"`
 	Unit  string   `json:"unit,omitempty"`
 	Notes string   `json:"notes,omitempty"`
-}
\ No newline at end of file
+
+	// Key and Params name the catalogue message of a rule-generated op
+	// (see pkg/i18n), so its text can be rendered in the user's language.
+	Key    string            `json:"key,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// DriftMetrics captures the measurements EvaluateDrift looked at, so a replan
+// decision can be audited later.
+type DriftMetrics struct {
+	Samples           int      `json:"samples"`
+	DaysSincePlanting int      `json:"days_since_planting"`
+	ExpectedHeightCM  float64  `json:"expected_height_cm"`
+	LastHeightCM      *float64 `json:"last_height_cm,omitempty"`
+	DryStreak         int      `json:"dry_streak"`
+}
+
+// ScenarioOverrides are the field attributes a what-if variant may change.
+// Nil / empty values keep the field's own value.
+type ScenarioOverrides struct {
+	PlantingDate  string   `json:"planting_date,omitempty"`  // YYYY-MM-DD
+	CropType      string   `json:"crop_type,omitempty"`      // new_plant|ratoon
+	SoilTexture   string   `json:"soil_texture,omitempty"`   // sand|loam|clay
+	IrrigationSrc string   `json:"irrigation_src,omitempty"` // well|surface|none
+	PumpM3H       *float64 `json:"pump_m3h,omitempty"`
+}
+
+// ScenarioResult is the outcome of simulating one variant; nothing is persisted.
+type ScenarioResult struct {
+	Name         string                    `json:"name"`
+	Overrides    ScenarioOverrides         `json:"overrides"`
+	PlantingDate string                    `json:"planting_date"`
+	HarvestDate  string                    `json:"harvest_date"`
+	SeasonDays   int                       `json:"season_days"`
+	WaterM3      float64                   `json:"water_m3"`
+	FertilizerKg float64                   `json:"fertilizer_kg"`
+	PumpHours    *float64                  `json:"pump_hours,omitempty"` // nil when no pump capacity is known
+	CostTHB      float64                   `json:"estimated_cost_thb"`
+	TasksByMonth map[string]map[string]int `json:"tasks_by_month"` // "YYYY-MM" -> type -> count
+	Stages       []StagePlan               `json:"stages"`
+}
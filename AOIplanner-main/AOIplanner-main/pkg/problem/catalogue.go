@@ -0,0 +1,273 @@
+// Package problem is the catalogue of field problems a farmer can report when
+// asking for a replan, with the default actions and KB queries for each.
+package problem
+
+import (
+	"strings"
+
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+)
+
+// Categories and severities.
+const (
+	CategoryWeather  = "weather"
+	CategoryWater    = "water"
+	CategoryDisease  = "disease"
+	CategoryPest     = "pest"
+	CategoryNutrient = "nutrient"
+	CategoryWeed     = "weed"
+
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// Problem is one catalogue entry.
+type Problem struct {
+	Code     string         `json:"code"`
+	LabelTH  string         `json:"label_th"`
+	LabelEN  string         `json:"label_en"`
+	Category string         `json:"category"`
+	Severity string         `json:"severity"`
+	Scout    bool           `json:"scout"`    // needs a disease scouting round
+	KBQuery  string         `json:"kb_query"` // knowledge-base search for this problem
+	Actions  []types.PlanOp `json:"actions"`  // deterministic actions when the LLM is unavailable
+
+	keywords []string // free-text matches for clients that still send Thai words
+}
+
+// act is a default action; its title and notes are the catalogue messages
+// action.<key> (pkg/i18n), so tasks made from it can be shown in English.
+func act(typ, key string) types.PlanOp { return i18n.Op(typ, "action."+key, nil) }
+
+func actQty(typ, key string, v float64, unit string) types.PlanOp {
+	op := act(typ, key)
+	op.Qty, op.Unit = &v, unit
+	return op
+}
+
+var scoutDisease = act("inspect", "scout_disease")
+
+// seasonalScout is added to every set of actions.
+var seasonalScout = i18n.Op("inspect", "task.scout_season", nil)
+
+var catalogue = []Problem{
+	{
+		Code: "storm", LabelTH: "พายุ/ลมแรง", LabelEN: "Storm / strong wind",
+		Category: CategoryWeather, Severity: SeverityHigh,
+		KBQuery:  "อ้อย พายุ ลมแรง อ้อยล้ม ระบายน้ำ",
+		Actions:  []types.PlanOp{act("advisory", "prepare_drainage")},
+		keywords: []string{"พายุ", "ลมแรง", "storm"},
+	},
+	{
+		Code: "drought", LabelTH: "ดินแห้ง/ขาดน้ำ", LabelEN: "Dry soil / water stress",
+		Category: CategoryWater, Severity: SeverityHigh,
+		KBQuery:  "อ้อย ขาดน้ำ ภัยแล้ง การให้น้ำ",
+		Actions:  []types.PlanOp{actQty("irrigation", "extra_irrigation", 20, "mm")},
+		keywords: []string{"แห้ง", "ขาดน้ำ", "แล้ง", "drought", "dry"},
+	},
+	{
+		Code: "waterlogging", LabelTH: "น้ำขัง", LabelEN: "Waterlogging",
+		Category: CategoryWater, Severity: SeverityMedium,
+		KBQuery: "อ้อย น้ำท่วมขัง การระบายน้ำ รากเน่า",
+		Actions: []types.PlanOp{
+			act("advisory", "drain_field"),
+			act("inspect", "scout_root_rot"),
+		},
+		keywords: []string{"น้ำขัง", "น้ำท่วม", "flood", "waterlog"},
+	},
+	{
+		Code: "white_leaf", LabelTH: "โรคใบขาว", LabelEN: "White leaf disease",
+		Category: CategoryDisease, Severity: SeverityHigh, Scout: true,
+		KBQuery: "โรคใบขาวอ้อย เพลี้ยจักจั่น การป้องกัน",
+		Actions: []types.PlanOp{
+			scoutDisease,
+			act("advisory", "rogue_white_leaf"),
+		},
+		keywords: []string{"ใบขาว", "white leaf"},
+	},
+	{
+		Code: "grassy_shoot", LabelTH: "โรคกอตะไคร้", LabelEN: "Grassy shoot disease",
+		Category: CategoryDisease, Severity: SeverityHigh, Scout: true,
+		KBQuery:  "โรคกอตะไคร้อ้อย ไฟโตพลาสมา",
+		Actions:  []types.PlanOp{scoutDisease},
+		keywords: []string{"กอตะไคร้", "grassy shoot"},
+	},
+	{
+		Code: "smut", LabelTH: "โรคแส้ดำ", LabelEN: "Smut",
+		Category: CategoryDisease, Severity: SeverityMedium, Scout: true,
+		KBQuery: "โรคแส้ดำอ้อย การป้องกันกำจัด",
+		Actions: []types.PlanOp{
+			scoutDisease,
+			act("advisory", "remove_smut"),
+		},
+		keywords: []string{"แส้ดำ", "smut"},
+	},
+	{
+		Code: "ring_spot", LabelTH: "โรคใบจุดวงแหวน", LabelEN: "Ring spot",
+		Category: CategoryDisease, Severity: SeverityLow, Scout: true,
+		KBQuery:  "โรคใบจุดวงแหวนอ้อย",
+		Actions:  []types.PlanOp{scoutDisease},
+		keywords: []string{"จุดวงแหวน", "ring spot"},
+	},
+	{
+		Code: "red_rot", LabelTH: "โรคเน่าแดง", LabelEN: "Red rot",
+		Category: CategoryDisease, Severity: SeverityMedium, Scout: true,
+		KBQuery:  "โรคเน่าแดงอ้อย",
+		Actions:  []types.PlanOp{scoutDisease},
+		keywords: []string{"เน่าแดง", "red rot"},
+	},
+	{
+		Code: "stem_borer", LabelTH: "หนอนกออ้อย", LabelEN: "Shoot / stem borer",
+		Category: CategoryPest, Severity: SeverityMedium,
+		KBQuery: "หนอนกออ้อย แตนเบียนไข่ การควบคุม",
+		Actions: []types.PlanOp{
+			act("inspect", "scout_borer"),
+			act("advisory", "release_parasitoids"),
+		},
+		keywords: []string{"หนอนกอ", "borer"},
+	},
+	{
+		Code: "longhorn_grub", LabelTH: "หนอนด้วงหนวดยาว", LabelEN: "Longhorn beetle grub",
+		Category: CategoryPest, Severity: SeverityHigh,
+		KBQuery: "ด้วงหนวดยาวอ้อย การป้องกันกำจัด",
+		Actions: []types.PlanOp{
+			act("inspect", "scout_grub"),
+		},
+		keywords: []string{"ด้วงหนวดยาว", "หนอนด้วง", "grub"},
+	},
+	{
+		Code: "yellowing", LabelTH: "ใบเหลือง/ขาดธาตุอาหาร", LabelEN: "Yellowing / nutrient deficiency",
+		Category: CategoryNutrient, Severity: SeverityMedium,
+		KBQuery: "อ้อย ใบเหลือง ขาดไนโตรเจน ปุ๋ย",
+		Actions: []types.PlanOp{
+			actQty("fertilizer", "nitrogen_topup", 10, "kg/rai"),
+		},
+		keywords: []string{"ใบเหลือง", "ขาดธาตุ", "ขาดปุ๋ย", "yellow"},
+	},
+	{
+		Code: "weeds", LabelTH: "วัชพืชระบาด", LabelEN: "Weed pressure",
+		Category: CategoryWeed, Severity: SeverityLow,
+		KBQuery:  "การกำจัดวัชพืชในไร่อ้อย",
+		Actions:  []types.PlanOp{act("advisory", "weed_rows")},
+		keywords: []string{"วัชพืช", "หญ้า", "weed"},
+	},
+}
+
+var byCode = func() map[string]Problem {
+	m := make(map[string]Problem, len(catalogue))
+	for _, p := range catalogue {
+		m[p.Code] = p
+	}
+	return m
+}()
+
+// The labels are messages too ("problem.<code>"), for task text that names
+// a problem.
+func init() {
+	for _, p := range catalogue {
+		i18n.Register(LabelKey(p.Code), map[string]string{i18n.TH: p.LabelTH, i18n.EN: p.LabelEN})
+	}
+}
+
+// LabelKey is the i18n message key of a problem's label.
+func LabelKey(code string) string { return "problem." + code }
+
+// Label is the problem's label in loc.
+func (p Problem) Label(loc string) string {
+	if loc == i18n.EN {
+		return p.LabelEN
+	}
+	return p.LabelTH
+}
+
+// All returns the catalogue in display order.
+func All() []Problem {
+	return append([]Problem(nil), catalogue...)
+}
+
+// Lookup finds a problem by code.
+func Lookup(code string) (Problem, bool) {
+	p, ok := byCode[strings.ToLower(strings.TrimSpace(code))]
+	return p, ok
+}
+
+// Match finds the catalogue entries mentioned in free text (code, labels or
+// keywords).
+func Match(text string) []Problem {
+	t := strings.ToLower(text)
+	var out []Problem
+	for _, p := range catalogue {
+		for _, k := range append([]string{p.Code, p.LabelTH, strings.ToLower(p.LabelEN)}, p.keywords...) {
+			if strings.Contains(t, k) {
+				out = append(out, p)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// Resolve maps replan inputs to catalogue entries: codes first, then free
+// text. Free text that matches nothing is returned in rest.
+func Resolve(codes, text []string) (found []Problem, rest []string) {
+	seen := map[string]bool{}
+	add := func(p Problem) {
+		if !seen[p.Code] {
+			seen[p.Code] = true
+			found = append(found, p)
+		}
+	}
+	for _, c := range codes {
+		if p, ok := Lookup(c); ok {
+			add(p)
+		}
+	}
+	for _, t := range text {
+		if p, ok := Lookup(t); ok {
+			add(p)
+			continue
+		}
+		ms := Match(t)
+		if len(ms) == 0 {
+			rest = append(rest, t)
+		}
+		for _, p := range ms {
+			add(p)
+		}
+	}
+	return found, rest
+}
+
+// Actions returns the default actions of the problems, without duplicates,
+// followed by the seasonal scouting round that every replan gets.
+func Actions(ps []Problem) []types.PlanOp {
+	seen := map[string]bool{}
+	var out []types.PlanOp
+	for _, op := range append(flatten(ps), seasonalScout) {
+		if k := op.Type + "|" + op.Title; !seen[k] {
+			seen[k] = true
+			out = append(out, op)
+		}
+	}
+	return out
+}
+
+// NeedsScout reports whether any of the problems calls for disease scouting.
+func NeedsScout(ps []Problem) bool {
+	for _, p := range ps {
+		if p.Scout {
+			return true
+		}
+	}
+	return false
+}
+
+func flatten(ps []Problem) []types.PlanOp {
+	var out []types.PlanOp
+	for _, p := range ps {
+		out = append(out, p.Actions...)
+	}
+	return out
+}
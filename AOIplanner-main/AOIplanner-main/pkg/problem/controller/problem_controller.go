@@ -0,0 +1,7 @@
+package controller
+
+import "github.com/labstack/echo/v4"
+
+type ProblemController interface {
+	List(c echo.Context) error
+}
@@ -0,0 +1,31 @@
+package controllerImp
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"aoi/pkg/i18n"
+	"aoi/pkg/plan/types"
+	"aoi/pkg/problem"
+)
+
+type ProblemCtrl struct{}
+
+func New() *ProblemCtrl { return &ProblemCtrl{} }
+
+// List returns the problem catalogue for the replan picker, optionally
+// filtered by ?category=. Action text is in the request's language.
+func (h *ProblemCtrl) List(c echo.Context) error {
+	cat := c.QueryParam("category")
+	loc := i18n.FromContext(c.Request().Context())
+	out := make([]problem.Problem, 0)
+	for _, p := range problem.All() {
+		if cat == "" || p.Category == cat {
+			p.Actions = append([]types.PlanOp(nil), p.Actions...)
+			i18n.LocalizeOps(p.Actions, loc)
+			out = append(out, p)
+		}
+	}
+	return c.JSON(http.StatusOK, out)
+}
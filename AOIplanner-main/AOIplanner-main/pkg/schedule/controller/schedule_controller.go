@@ -5,4 +5,8 @@ import "github.com/labstack/echo/v4"
 type ScheduleController interface {
 	List(c echo.Context) error
 	Patch(c echo.Context) error
+	Create(c echo.Context) error
+	Move(c echo.Context) error
+	Split(c echo.Context) error
+	Delete(c echo.Context) error
 }
\ No newline at end of file
@@ -1,15 +1,21 @@
 package controllerImp
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"aoi/pkg/i18n"
 	repo "aoi/pkg/schedule/repository"
+	"aoi/pkg/schedule/service"
+	"aoi/pkg/schedule/serviceImp"
 )
 
-type SchedCtrl struct{ repo repo.ScheduleRepository }
+type SchedCtrl struct{ repo repo.ScheduleRepository; svc service.ScheduleService }
 
-func New(repo repo.ScheduleRepository) *SchedCtrl { return &SchedCtrl{repo} }
+func New(repo repo.ScheduleRepository, svc service.ScheduleService) *SchedCtrl { return &SchedCtrl{repo, svc} }
 
 func (h *SchedCtrl) List(c echo.Context) error {
 	fid, _ := strconv.Atoi(c.Param("id"))
@@ -17,14 +23,91 @@ func (h *SchedCtrl) List(c echo.Context) error {
 	to := c.QueryParam("to")
 	out, err := h.repo.List(uint(fid), from, to)
 	if err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()}) }
+	i18n.LocalizeTasks(out, i18n.FromContext(c.Request().Context()))
 	return c.JSON(http.StatusOK, out)
 }
 
+// Patch sets a task's status and optionally its quantity: {"status":"done","qty":n}.
 func (h *SchedCtrl) Patch(c echo.Context) error {
+	uid := c.Get("uid").(string)
 	tid, _ := strconv.Atoi(c.Param("task_id"))
 	var body struct{ Status string `json:"status"`; Qty *float64 `json:"qty"` }
 	if err := c.Bind(&body); err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"bad json"}) }
 	if body.Status == "" { body.Status = "done" }
-	if err := h.repo.PatchStatus(uint(tid), body.Status, body.Qty); err != nil { return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()}) }
+	if _, err := h.svc.Patch(uint(tid), uid, body.Status, body.Qty); err != nil { return editError(c, err) }
 	return c.JSON(http.StatusOK, map[string]string{"status":"ok"})
-}
\ No newline at end of file
+}
+
+type taskReq struct {
+	Date  string   `json:"date"` // YYYY-MM-DD
+	Type  string   `json:"type"`
+	Title string   `json:"title"`
+	Qty   *float64 `json:"qty"`
+	Unit  string   `json:"unit"`
+	Notes string   `json:"notes"`
+}
+
+// Create adds a manual task to the field's active plan.
+func (h *SchedCtrl) Create(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	fid, _ := strconv.Atoi(c.Param("id"))
+	var req taskReq
+	if err := c.Bind(&req); err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"bad json"}) }
+	d, err := time.Parse("2006-01-02", req.Date)
+	if err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"date must be YYYY-MM-DD"}) }
+	t, err := h.svc.Create(uint(fid), uid, service.NewTask{Date: d, Type: req.Type, Title: req.Title, Qty: req.Qty, Unit: req.Unit, Notes: req.Notes})
+	if err != nil { return editError(c, err) }
+	return c.JSON(http.StatusCreated, t)
+}
+
+// Move reschedules a task: {"date":"YYYY-MM-DD"}.
+func (h *SchedCtrl) Move(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	tid, _ := strconv.Atoi(c.Param("task_id"))
+	var req taskReq
+	if err := c.Bind(&req); err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"bad json"}) }
+	d, err := time.Parse("2006-01-02", req.Date)
+	if err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"date must be YYYY-MM-DD"}) }
+	t, err := h.svc.Move(uint(tid), uid, d)
+	if err != nil { return editError(c, err) }
+	i18n.LocalizeTask(t, i18n.FromContext(c.Request().Context()))
+	return c.JSON(http.StatusOK, t)
+}
+
+// Split moves part of a task to another day: {"date":"YYYY-MM-DD","qty":n}.
+func (h *SchedCtrl) Split(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	tid, _ := strconv.Atoi(c.Param("task_id"))
+	var req taskReq
+	if err := c.Bind(&req); err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"bad json"}) }
+	d, err := time.Parse("2006-01-02", req.Date)
+	if err != nil { return c.JSON(http.StatusBadRequest, map[string]string{"error":"date must be YYYY-MM-DD"}) }
+	ts, err := h.svc.Split(uint(tid), uid, d, req.Qty)
+	if err != nil { return editError(c, err) }
+	i18n.LocalizeTasks(ts, i18n.FromContext(c.Request().Context()))
+	return c.JSON(http.StatusCreated, ts)
+}
+
+func (h *SchedCtrl) Delete(c echo.Context) error {
+	uid := c.Get("uid").(string)
+	tid, _ := strconv.Atoi(c.Param("task_id"))
+	if err := h.svc.Delete(uint(tid), uid); err != nil { return editError(c, err) }
+	return c.NoContent(http.StatusNoContent)
+}
+
+// editError maps schedule edit errors to HTTP statuses; rule violations are
+// 422 with the rule name.
+func editError(c echo.Context, err error) error {
+	var ce *serviceImp.ConstraintError
+	switch {
+	case errors.As(err, &ce):
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": ce.Msg, "rule": ce.Rule})
+	case errors.Is(err, serviceImp.ErrBadEdit):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, serviceImp.ErrNoActivePlan):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error":"not found"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
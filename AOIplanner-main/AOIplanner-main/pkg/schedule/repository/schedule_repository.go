@@ -1,9 +1,20 @@
 package repository
 
-import "aoi/entities"
+import (
+	"context"
+
+	"aoi/entities"
+)
 
 type ScheduleRepository interface {
+	WithContext(ctx context.Context) ScheduleRepository // same repository, queries bound to ctx
 	BulkInsert([]entities.ScheduleTask) error
-	List(fieldID uint, from, to string) ([]entities.ScheduleTask, error)
-	PatchStatus(taskID uint, status string, qty *float64) error
+	List(fieldID uint, from, to string) ([]entities.ScheduleTask, error) // tasks of the approved plan
+	ListByPlan(planID uint) ([]entities.ScheduleTask, error)
+	ListManual(planID uint) ([]entities.ScheduleTask, error) // manual tasks incl. tombstones
+	FindByID(taskID uint) (*entities.ScheduleTask, error)
+	Create(t *entities.ScheduleTask) error
+	Save(t *entities.ScheduleTask) error
+	Split(orig, part *entities.ScheduleTask) error // saves orig and creates part atomically
+	Delete(taskID uint) error
 }
\ No newline at end of file
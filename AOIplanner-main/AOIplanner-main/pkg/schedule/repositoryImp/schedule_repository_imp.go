@@ -1,6 +1,7 @@
 package repositoryImp
 
 import (
+	"context"
 	"time"
 	"aoi/entities"
 	"aoi/pkg/schedule/repository"
@@ -11,6 +12,8 @@ type schedRepo struct{ db *gorm.DB }
 
 func New(db *gorm.DB) repository.ScheduleRepository { return &schedRepo{db} }
 
+func (r *schedRepo) WithContext(ctx context.Context) repository.ScheduleRepository { return &schedRepo{r.db.WithContext(ctx)} }
+
 func (r *schedRepo) BulkInsert(ts []entities.ScheduleTask) error { return r.db.Create(&ts).Error }
 
 func (r *schedRepo) List(fieldID uint, from, to string) ([]entities.ScheduleTask, error) {
@@ -19,15 +22,44 @@ func (r *schedRepo) List(fieldID uint, from, to string) ([]entities.ScheduleTask
 	var err error
 	if from != "" { s, err = time.Parse("2006-01-02", from); if err!=nil { s = time.Time{} } }
 	if to != "" { e, err = time.Parse("2006-01-02", to); if err!=nil { e = time.Time{} } }
-	q := r.db.Where("field_id = ?", fieldID)
+	// only the field's current (approved) plan; drafts and superseded versions stay hidden
+	current := r.db.Model(&entities.Plan{}).Select("plan_id").Where("field_id = ? AND status = ?", fieldID, entities.PlanStatusApproved)
+	q := r.db.Where("field_id = ? AND plan_id IN (?) AND status <> ?", fieldID, current, entities.TaskStatusDeleted)
 	if !s.IsZero() { q = q.Where("date >= ?", s) }
 	if !e.IsZero() { q = q.Where("date <= ?", e) }
 	if err := q.Order("date ASC").Find(&out).Error; err != nil { return nil, err }
 	return out, nil
 }
 
-func (r *schedRepo) PatchStatus(taskID uint, status string, qty *float64) error {
-	upd := map[string]any{"status": status}
-	if qty != nil { upd["qty"] = qty }
-	return r.db.Model(&entities.ScheduleTask{}).Where("task_id = ?", taskID).Updates(upd).Error
-}
\ No newline at end of file
+func (r *schedRepo) ListByPlan(planID uint) ([]entities.ScheduleTask, error) {
+	var out []entities.ScheduleTask
+	if err := r.db.Where("plan_id = ? AND status <> ?", planID, entities.TaskStatusDeleted).Order("date ASC, task_id ASC").Find(&out).Error; err != nil { return nil, err }
+	return out, nil
+}
+
+func (r *schedRepo) ListManual(planID uint) ([]entities.ScheduleTask, error) {
+	var out []entities.ScheduleTask
+	if err := r.db.Where("plan_id = ? AND manual = ?", planID, true).Order("date ASC, task_id ASC").Find(&out).Error; err != nil { return nil, err }
+	return out, nil
+}
+
+func (r *schedRepo) FindByID(taskID uint) (*entities.ScheduleTask, error) {
+	var t entities.ScheduleTask
+	if err := r.db.First(&t, taskID).Error; err != nil { return nil, err }
+	return &t, nil
+}
+
+func (r *schedRepo) Create(t *entities.ScheduleTask) error { return r.db.Create(t).Error }
+
+func (r *schedRepo) Save(t *entities.ScheduleTask) error { return r.db.Save(t).Error }
+
+func (r *schedRepo) Split(orig, part *entities.ScheduleTask) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(orig).Error; err != nil { return err }
+		return tx.Create(part).Error
+	})
+}
+
+func (r *schedRepo) Delete(taskID uint) error {
+	return r.db.Delete(&entities.ScheduleTask{}, taskID).Error
+}
@@ -1,8 +1,32 @@
 package service
 
-import "aoi/entities"
+import (
+	"time"
+
+	"aoi/entities"
+)
 
 type ScheduleService interface {
-List(fieldID uint, from, to string) ([]entities.ScheduleTask, error)
-Patch(taskID uint, status string, qty *float64) error
-}
\ No newline at end of file
+	List(fieldID uint, from, to string) ([]entities.ScheduleTask, error)
+
+	// Manual editing of the field's active plan; uid must own the field.
+	Patch(taskID uint, uid, status string, qty *float64) (*entities.ScheduleTask, error)
+	Create(fieldID uint, uid string, t NewTask) (*entities.ScheduleTask, error)
+	Move(taskID uint, uid string, date time.Time) (*entities.ScheduleTask, error)
+	Split(taskID uint, uid string, date time.Time, qty *float64) ([]entities.ScheduleTask, error)
+	Delete(taskID uint, uid string) error
+}
+
+// NewTask is a task added by hand, or by a service on the user's behalf.
+type NewTask struct {
+	Date  time.Time
+	Type  string
+	Title string
+	Qty   *float64
+	Unit  string
+	Notes string
+
+	// catalogue message of Title/Notes (pkg/i18n); empty for user text
+	MsgKey    string
+	MsgParams map[string]string
+}
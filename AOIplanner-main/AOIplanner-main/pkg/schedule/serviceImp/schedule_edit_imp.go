@@ -0,0 +1,228 @@
+package serviceImp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"aoi/entities"
+	"aoi/pkg/plan/types"
+	"aoi/pkg/schedule/service"
+)
+
+const (
+	// MinFertilizerGapDays is the minimum spacing between two fertilizer applications.
+	MinFertilizerGapDays = 14
+	// HeavyRainMM is the daily rainfall (TMD "heavy rain") treated as waterlogging.
+	HeavyRainMM = 35.0
+)
+
+// taskTypes are the types a schedule task may have.
+var taskTypes = map[string]bool{
+	"irrigation": true, "fertilizer": true, "pesticide": true, "pest": true,
+	"inspect": true, "observe": true, "advisory": true, "other": true,
+}
+
+var (
+	// ErrNoActivePlan is returned when the field has no approved plan, or the
+	// task belongs to an older or not yet approved version.
+	ErrNoActivePlan = errors.New("task is not on the field's active plan")
+	// ErrBadEdit is returned for malformed edit requests.
+	ErrBadEdit = errors.New("invalid schedule edit")
+)
+
+// ConstraintError is a manual edit rejected by a scheduling rule.
+type ConstraintError struct {
+	Rule string // waterlogged|fertilizer_gap|crop_cycle
+	Msg  string
+}
+
+func (e *ConstraintError) Error() string { return e.Msg }
+
+// Create adds a user task to the field's active plan.
+func (s *schedSvc) Create(fieldID uint, uid string, nt service.NewTask) (*entities.ScheduleTask, error) {
+	nt.Type, nt.Title = strings.TrimSpace(nt.Type), strings.TrimSpace(nt.Title)
+	if nt.Type == "" || nt.Title == "" || nt.Date.IsZero() {
+		return nil, fmt.Errorf("%w: date, type and title are required", ErrBadEdit)
+	}
+	if !taskTypes[nt.Type] {
+		return nil, fmt.Errorf("%w: unknown task type %q", ErrBadEdit, nt.Type)
+	}
+	f, err := s.fields.FindByID(fieldID, uid)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.plans.CurrentByField(f.FieldID)
+	if err != nil {
+		return nil, ErrNoActivePlan
+	}
+	t := &entities.ScheduleTask{
+		FieldID: f.FieldID, PlanID: p.PlanID, Date: day(nt.Date), Type: nt.Type, Title: nt.Title,
+		Qty: nt.Qty, Unit: nt.Unit, Notes: nt.Notes, Status: "todo", Manual: true,
+		MsgKey: nt.MsgKey, MsgParams: nt.MsgParams,
+	}
+	if err := s.check(p, t); err != nil {
+		return nil, err
+	}
+	if err := s.r.Create(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Move reschedules a task to another day.
+func (s *schedSvc) Move(taskID uint, uid string, date time.Time) (*entities.ScheduleTask, error) {
+	if date.IsZero() {
+		return nil, fmt.Errorf("%w: date is required", ErrBadEdit)
+	}
+	t, p, err := s.editable(taskID, uid)
+	if err != nil {
+		return nil, err
+	}
+	markManual(t)
+	t.Date = day(date)
+	if err := s.check(p, t); err != nil {
+		return nil, err
+	}
+	if err := s.r.Save(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Split moves part of a task to another day. With a quantity, qty goes to the
+// new task and the rest stays; without one the task is duplicated.
+func (s *schedSvc) Split(taskID uint, uid string, date time.Time, qty *float64) ([]entities.ScheduleTask, error) {
+	if date.IsZero() {
+		return nil, fmt.Errorf("%w: date is required", ErrBadEdit)
+	}
+	t, p, err := s.editable(taskID, uid)
+	if err != nil {
+		return nil, err
+	}
+	part := entities.ScheduleTask{
+		FieldID: t.FieldID, PlanID: t.PlanID, Date: day(date), Type: t.Type, Title: t.Title,
+		Unit: t.Unit, Notes: t.Notes, Status: "todo", Manual: true,
+		MsgKey: t.MsgKey, MsgParams: t.MsgParams,
+	}
+	if t.Qty != nil {
+		if qty == nil || *qty <= 0 || *qty >= *t.Qty {
+			return nil, fmt.Errorf("%w: qty must be between 0 and %.2f", ErrBadEdit, *t.Qty)
+		}
+		rest, moved := *t.Qty-*qty, *qty
+		t.Qty, part.Qty = &rest, &moved
+	}
+	markManual(t)
+	if err := s.check(p, &part); err != nil {
+		return nil, err
+	}
+	if err := s.r.Split(t, &part); err != nil {
+		return nil, err
+	}
+	return []entities.ScheduleTask{*t, part}, nil
+}
+
+// Delete removes a task. User-created tasks are deleted; planner tasks are
+// kept as tombstones so a replan does not recreate them.
+func (s *schedSvc) Delete(taskID uint, uid string) error {
+	t, _, err := s.editable(taskID, uid)
+	if err != nil {
+		return err
+	}
+	if t.Manual && t.OrigDate == nil {
+		return s.r.Delete(t.TaskID)
+	}
+	markManual(t)
+	t.Status = entities.TaskStatusDeleted
+	return s.r.Save(t)
+}
+
+// editable loads a task of uid's field and checks that it is on the active plan.
+func (s *schedSvc) editable(taskID uint, uid string) (*entities.ScheduleTask, *entities.Plan, error) {
+	t, err := s.r.FindByID(taskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.fields.FindByID(t.FieldID, uid); err != nil {
+		return nil, nil, err
+	}
+	if t.Status == entities.TaskStatusDeleted {
+		return nil, nil, fmt.Errorf("%w: task was deleted", ErrBadEdit)
+	}
+	p, err := s.plans.CurrentByField(t.FieldID)
+	if err != nil || p.PlanID != t.PlanID {
+		return nil, nil, ErrNoActivePlan
+	}
+	return t, p, nil
+}
+
+// check validates t (at its new date) against the plan's crop cycle, the
+// field's waterlogged days and the fertilizer spacing rule.
+func (s *schedSvc) check(p *entities.Plan, t *entities.ScheduleTask) error {
+	var stages []types.StagePlan
+	_ = json.Unmarshal([]byte(p.StagesJSON), &stages)
+	if len(stages) > 0 {
+		start, _ := time.Parse("2006-01-02", stages[0].StartDate)
+		end, _ := time.Parse("2006-01-02", stages[len(stages)-1].EndDate)
+		if t.Date.Before(start) || !t.Date.Before(end) {
+			return &ConstraintError{Rule: "crop_cycle", Msg: fmt.Sprintf("%s is outside the crop cycle (%s to %s)",
+				t.Date.Format("2006-01-02"), start.Format("2006-01-02"), end.AddDate(0, 0, -1).Format("2006-01-02"))}
+		}
+	}
+
+	switch t.Type {
+	case "irrigation":
+		ms, err := s.meas.ListByField(t.FieldID)
+		if err != nil {
+			return err
+		}
+		for _, m := range ms {
+			if !SameDay(m.Date, t.Date) {
+				continue
+			}
+			if m.MoistState == "wet" || (m.RainfallMM != nil && *m.RainfallMM >= HeavyRainMM) {
+				return &ConstraintError{Rule: "waterlogged", Msg: fmt.Sprintf("field is waterlogged on %s; no irrigation", t.Date.Format("2006-01-02"))}
+			}
+		}
+	case "fertilizer":
+		tasks, err := s.r.ListByPlan(t.PlanID)
+		if err != nil {
+			return err
+		}
+		for _, o := range tasks {
+			if o.Type != "fertilizer" || o.TaskID == t.TaskID {
+				continue
+			}
+			gap := t.Date.Sub(day(o.Date)).Hours() / 24
+			if gap < 0 {
+				gap = -gap
+			}
+			if gap < MinFertilizerGapDays {
+				return &ConstraintError{Rule: "fertilizer_gap", Msg: fmt.Sprintf("fertilizer on %s is within %d days of the application on %s",
+					t.Date.Format("2006-01-02"), MinFertilizerGapDays, o.Date.Format("2006-01-02"))}
+			}
+		}
+	}
+	return nil
+}
+
+// markManual flags a task as user-edited, remembering the planner's date the
+// first time a planner task is touched.
+func markManual(t *entities.ScheduleTask) {
+	if !t.Manual {
+		d := t.Date
+		t.OrigDate = &d
+	}
+	t.Manual = true
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// SameDay reports whether a and b fall on the same calendar date.
+func SameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
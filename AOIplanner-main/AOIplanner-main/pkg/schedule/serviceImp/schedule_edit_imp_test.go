@@ -0,0 +1,266 @@
+package serviceImp
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"aoi/database"
+	"aoi/entities"
+	fieldRepoImp "aoi/pkg/field/repositoryImp"
+	measRepoImp "aoi/pkg/measure/repositoryImp"
+	planRepoImp "aoi/pkg/plan/repositoryImp"
+	"aoi/pkg/plan/types"
+	"aoi/pkg/schedule/repository"
+	schedRepoImp "aoi/pkg/schedule/repositoryImp"
+	"aoi/pkg/schedule/service"
+
+	"gorm.io/gorm"
+)
+
+const testUID = "u1"
+
+// fixture is a field of testUID with an approved plan whose crop cycle runs
+// from 2026-05-01 up to (not including) 2027-05-01.
+type fixture struct {
+	db    *gorm.DB
+	svc   *schedSvc
+	sched repository.ScheduleRepository
+	field entities.Field
+	plan  entities.Plan
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	db := database.OpenSQLite(filepath.Join(t.TempDir(), "aoi.db"))
+	fx := &fixture{db: db, sched: schedRepoImp.New(db)}
+	fx.svc = NewScheduleService(fx.sched, planRepoImp.New(db), measRepoImp.New(db), fieldRepoImp.New(db)).(*schedSvc)
+
+	fx.field = entities.Field{UserID: testUID, Variety: "KK3", AreaRai: 5}
+	if err := db.Create(&fx.field).Error; err != nil {
+		t.Fatal(err)
+	}
+	stages, _ := json.Marshal([]types.StagePlan{
+		{Stage: "germination", StartDate: "2026-05-01", EndDate: "2026-07-01"},
+		{Stage: "maturity", StartDate: "2026-07-01", EndDate: "2027-05-01"},
+	})
+	fx.plan = entities.Plan{FieldID: fx.field.FieldID, Version: 1, StagesJSON: string(stages), Status: entities.PlanStatusApproved}
+	if err := db.Create(&fx.plan).Error; err != nil {
+		t.Fatal(err)
+	}
+	return fx
+}
+
+// plannerTask stores a generated (not manual) task on the plan.
+func (fx *fixture) plannerTask(t *testing.T, typ, date string, qty *float64) entities.ScheduleTask {
+	t.Helper()
+	task := entities.ScheduleTask{
+		FieldID: fx.field.FieldID, PlanID: fx.plan.PlanID, Date: mustDate(t, date),
+		Type: typ, Title: typ, Qty: qty, Unit: "kg", Status: "todo",
+	}
+	if err := fx.sched.Create(&task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func mustDate(t *testing.T, s string) time.Time {
+	t.Helper()
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func ptr(v float64) *float64 { return &v }
+
+// wantRule fails unless err is a ConstraintError for rule ("" = no error).
+func wantRule(t *testing.T, err error, rule string) {
+	t.Helper()
+	var ce *ConstraintError
+	switch {
+	case rule == "" && err != nil:
+		t.Fatalf("unexpected error: %v", err)
+	case rule != "" && !errors.As(err, &ce):
+		t.Fatalf("want %s violation, got %v", rule, err)
+	case rule != "" && ce.Rule != rule:
+		t.Fatalf("want %s violation, got %s: %s", rule, ce.Rule, ce.Msg)
+	}
+}
+
+func TestCheckCropCycle(t *testing.T) {
+	fx := newFixture(t)
+	for _, tc := range []struct {
+		date, rule string
+	}{
+		{"2026-04-30", "crop_cycle"},
+		{"2026-05-01", ""},
+		{"2027-04-30", ""},
+		{"2027-05-01", "crop_cycle"}, // the last stage's end date is exclusive
+	} {
+		task := entities.ScheduleTask{FieldID: fx.field.FieldID, PlanID: fx.plan.PlanID, Type: "observe", Date: mustDate(t, tc.date)}
+		t.Run(tc.date, func(t *testing.T) { wantRule(t, fx.svc.check(&fx.plan, &task), tc.rule) })
+	}
+}
+
+func TestCheckWaterlogged(t *testing.T) {
+	fx := newFixture(t)
+	ms := []entities.Measurement{
+		{FieldID: fx.field.FieldID, Date: mustDate(t, "2026-06-01"), MoistState: "wet"},
+		{FieldID: fx.field.FieldID, Date: mustDate(t, "2026-06-02"), RainfallMM: ptr(HeavyRainMM)},
+		{FieldID: fx.field.FieldID, Date: mustDate(t, "2026-06-03"), RainfallMM: ptr(HeavyRainMM - 0.1), MoistState: "ok"},
+	}
+	if err := fx.db.Create(&ms).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		typ, date, rule string
+	}{
+		{"irrigation", "2026-06-01", "waterlogged"},
+		{"irrigation", "2026-06-02", "waterlogged"}, // exactly heavy rain
+		{"irrigation", "2026-06-03", ""},
+		{"irrigation", "2026-06-04", ""}, // no measurement that day
+		{"fertilizer", "2026-06-01", ""}, // only irrigation is blocked
+	} {
+		task := entities.ScheduleTask{FieldID: fx.field.FieldID, PlanID: fx.plan.PlanID, Type: tc.typ, Date: mustDate(t, tc.date)}
+		t.Run(tc.typ+" "+tc.date, func(t *testing.T) { wantRule(t, fx.svc.check(&fx.plan, &task), tc.rule) })
+	}
+}
+
+func TestCheckFertilizerGap(t *testing.T) {
+	fx := newFixture(t)
+	existing := fx.plannerTask(t, "fertilizer", "2026-06-15", ptr(50))
+	for _, tc := range []struct {
+		date, rule string
+	}{
+		{"2026-06-01", ""}, // exactly MinFertilizerGapDays before
+		{"2026-06-02", "fertilizer_gap"},
+		{"2026-06-28", "fertilizer_gap"},
+		{"2026-06-29", ""}, // exactly MinFertilizerGapDays after
+	} {
+		task := entities.ScheduleTask{FieldID: fx.field.FieldID, PlanID: fx.plan.PlanID, Type: "fertilizer", Date: mustDate(t, tc.date)}
+		t.Run(tc.date, func(t *testing.T) { wantRule(t, fx.svc.check(&fx.plan, &task), tc.rule) })
+	}
+
+	// a task is not checked against itself when it moves
+	if _, err := fx.svc.Move(existing.TaskID, testUID, mustDate(t, "2026-06-20")); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+}
+
+func TestSplitQty(t *testing.T) {
+	fx := newFixture(t)
+	orig := fx.plannerTask(t, "fertilizer", "2026-06-01", ptr(50))
+	to := mustDate(t, "2026-06-20")
+
+	for _, qty := range []*float64{nil, ptr(0), ptr(-1), ptr(50), ptr(60)} {
+		if _, err := fx.svc.Split(orig.TaskID, testUID, to, qty); !errors.Is(err, ErrBadEdit) {
+			t.Errorf("split qty %v: want ErrBadEdit, got %v", qty, err)
+		}
+	}
+
+	parts, err := fx.svc.Split(orig.TaskID, testUID, to, ptr(20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, moved := parts[0], parts[1]
+	if *kept.Qty != 30 || *moved.Qty != 20 {
+		t.Errorf("split 50 by 20: kept %v, moved %v", *kept.Qty, *moved.Qty)
+	}
+	if !kept.Manual || kept.OrigDate == nil || !kept.OrigDate.Equal(orig.Date) {
+		t.Errorf("original not marked manual with its planner date: %+v", kept)
+	}
+	if !moved.Manual || moved.OrigDate != nil || !moved.Date.Equal(to) {
+		t.Errorf("new part: %+v", moved)
+	}
+	if moved.UID == "" || moved.UID == kept.UID {
+		t.Errorf("new part needs its own UID: %q vs %q", moved.UID, kept.UID)
+	}
+
+	// without a quantity the task is duplicated
+	obs := fx.plannerTask(t, "observe", "2026-06-01", nil)
+	parts, err = fx.svc.Split(obs.TaskID, testUID, to, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parts[0].Qty != nil || parts[1].Qty != nil || !parts[1].Date.Equal(to) {
+		t.Errorf("duplicate: %+v", parts)
+	}
+}
+
+func TestDeleteTombstoneVsHardDelete(t *testing.T) {
+	fx := newFixture(t)
+
+	user, err := fx.svc.Create(fx.field.FieldID, testUID, service.NewTask{Date: mustDate(t, "2026-06-01"), Type: "observe", Title: "look"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fx.svc.Delete(user.TaskID, testUID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fx.sched.FindByID(user.TaskID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("user task: want row removed, got %v", err)
+	}
+
+	planner := fx.plannerTask(t, "observe", "2026-06-02", nil)
+	if err := fx.svc.Delete(planner.TaskID, testUID); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fx.sched.FindByID(planner.TaskID)
+	if err != nil {
+		t.Fatalf("planner task: want tombstone, got %v", err)
+	}
+	if got.Status != entities.TaskStatusDeleted || !got.Manual || got.OrigDate == nil {
+		t.Errorf("tombstone: %+v", got)
+	}
+	manual, _ := fx.sched.ListManual(fx.plan.PlanID)
+	if len(manual) != 1 || manual[0].TaskID != planner.TaskID {
+		t.Errorf("replans must carry the tombstone: %+v", manual)
+	}
+	if listed, _ := fx.sched.ListByPlan(fx.plan.PlanID); len(listed) != 0 {
+		t.Errorf("tombstone listed: %+v", listed)
+	}
+
+	if err := fx.svc.Delete(planner.TaskID, testUID); !errors.Is(err, ErrBadEdit) {
+		t.Errorf("deleting a tombstone: want ErrBadEdit, got %v", err)
+	}
+	if _, err := fx.svc.Move(planner.TaskID, testUID, mustDate(t, "2026-06-03")); !errors.Is(err, ErrBadEdit) {
+		t.Errorf("moving a tombstone: want ErrBadEdit, got %v", err)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	fx := newFixture(t)
+	task := fx.plannerTask(t, "fertilizer", "2026-06-01", ptr(50))
+
+	for _, status := range []string{"deleted", "cancelled", ""} {
+		if _, err := fx.svc.Patch(task.TaskID, testUID, status, nil); !errors.Is(err, ErrBadEdit) {
+			t.Errorf("status %q: want ErrBadEdit, got %v", status, err)
+		}
+	}
+	if _, err := fx.svc.Patch(task.TaskID, "someone-else", "done", nil); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("another user's task: want not found, got %v", err)
+	}
+
+	if _, err := fx.svc.Patch(task.TaskID, testUID, "done", ptr(40)); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := fx.sched.FindByID(task.TaskID)
+	if got.Status != "done" || *got.Qty != 40 || !got.Manual || got.OrigDate == nil {
+		t.Errorf("patched task: %+v", got)
+	}
+	if manual, _ := fx.sched.ListManual(fx.plan.PlanID); len(manual) != 1 {
+		t.Errorf("replans must carry the patched task: %+v", manual)
+	}
+}
+
+func TestCreateRejectsUnknownType(t *testing.T) {
+	fx := newFixture(t)
+	nt := service.NewTask{Date: mustDate(t, "2026-06-01"), Type: "harvest-party", Title: "x"}
+	if _, err := fx.svc.Create(fx.field.FieldID, testUID, nt); !errors.Is(err, ErrBadEdit) {
+		t.Errorf("unknown type: want ErrBadEdit, got %v", err)
+	}
+}
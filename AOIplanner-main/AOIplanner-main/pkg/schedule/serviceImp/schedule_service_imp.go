@@ -1,19 +1,44 @@
 package serviceImp
 
 import (
+"fmt"
 "aoi/pkg/schedule/service"
 repo "aoi/pkg/schedule/repository"
 "aoi/entities"
+fieldrepo "aoi/pkg/field/repository"
+measrepo "aoi/pkg/measure/repository"
+planrepo "aoi/pkg/plan/repository"
 )
 
-type schedSvc struct{ r repo.ScheduleRepository }
+type schedSvc struct{
+r      repo.ScheduleRepository
+plans  planrepo.PlanRepository
+meas   measrepo.MeasureRepository
+fields fieldrepo.FieldRepository
+}
 
-func NewScheduleService(r repo.ScheduleRepository) service.ScheduleService { return &schedSvc{r} }
+func NewScheduleService(r repo.ScheduleRepository, pr planrepo.PlanRepository, mr measrepo.MeasureRepository, fr fieldrepo.FieldRepository) service.ScheduleService {
+return &schedSvc{r: r, plans: pr, meas: mr, fields: fr}
+}
 
 func (s *schedSvc) List(fieldID uint, from, to string) ([]entities.ScheduleTask, error) {
 return s.r.List(fieldID, from, to)
 }
 
-func (s *schedSvc) Patch(taskID uint, status string, qty *float64) error {
-return s.r.PatchStatus(taskID, status, qty)
+// Patch sets the status (todo|done|skipped) and, optionally, the quantity of
+// a task on the active plan. The task is marked manual so a replan keeps it.
+func (s *schedSvc) Patch(taskID uint, uid, status string, qty *float64) (*entities.ScheduleTask, error) {
+if status != "todo" && status != "done" && status != "skipped" {
+return nil, fmt.Errorf("%w: status must be todo, done or skipped", ErrBadEdit)
+}
+if qty != nil && *qty < 0 {
+return nil, fmt.Errorf("%w: qty must not be negative", ErrBadEdit)
+}
+t, _, err := s.editable(taskID, uid)
+if err != nil { return nil, err }
+markManual(t)
+t.Status = status
+if qty != nil { t.Qty = qty }
+if err := s.r.Save(t); err != nil { return nil, err }
+return t, nil
 }
\ No newline at end of file
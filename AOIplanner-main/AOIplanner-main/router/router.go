@@ -7,21 +7,36 @@ import (
 
 func New(
 	e *echo.Echo,
-	fieldCtrl interface{ Create(echo.Context) error; Get(echo.Context) error },
+	fieldCtrl interface{ Create(echo.Context) error; Get(echo.Context) error; Update(echo.Context) error },
 	planGenerate func(echo.Context) error,
 	planReplan   func(echo.Context) error,
 	planList     func(echo.Context) error,
+	planReplans  func(echo.Context) error,
+	planCitations func(echo.Context) error,
+	planScenarios func(echo.Context) error,
+	planSummaryStream func(echo.Context) error,
+	reviewCtrl interface{ Submit(echo.Context) error; Review(echo.Context) error; Reviews(echo.Context) error; PendingReviews(echo.Context) error },
 	measCtrl  interface{ Create(echo.Context) error; List(echo.Context) error },
-	schedCtrl interface{ List(echo.Context) error; Patch(echo.Context) error },
-	authCtrl  interface{ DevLogin(echo.Context) error; WhoAmI(echo.Context) error },
+	schedCtrl interface{ List(echo.Context) error; Patch(echo.Context) error; Create(echo.Context) error; Move(echo.Context) error; Split(echo.Context) error; Delete(echo.Context) error },
+	authCtrl  interface{ DevLogin(echo.Context) error; WhoAmI(echo.Context) error; SetLocale(echo.Context) error },
 	kbCtrl    interface{ IngestText(echo.Context) error; IngestURL(echo.Context) error; Search(echo.Context) error },
 	healthCtrl interface{ Health(echo.Context) error },
+	driftCtrl interface{ Status(echo.Context) error },
+	calCtrl   interface{ Token(echo.Context) error; RotateToken(echo.Context) error; UserFeed(echo.Context) error; FieldFeed(echo.Context) error },
+	exportCtrl interface{ Workbook(echo.Context) error; Report(echo.Context) error },
+	problemCtrl interface{ List(echo.Context) error },
+	llmCtrl   interface{ CacheStats(echo.Context) error; InvalidateField(echo.Context) error; Providers(echo.Context) error; Prompts(echo.Context) error; Calls(echo.Context) error },
+	diagCtrl  interface{ List(echo.Context) error; Rediagnose(echo.Context) error },
+	locale    echo.MiddlewareFunc, // after DevLogin: needs the uid
+	chatCtrl  interface{ Ask(echo.Context) error; Threads(echo.Context) error; Thread(echo.Context) error; Accept(echo.Context) error; Dismiss(echo.Context) error },
 
 ) *echo.Echo {
 	e.Use(middleware.DevLogin())
+	e.Use(locale)
 	api := e.Group("")
 
 	api.GET("/whoami", authCtrl.WhoAmI)
+	api.PUT("/whoami/locale", authCtrl.SetLocale)
 	api.GET("/devlogin", authCtrl.DevLogin)
 	e.GET("/health", healthCtrl.Health) 
 	
@@ -32,16 +47,62 @@ func New(
 
 	api.POST("/fields", fieldCtrl.Create)
 	api.GET("/fields/:id", fieldCtrl.Get)
+	api.PATCH("/fields/:id", fieldCtrl.Update)
 	
 	g := e.Group("/fields")
 	g.POST("/:id/plan", planGenerate)
 	g.POST("/:id/replan", planReplan)
 	g.GET("/:id/plan", planList)
+	g.GET("/:id/replans", planReplans)
+	g.GET("/:id/drift", driftCtrl.Status)
+	g.POST("/:id/scenarios", planScenarios)
+	api.GET("/plans/:plan_id/citations", planCitations)
+	api.GET("/plans/:plan_id/summary/stream", planSummaryStream)  // Server-Sent Events; preview only
+	api.POST("/plans/:plan_id/summary/stream", planSummaryStream) // same, and stores the summary
+	api.GET("/problems", problemCtrl.List)
+
+	// field assistant chat (answers cite the KB; proposed tasks are accepted one by one)
+	api.POST("/fields/:id/chat", chatCtrl.Ask)
+	api.GET("/fields/:id/chat", chatCtrl.Threads)
+	api.GET("/chat/threads/:thread_id", chatCtrl.Thread)
+	api.POST("/chat/messages/:msg_id/proposals/:n/accept", chatCtrl.Accept)
+	api.POST("/chat/messages/:msg_id/proposals/:n/dismiss", chatCtrl.Dismiss)
+
+	// LLM response cache
+	api.GET("/llm/cache", llmCtrl.CacheStats)
+	api.GET("/llm/providers", llmCtrl.Providers)
+	api.GET("/llm/prompts", llmCtrl.Prompts)
+	api.GET("/admin/llm/calls", llmCtrl.Calls)
+	api.DELETE("/fields/:id/llm-cache", llmCtrl.InvalidateField)
+
+	// plan approval (reviewers are configured with REVIEWER_UIDS)
+	api.POST("/plans/:plan_id/submit", reviewCtrl.Submit)
+	api.POST("/plans/:plan_id/review", reviewCtrl.Review)
+	api.GET("/plans/:plan_id/reviews", reviewCtrl.Reviews)
+	api.GET("/reviews/pending", reviewCtrl.PendingReviews)
 
 	api.POST("/fields/:id/measurements", measCtrl.Create)
 	api.GET("/fields/:id/measurements", measCtrl.List)
+	// photo diagnosis (photos are uploaded with the measurement)
+	api.GET("/fields/:id/diagnoses", diagCtrl.List)
+	api.POST("/measurements/:measure_id/diagnose", diagCtrl.Rediagnose)
 
 	api.GET("/fields/:id/schedule", schedCtrl.List)
+	api.POST("/fields/:id/schedule", schedCtrl.Create)
+
+	// iCalendar feeds (authenticated by ?token=, see /calendar/token)
+	api.GET("/calendar/token", calCtrl.Token)
+	api.POST("/calendar/token", calCtrl.RotateToken)
+	api.GET("/calendar.ics", calCtrl.UserFeed)
+	api.GET("/fields/:id/schedule.ics", calCtrl.FieldFeed)
+
+	// exports
+	api.GET("/fields/:id/export.xlsx", exportCtrl.Workbook)
+	api.GET("/fields/:id/report", exportCtrl.Report)
 	api.PATCH("/schedule/:task_id", schedCtrl.Patch)
+	// manual edits (checked against waterlogging, fertilizer spacing and the crop cycle)
+	api.POST("/schedule/:task_id/move", schedCtrl.Move)
+	api.POST("/schedule/:task_id/split", schedCtrl.Split)
+	api.DELETE("/schedule/:task_id", schedCtrl.Delete)
 	return e
 }
\ No newline at end of file
@@ -100,12 +100,13 @@ async function _generatePlan() {
     if (!isNaN(d)) { calYear = d.getFullYear(); calMonth = d.getMonth(); } 
   } catch(e){}
 
-  const res = await fetch(`/fields/${lastFieldId}/plan?format=calendar`, { method:'POST' });
+  const res = await fetch(`/fields/${lastFieldId}/plan?format=calendar&summary=stream`, { method:'POST' });
   let json = null;
   try { json = await res.json(); } catch(e) {}
 
   if (res.ok) {
     out('planOut', ' Plan generated successfully');
+    if (json && json.summary_stream) streamSummary(json.summary_stream);
   } else {
     out('planOut', ` Failed: ${res.status} ${res.statusText}`);
     return;
@@ -154,6 +155,46 @@ async function _generatePlan() {
 
 }
 
+// ===== สรุปแผนแบบสตรีม (SSE) — แสดงข้อความทีละส่วนระหว่างที่ LLM เขียน =====
+// POST เพื่อบันทึกสรุปลงแผน (GET ใช้ดูตัวอย่างเท่านั้น) จึงอ่าน event เองแทน EventSource
+async function streamSummary(url) {
+  const el = document.getElementById('planSummary');
+  if (!el) return;
+  el.textContent = 'กำลังสรุปแผน…';
+  let started = false;
+  const onEvent = (event, data) => {
+    if (event === 'delta') {
+      if (!started) { el.textContent = ''; started = true; }
+      el.textContent += JSON.parse(data).text;
+    } else if (event === 'done') {
+      el.textContent = JSON.parse(data).summary_md; // fallback replaces partial text
+    }
+  };
+  try {
+    const res = await fetch(url, { method: 'POST' });
+    if (!res.ok || !res.body) { el.textContent = ''; return; }
+    const reader = res.body.getReader();
+    const dec = new TextDecoder();
+    let buf = '';
+    for (;;) {
+      const { value, done } = await reader.read();
+      if (done) break;
+      buf += dec.decode(value, { stream: true });
+      let i;
+      while ((i = buf.indexOf('\n\n')) >= 0) {
+        const block = buf.slice(0, i);
+        buf = buf.slice(i + 2);
+        let event = 'message', data = '';
+        for (const line of block.split('\n')) {
+          if (line.startsWith('event: ')) event = line.slice(7);
+          else if (line.startsWith('data: ')) data += line.slice(6);
+        }
+        onEvent(event, data);
+      }
+    }
+  } catch (e) {}
+}
+
 // ===== Get Schedule (ตอน 3 → JSON output) =====
 async function _getSchedule() {
   if (!lastFieldId) return out('schedOut', 'Create a field first.');